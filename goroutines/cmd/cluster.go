@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+
+	"github.com/DonAlexandro/go_advanced/pkg/wordfreq"
+)
+
+// runCluster groups the files of stored results by topic, e.g. to organise an unlabelled archive
+func runCluster(args []string) int {
+	flags := flag.NewFlagSet("cluster", flag.ContinueOnError)
+	methodName := flags.String("method", "agglomerative", "Clustering method: agglomerative or kmeans")
+	clusters := flags.Int("k", 5, "Number of clusters")
+	neighbours := flags.Int("neighbours", 10, "Most similar files kept per file (0 keeps all pairs)")
+	terms := flags.Int("terms", 8, "Number of characteristic terms listed per cluster")
+	iterations := flags.Int("iterations", 50, "Maximum number of k-means rounds")
+	files := flags.String("files", "", "Only cluster files matching this glob, e.g. 'logs/*.txt'")
+	format := flags.String("format", "table", "Output format: table or json")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		slog.Error(fmt.Sprintf("usage: %s cluster [-method agglomerative|kmeans] [-k <clusters>] [-neighbours <files>] [-terms <words>] [-files <glob>] [-format table|json] <result>...\n", os.Args[0]))
+		slog.Error(fmt.Sprintf("example: %s cluster -k 8 results/result_2025-12-07_23-32-40.json\n", os.Args[0]))
+		return 1
+	}
+
+	if *format != "table" && *format != "json" {
+		slog.Error("invalid cluster format", slog.String("format", *format))
+		return 1
+	}
+
+	method, err := wordfreq.ParseClusterMethod(*methodName)
+	if err != nil {
+		slog.Error("invalid cluster method", slog.Any("error", err))
+		return 1
+	}
+
+	if *clusters < 1 || *neighbours < 0 || *terms < 0 || *iterations < 1 {
+		slog.Error("invalid cluster settings", slog.Int("k", *clusters), slog.Int("neighbours", *neighbours), slog.Int("terms", *terms), slog.Int("iterations", *iterations))
+		return 1
+	}
+
+	// Several result files are clustered as one result set
+	var results []wordfreq.FileWordFrequency
+	for _, filename := range flags.Args() {
+		loaded, err := wordfreq.LoadResults(filename)
+		if err != nil {
+			slog.Error("failed to load results", slog.String("filename", filename), slog.Any("error", err))
+			return 1
+		}
+		results = append(results, loaded...)
+	}
+
+	// The file filter of the query subcommand selects the files to cluster
+	if *files != "" {
+		filtered, err := wordfreq.FilterResults(results, *files)
+		if err != nil {
+			slog.Error("invalid file glob", slog.Any("error", err))
+			return 1
+		}
+		results = filtered
+	}
+
+	grouped, err := wordfreq.ClusterDocuments(results, wordfreq.ClusterOptions{
+		Method:     method,
+		Clusters:   *clusters,
+		Neighbours: *neighbours,
+		Terms:      *terms,
+		Iterations: *iterations,
+		Workers:    runtime.GOMAXPROCS(0),
+	})
+	if err != nil {
+		slog.Error("failed to cluster results", slog.Any("error", err))
+		return 1
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(grouped)
+	} else {
+		err = wordfreq.WriteClusterTable(os.Stdout, grouped)
+	}
+
+	if err != nil {
+		slog.Error("failed to write clusters", slog.Any("error", err))
+		return 1
+	}
+
+	return 0
+}
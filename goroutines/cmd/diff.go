@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/DonAlexandro/go_advanced/pkg/wordfreq"
+)
+
+// runDiff compares two result files, e.g. the results of two nightly runs
+func runDiff(args []string) int {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	format := flags.String("format", "table", "Output format: table or json")
+	limit := flags.Int("n", 10, "Number of words listed per section (0 lists all)")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 2 {
+		slog.Error(fmt.Sprintf("usage: %s diff [-format table|json] [-n <words>] <before> <after>\n", os.Args[0]))
+		slog.Error(fmt.Sprintf("example: %s diff results/result_monday.json results/result_tuesday.md\n", os.Args[0]))
+		return 1
+	}
+
+	if *format != "table" && *format != "json" {
+		slog.Error("invalid diff format", slog.String("format", *format))
+		return 1
+	}
+
+	before, err := wordfreq.LoadResults(flags.Arg(0))
+	if err != nil {
+		slog.Error("failed to load results", slog.String("filename", flags.Arg(0)), slog.Any("error", err))
+		return 1
+	}
+
+	after, err := wordfreq.LoadResults(flags.Arg(1))
+	if err != nil {
+		slog.Error("failed to load results", slog.String("filename", flags.Arg(1)), slog.Any("error", err))
+		return 1
+	}
+
+	diff := wordfreq.Diff(before, after, *limit)
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(diff)
+	} else {
+		err = diff.WriteTable(os.Stdout)
+	}
+
+	if err != nil {
+		slog.Error("failed to write diff", slog.Any("error", err))
+		return 1
+	}
+
+	return 0
+}
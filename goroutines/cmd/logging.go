@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/DonAlexandro/go_advanced/pkg/wordfreq"
+	"github.com/mdobak/go-xerrors"
+	slogjson "github.com/veqryn/slog-json"
+)
+
+// defaultConfigPath is read when -config is not given; unlike a file given with -config, it may be missing
+const defaultConfigPath = "assets/config.toml"
+
+// defaultLogFiles is the number of rotated log files kept when max_files is not set
+const defaultLogFiles = 5
+
+// configureLogging sets the default logger from the [logging] section of the config file:
+//
+//	level     = "debug", "info", "warn" or "error" (debug adds per-file stage timings)
+//	format    = "json" (or "structured") or "text"
+//	output    = "stdout", "stderr" or a file path
+//	max_size  = size at which a log file is rotated, e.g. "10MB" (no rotation if unset)
+//	max_files = number of rotated log files kept
+//
+// Log lines written with a context carry its run id and file.
+// A missing file keeps the defaults unless it was given explicitly.
+// The returned function closes the log file, if any.
+func configureLogging(configPath string, explicit bool) (func() error, error) {
+	config, err := wordfreq.LoadConfig(configPath)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		config, err = wordfreq.Config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	logging := config["logging"]
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(logging.String("level", "info"))); err != nil {
+		return nil, xerrors.Newf("invalid log level: %w", err)
+	}
+
+	var out io.Writer
+	closeLog := func() error { return nil }
+	switch output := logging.String("output", "stdout"); output {
+	case "stdout":
+		out = os.Stdout
+	case "stderr":
+		out = os.Stderr
+	default:
+		var maxSize int64
+		if size := logging.String("max_size", ""); size != "" {
+			if maxSize, err = wordfreq.ParseByteSize(size); err != nil {
+				return nil, xerrors.Newf("invalid log max_size: %w", err)
+			}
+		}
+
+		file, err := wordfreq.OpenRotatingFile(output, maxSize, logging.Int("max_files", defaultLogFiles))
+		if err != nil {
+			return nil, err
+		}
+		out, closeLog = file, file.Close
+	}
+
+	var handler slog.Handler
+	switch format := strings.ToLower(logging.String("format", "json")); format {
+	case "json", "structured":
+		handler = slogjson.NewHandler(out, &slogjson.HandlerOptions{
+			AddSource:   false,
+			Level:       level,
+			ReplaceAttr: nil, // Same signature and behavior as stdlib JSONHandler
+		})
+	case "text":
+		handler = slog.NewTextHandler(out, &slog.HandlerOptions{Level: level})
+	default:
+		closeLog()
+		return nil, xerrors.Newf("invalid log format %q, expected json or text", format)
+	}
+
+	// Default global logger
+	slog.SetDefault(slog.New(wordfreq.NewContextHandler(handler)))
+	return closeLog, nil
+}
@@ -1,71 +1,118 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"log/slog"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
-
-	// "runtime/pprof"
-	"sync"
+	"strings"
 	"time"
 
-	internal "github.com/DonAlexandro/go_advanced/internal"
-	slogjson "github.com/veqryn/slog-json"
+	"github.com/DonAlexandro/go_advanced/pkg"
+	"github.com/DonAlexandro/go_advanced/pkg/wordfreq"
 )
 
-type Worker struct {
-	jobs          <-chan string
-	results       chan<- internal.FileWordFrequency
-	errChan       chan<- error
-	counters      *int
-	mu            *sync.Mutex
-	doneCond      *sync.Cond
-	activeWorkers *int
-}
-
-func (w Worker) work() {
-	for filePath := range w.jobs {
-		// Count word frequencies in the file
-		words, err := internal.CountWordFrequency(filePath, w.counters)
-
-		if err != nil {
-			w.errChan <- err
-			continue
-		}
-
-		// Create result using the struct
-		result := internal.FileWordFrequency{
-			FileName: filepath.Base(filePath),
-			Words:    words,
-		}
+// defaultJournalPath is the journal of -resume when -journal is not given
+const defaultJournalPath = "results/journal.jsonl"
 
-		w.results <- result
-	}
-
-	// Signal completion only after all channel operations are done
-	w.mu.Lock()
-	(*w.activeWorkers)--
-	w.doneCond.Broadcast()
-	w.mu.Unlock()
+// commands maps subcommand names to their entry points, which return the exit code
+var commands = map[string]func(args []string) int{
+	"cluster": runCluster,
+	"diff":    runDiff,
+	"merge":   runMerge,
+	"query":   runQuery,
+	"search":  runSearch,
 }
 
 func main() {
-	h := slogjson.NewHandler(os.Stdout, &slogjson.HandlerOptions{
-		AddSource:   false,
-		Level:       slog.LevelInfo,
-		ReplaceAttr: nil, // Same signature and behavior as stdlib JSONHandler
-	})
-	// Default global logger
-	slog.SetDefault(slog.New(h))
+	// Subcommands log as configured in the default config file
+	closeLog, err := configureLogging(defaultConfigPath, false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to configure logging:", err)
+		os.Exit(1)
+	}
+	// -config may replace the log file, so the deferred call closes whichever is current
+	defer func() { closeLog() }()
+
+	// Subcommands work on written results instead of analysing files.
+	// "analyze" names the default command explicitly, so a directory called like a
+	// subcommand can still be analysed, as can any path after "--".
+	if len(os.Args) > 1 {
+		if os.Args[1] == "analyze" {
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+		} else if command, ok := commands[os.Args[1]]; ok {
+			os.Exit(command(os.Args[2:]))
+		}
+	}
 
 	// Command line flags
-	workers := flag.Int("w", 4, "Number of workers to process files concurrently")
-	counters := flag.Int("c", 2, "Number of goroutines counting the words in files")
+	workers := flag.Int("w", wordfreq.DefaultWorkers, "Number of workers to process files concurrently")
+	counters := flag.Int("c", wordfreq.DefaultCounters, "Number of goroutines counting the words in files")
+	pipelineName := flag.String("p", "batch", "Preprocessing pipeline mode: stream, batch, fused or bytes")
+	inputName := flag.String("i", "read", "File input mode: read (os.ReadFile) or mmap")
+	mergeName := flag.String("m", "single", "Chunk merge mode: single (one locked map) or sharded")
+	extractName := flag.String("extract", "plain", "Text extraction: plain, auto (by extension, also analysing .html, .md and .json files), or html, markdown or json (forced for every file, also analysing files of that format)")
+	jsonFields := flag.String("json-fields", strings.Join(wordfreq.DefaultJSONFields, ","), "Comma-separated JSON string fields counted by the json extractor (key or dotted path)")
+	approxBudget := flag.String("a", "", "Approximate mode memory budget per sketch, e.g. 16MB (exact counting if empty)")
+	topK := flag.Int("k", 100, "Number of top words reported in approximate mode")
+	outputFormat := flag.String("output-format", "md", "Result file format: md, json or html (a self-contained report with charts)")
+	collocWindow := flag.Int("colloc-window", 0, "Count words co-occurring within this distance and report collocations (0 disables)")
+	collocMin := flag.Int("colloc-min", 3, "Minimum number of co-occurrences for a pair to be scored")
+	collocTop := flag.Int("colloc-top", 20, "Number of collocations reported per file and corpus-wide")
+	collocMemory := flag.String("colloc-memory", "64MB", "Memory cap of each co-occurrence table; rare pairs are pruned beyond it")
+	collocRank := flag.String("colloc-rank", "llr", "Collocation ranking: llr (log-likelihood) or pmi")
+	readability := flag.Bool("readability", false, "Also measure sentences, syllables, Flesch scores, type/token ratio and hapax legomena per file")
+	nearDup := flag.Float64("near-dup", 0, "Group files whose estimated Jaccard similarity of word shingles reaches this threshold, e.g. 0.8 (0 disables)")
+	nearDupShingle := flag.Int("near-dup-shingle", wordfreq.DefaultDuplicateOptions().Shingle, "Number of consecutive words per shingle for near-duplicate detection")
+	nearDupBands := flag.Int("near-dup-bands", wordfreq.DefaultDuplicateOptions().Bands, "Number of LSH bands of the MinHash signature")
+	nearDupRows := flag.Int("near-dup-rows", wordfreq.DefaultDuplicateOptions().Rows, "Number of MinHash values per LSH band")
+	representatives := flag.Bool("representatives", false, "Count only one representative file per near-duplicate cluster")
+	indexFile := flag.String("index", "", "Also build an inverted index of word positions and save it to this file for the search subcommand")
+	deterministic := flag.Bool("deterministic", false, "Order output by path and count, and write a run manifest for reproducibility")
+	tracePath := flag.String("trace", "", "Write tracing spans of the run, files, chunk counters and merges as JSON lines to this file, or to stdout")
+	splitSize := flag.String("split-size", "32MB", "Files from this size are split into parts counted by several workers at once (0 disables)")
+	journalPath := flag.String("journal", "", "Append every completed file result to this journal, so an interrupted run can be resumed, e.g. "+defaultJournalPath)
+	resume := flag.Bool("resume", false, "Continue the run recorded in the journal ("+defaultJournalPath+" unless -journal is given), skipping files completed with unchanged content")
+	metricsAddr := flag.String("metrics-addr", "", "Serve Prometheus metrics at http://<addr>/metrics during the run, e.g. :9090")
+	metricsLinger := flag.Bool("metrics-linger", false, "Keep serving metrics after the run until interrupted, so the final values can be scraped")
+	redact := flag.String("redact", "", "Redact these classes before counting: a comma-separated list of email, uuid, ipv6, ipv4, card and phone, or all")
+	redactMode := flag.String("redact-mode", "replace", "Redaction mode: replace (count matches as class tokens such as <EMAIL>) or drop")
+	var redactClasses []wordfreq.RedactionClass
+	flag.Func("redact-class", "Also redact a custom class written as name=regexp; may be repeated", func(definition string) error {
+		class, err := wordfreq.ParseRedactionClass(definition)
+		redactClasses = append(redactClasses, class)
+		return err
+	})
+	rulesPath := flag.String("rules", "", "Normalise words by this rules file (synonyms, length limits, numeric and hex filters, allowlist, minimum count), e.g. assets/rules.toml")
+	configPath := flag.String("config", defaultConfigPath, "Configuration file; its [logging] section sets the log level, format and output")
 
 	flag.Parse()
 
+	// A config given explicitly must exist, even if it is the default path
+	explicitConfig := false
+	flag.Visit(func(f *flag.Flag) {
+		explicitConfig = explicitConfig || f.Name == "config"
+	})
+
+	if explicitConfig {
+		closeLog()
+		if closeLog, err = configureLogging(*configPath, true); err != nil {
+			fmt.Fprintln(os.Stderr, "failed to configure logging:", err)
+			os.Exit(1)
+		}
+	}
+
 	// Setup profiling
 	currentTime := time.Now()
 	// profilesDir := "profiles"
@@ -93,13 +140,14 @@ func main() {
 	// Check if directory path is provided
 	if len(args) == 0 {
 		slog.Error("directory path is required")
-		slog.Error(fmt.Sprintf("usage: %s <directory_path> [-w <num_workers>]\n", os.Args[0]))
-		slog.Error(fmt.Sprintf("example: %s /path/to/files -w 8\n", os.Args[0]))
+		slog.Error(fmt.Sprintf("usage: %s [-w <num_workers>] <directory_or_archive>...\n", os.Args[0]))
+		slog.Error(fmt.Sprintf("example: %s -w 8 /path/to/files\n", os.Args[0]))
+		slog.Error(fmt.Sprintf("example: %s /path/to/patches /path/to/corpus.tar.gz\n", os.Args[0]))
+		slog.Error(fmt.Sprintf("example: %s analyze -w 8 merge (a directory named like a subcommand)\n", os.Args[0]))
+		slog.Error(fmt.Sprintf("subcommands: %s diff <before> <after>, %s merge <shard>..., %s query <result>..., %s search <query>, %s cluster <result>...\n", os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0]))
 		os.Exit(1)
 	}
 
-	directoryPath := args[0]
-
 	// Validate worker count
 	if *workers < 1 {
 		slog.Error(fmt.Sprintf("number of workers must be positive, got: %d", *workers))
@@ -112,117 +160,390 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Get all .txt files from the directory
-	txtFiles, err := internal.GetTxtFiles(directoryPath)
+	// Validate pipeline mode
+	pipeline, err := wordfreq.ParsePipelineMode(*pipelineName)
+	if err != nil {
+		slog.Error("invalid pipeline mode", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	// Validate input mode
+	input, err := wordfreq.ParseInputMode(*inputName)
+	if err != nil {
+		slog.Error("invalid input mode", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	// Validate merge mode
+	merge, err := wordfreq.ParseMergeMode(*mergeName)
+	if err != nil {
+		slog.Error("invalid merge mode", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	// Validate extract mode
+	extract, err := wordfreq.ParseExtractMode(*extractName)
 	if err != nil {
-		slog.Error("error reading directory", slog.Any("error", err))
+		slog.Error("invalid extract mode", slog.Any("error", err))
 		os.Exit(1)
 	}
 
-	jobsNum := len(txtFiles)
+	// Validate output format
+	if *outputFormat != "md" && *outputFormat != "json" && *outputFormat != "html" {
+		slog.Error("invalid output format", slog.String("format", *outputFormat))
+		os.Exit(1)
+	}
 
-	jobs := make(chan string, jobsNum)
-	results := make(chan internal.FileWordFrequency, jobsNum)
-	errChan := make(chan error, jobsNum)
+	// Validate approximate mode settings
+	var approximate *wordfreq.ApproximateOptions
+	if *approxBudget != "" {
+		budget, err := wordfreq.ParseByteSize(*approxBudget)
+		if err != nil || budget <= 0 || *topK < 1 {
+			slog.Error("invalid approximate mode settings", slog.String("budget", *approxBudget), slog.Int("top_k", *topK), slog.Any("error", err))
+			os.Exit(1)
+		}
 
-	// Setup graceful shutdown coordination with sync.Cond
-	var mu sync.Mutex
-	doneCond := sync.NewCond(&mu)
-	var activeWorkers int
+		approximate = &wordfreq.ApproximateOptions{MemoryBudget: budget, TopK: *topK}
+	}
 
-	var wg sync.WaitGroup
+	// Validate collocation mode settings
+	var collocations *wordfreq.CollocationOptions
+	if *collocWindow > 0 {
+		budget, budgetErr := wordfreq.ParseByteSize(*collocMemory)
+		rank, rankErr := wordfreq.ParseCollocationRank(*collocRank)
+		if err := errors.Join(budgetErr, rankErr); err != nil || budget <= 0 || *collocMin < 1 || *collocTop < 1 {
+			slog.Error("invalid collocation settings", slog.String("memory", *collocMemory), slog.Int("min", *collocMin), slog.Int("top", *collocTop), slog.Any("error", err))
+			os.Exit(1)
+		}
 
-	// Create and start the worker pool
-	for w := 1; w <= *workers; w++ {
-		// Increment active worker count before spawning
-		mu.Lock()
-		activeWorkers++
-		mu.Unlock()
+		collocations = &wordfreq.CollocationOptions{Window: *collocWindow, MinCount: *collocMin, TopN: *collocTop, MemoryBudget: budget, Rank: rank}
+	}
 
-		wg.Go(func() {
-			worker := Worker{
-				jobs:          jobs,
-				results:       results,
-				errChan:       errChan,
-				counters:      counters,
-				mu:            &mu,
-				doneCond:      doneCond,
-				activeWorkers: &activeWorkers,
-			}
+	// Validate near-duplicate detection settings
+	var duplicates *wordfreq.DuplicateOptions
+	if *nearDup > 0 {
+		if *nearDup > 1 || *nearDupShingle < 1 || *nearDupBands < 1 || *nearDupRows < 1 {
+			slog.Error("invalid near-duplicate settings", slog.Float64("threshold", *nearDup), slog.Int("shingle", *nearDupShingle), slog.Int("bands", *nearDupBands), slog.Int("rows", *nearDupRows))
+			os.Exit(1)
+		}
 
-			worker.work()
-		})
+		duplicates = &wordfreq.DuplicateOptions{Threshold: *nearDup, Shingle: *nearDupShingle, Bands: *nearDupBands, Rows: *nearDupRows, Representatives: *representatives}
+	} else if *representatives {
+		slog.Error("counting representatives needs near-duplicate detection (-near-dup)")
+		os.Exit(1)
 	}
 
-	// Allow all workers to be spawned before starting job distribution
-	// time.Sleep(10 * time.Millisecond)
+	// Validate redaction settings; custom classes are matched after the built-in ones
+	var redaction *wordfreq.RedactionOptions
+	if *redact != "" || len(redactClasses) > 0 {
+		classes, classesErr := wordfreq.ParseRedactionClasses(*redact)
+		mode, modeErr := wordfreq.ParseRedactMode(*redactMode)
+		if err := errors.Join(classesErr, modeErr); err != nil {
+			slog.Error("invalid redaction settings", slog.String("classes", *redact), slog.String("mode", *redactMode), slog.Any("error", err))
+			os.Exit(1)
+		}
 
-	// Capture goroutine profile while workers are spawned and waiting for jobs
-	// goroutineProfilePath := filepath.Join(profilesDir, fmt.Sprintf("goroutine_profile_%s.prof", currentTime.Format("2006-01-02_15-04-05")))
-	// goroutineProfileFile, err := os.Create(goroutineProfilePath)
-	// if err != nil {
-	// 	slog.Error("failed to create goroutine profile", slog.Any("error", err))
-	// } else {
-	// 	if err := pprof.Lookup("goroutine").WriteTo(goroutineProfileFile, 0); err != nil {
-	// 		slog.Error("failed to write goroutine profile", slog.Any("error", err))
-	// 	}
-	// 	goroutineProfileFile.Close()
-	// 	slog.Info("goroutine profile captured", slog.String("path", goroutineProfilePath))
-	// }
+		redaction = &wordfreq.RedactionOptions{Mode: mode, Classes: append(classes, redactClasses...)}
+	}
+
+	// The stopwords file in the working directory is optional
+	stopwords, err := pkg.LoadStopwordsFile("stopwords.txt")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Error("failed to load stopwords", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	// Normalisation rules are optional and only read when requested
+	var rules *wordfreq.TokenRules
+	if *rulesPath != "" {
+		if rules, err = wordfreq.LoadTokenRules(*rulesPath); err != nil {
+			slog.Error("failed to load token rules", slog.Any("error", err))
+			os.Exit(1)
+		}
+	}
+
+	// Huge files are shared by the workers instead of holding up the end of the run
+	split, err := wordfreq.ParseByteSize(*splitSize)
+	if err != nil {
+		slog.Error("invalid split size", slog.String("size", *splitSize), slog.Any("error", err))
+		os.Exit(1)
+	}
+	if split == 0 {
+		split = -1
+	}
+
+	options := wordfreq.Options{
+		Workers:       *workers,
+		Counters:      *counters,
+		Pipeline:      pipeline,
+		Input:         input,
+		Merge:         merge,
+		Extract:       extract,
+		JSONFields:    wordfreq.ParseJSONFields(*jsonFields),
+		Stopwords:     stopwords,
+		Approximate:   approximate,
+		Collocations:  collocations,
+		Duplicates:    duplicates,
+		Readability:   *readability,
+		Redaction:     redaction,
+		Rules:         rules,
+		Deterministic: *deterministic,
+		Index:         *indexFile != "",
+		SplitSize:     split,
+	}
+
+	// Stop handing out files on Ctrl+C, keeping the results gathered so far
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Lines logged with ctx, including those of the workers, carry the run id
+	ctx = wordfreq.WithRunID(ctx, wordfreq.NewRunID())
+
+	// Completed files are journaled as they finish, but only when asked for with -journal or -resume.
+	// Corpus-wide modes need every file, so they are not journaled.
+	if *resume && *journalPath == "" {
+		*journalPath = defaultJournalPath
+	}
+	if *journalPath != "" && options.Resumable() {
+		if err := os.MkdirAll(filepath.Dir(*journalPath), 0755); err != nil {
+			slog.ErrorContext(ctx, "failed to create journal directory", slog.Any("error", err))
+			os.Exit(1)
+		}
+
+		openJournal := wordfreq.CreateJournal
+		if *resume {
+			openJournal = wordfreq.ResumeJournal
+		}
+		journal, err := openJournal(*journalPath, options)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to open journal", slog.Any("error", err))
+			os.Exit(1)
+		}
+		defer journal.Close()
 
-	// Send all file paths to jobs channel
-	for _, filePath := range txtFiles {
-		jobs <- filePath
+		options.Journal = journal
+		if *resume {
+			slog.InfoContext(ctx, "resuming run", slog.String("journal", *journalPath), slog.Int("completed", journal.Len()))
+		}
+	} else if *resume {
+		slog.ErrorContext(ctx, "resuming needs a journal, which approximate, collocation, near-duplicate and index modes do not support")
+		os.Exit(1)
 	}
 
-	// Close the jobs to indicate no more filePaths will be provided after the loop
-	close(jobs)
+	// Metrics are served in the background. The address is bound before the run,
+	// so a port in use stops the run instead of leaving it without metrics.
+	if *metricsAddr != "" {
+		listener, err := net.Listen("tcp", *metricsAddr)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to listen for metrics", slog.String("addr", *metricsAddr), slog.Any("error", err))
+			os.Exit(1)
+		}
 
-	// Wait for all workers to be spawned and registered
-	wg.Wait()
+		options.Metrics = wordfreq.NewMetrics()
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", options.Metrics)
 
-	// Wait for all workers to complete their tasks using sync.Cond
-	mu.Lock()
-	for activeWorkers > 0 {
-		doneCond.Wait() // Releases mu, waits for Broadcast, reacquires mu
+		go func() {
+			if err := http.Serve(listener, mux); err != nil {
+				slog.ErrorContext(ctx, "failed to serve metrics", slog.String("addr", *metricsAddr), slog.Any("error", err))
+			}
+		}()
+	} else if *metricsLinger {
+		slog.ErrorContext(ctx, "-metrics-linger needs -metrics-addr")
+		os.Exit(1)
+	}
+
+	// Spans are exported as they end, so a trace file is complete even after Ctrl+C
+	if *tracePath != "" {
+		traceOut := io.Writer(os.Stdout)
+		if *tracePath != "stdout" {
+			traceFile, err := os.Create(*tracePath)
+			if err != nil {
+				slog.ErrorContext(ctx, "failed to create trace file", slog.Any("error", err))
+				os.Exit(1)
+			}
+			defer traceFile.Close()
+			traceOut = traceFile
+		}
+		ctx = wordfreq.WithTracer(ctx, wordfreq.NewTracer(wordfreq.NewJSONSpanExporter(traceOut)))
+	}
+
+	// Directories and archives become one file system, earlier arguments shadowing later ones
+	fsys, closeInputs, err := openInputs(args)
+	if err != nil {
+		slog.ErrorContext(ctx, "error opening input", slog.Any("error", err))
+		os.Exit(1)
 	}
-	mu.Unlock()
+	defer closeInputs()
 
-	// Close results and error channels after all workers finished
-	close(results)
-	close(errChan)
+	report, err := wordfreq.AnalyzeFS(ctx, fsys, options)
+	if report == nil {
+		slog.ErrorContext(ctx, "error reading directory", slog.Any("error", err))
+		os.Exit(1)
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "analysis interrupted, writing partial results", slog.Any("error", err))
+	}
 
 	// Create results directory if it doesn't exist
 	resultsDir := "results"
 	if err := os.MkdirAll(resultsDir, 0755); err != nil {
-		slog.Error("failed to create results directory", slog.Any("error", err))
+		slog.ErrorContext(ctx, "failed to create results directory", slog.Any("error", err))
 		os.Exit(1)
 	}
 
 	// Generate filename with current date
-	filename := filepath.Join(resultsDir, fmt.Sprintf("result_%s.md", currentTime.Format("2006-01-02_15-04-05")))
+	filename := filepath.Join(resultsDir, fmt.Sprintf("result_%s.%s", currentTime.Format("2006-01-02_15-04-05"), *outputFormat))
 
 	// Create the output file
 	file, err := os.Create(filename)
 	if err != nil {
-		slog.Error("failed to create output file", slog.Any("error", err))
+		slog.ErrorContext(ctx, "failed to create output file", slog.Any("error", err))
 		os.Exit(1)
 	}
 	defer file.Close()
 
-	// Collect and write results to file
-	for result := range results {
-		if _, err := file.WriteString(result.ToHumanReadable()); err != nil {
-			slog.Error("failed to write result to file", slog.Any("error", err))
+	// Hash the output while writing it, for the run manifest
+	resultHash := sha256.New()
+	out := io.MultiWriter(file, resultHash)
+
+	// Write results to file
+	if err := writeResults(out, *outputFormat, report.ResultFile(), report.Stats); err != nil {
+		slog.ErrorContext(ctx, "failed to write result to file", slog.Any("error", err))
+	}
+
+	// Record how the result can be reproduced next to it
+	if options.Deterministic {
+		manifest := wordfreq.NewManifest(options, report)
+		manifest.ResultHash = hex.EncodeToString(resultHash.Sum(nil))
+
+		manifestName := strings.TrimSuffix(filename, filepath.Ext(filename)) + ".manifest.json"
+		if err := writeManifest(manifestName, manifest); err != nil {
+			slog.ErrorContext(ctx, "failed to write run manifest", slog.Any("error", err))
+		} else {
+			slog.InfoContext(ctx, "run manifest written to file", slog.String("filename", manifestName), slog.String("config_hash", manifest.ConfigHash))
 		}
 	}
 
+	// Save the index for the search subcommand
+	if report.Index != nil {
+		if err := report.Index.Save(*indexFile); err != nil {
+			slog.ErrorContext(ctx, "failed to save index", slog.Any("error", err))
+		} else {
+			slog.InfoContext(ctx, "index written to file", slog.String("filename", *indexFile), slog.Int("files", len(report.Index.Files)), slog.Int("words", len(report.Index.Postings)))
+		}
+	}
+
+	// Summarise the near-duplicates found
+	for _, cluster := range report.Duplicates {
+		slog.InfoContext(ctx, "near-duplicate files", slog.String("representative", cluster.Representative), slog.Int("duplicates", len(cluster.Duplicates)))
+	}
+
+	// Summarise what was redacted, so a run over clean data is easy to tell apart
+	if options.Redaction != nil {
+		slog.InfoContext(ctx, "redactions", slog.String("mode", options.Redaction.Mode.String()), slog.String("counts", wordfreq.RedactionsToHumanReadable(report.Redactions)))
+	}
+
 	// Check for any errors
-	for err := range errChan {
+	for _, err := range report.Errors {
+		slog.ErrorContext(ctx, "error processing file", slog.Any("error", err))
+	}
+
+	slog.InfoContext(ctx, "results written to file", slog.String("filename", filename))
+	slog.InfoContext(ctx, "run stats", slog.Any("stats", report.Stats))
+
+	// Keep the final values available to the scraper
+	if *metricsLinger && ctx.Err() == nil {
+		slog.InfoContext(ctx, "serving metrics until interrupted", slog.String("addr", *metricsAddr))
+		<-ctx.Done()
+	}
+}
+
+// writeResults writes a result as markdown, as JSON or as an HTML report; stats may be nil
+func writeResults(out io.Writer, format string, result wordfreq.ResultFile, stats *wordfreq.RunStats) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	case "html":
+		return wordfreq.WriteHTMLReport(out, wordfreq.HTMLReport{Title: "Word frequency report", Generated: time.Now(), Result: result, Stats: stats})
+	}
+
+	for _, file := range result.Files {
+		if _, err := io.WriteString(out, file.ToHumanReadable()); err != nil {
+			return err
+		}
+	}
+
+	// Finish with the corpus-wide estimates of approximate mode, the counts of merged shards
+	// or the collocations
+	summary := wordfreq.FileWordFrequency{FileName: wordfreq.CorpusSectionName, Words: result.Aggregate, Collocations: result.Collocations}
+	if result.Corpus != nil {
+		summary.Words = result.Corpus.Words()
+		summary.Approximate = result.Corpus
+	}
+	if result.Corpus != nil || result.Aggregate != nil || result.Collocations != nil {
+		if _, err := io.WriteString(out, summary.ToHumanReadable()); err != nil {
+			return err
+		}
+	}
+
+	if result.Duplicates != nil {
+		if _, err := io.WriteString(out, wordfreq.DuplicatesToHumanReadable(result.Duplicates)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeManifest stores the run manifest as indented JSON
+func writeManifest(filename string, manifest wordfreq.Manifest) error {
+	encoded, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filename, append(encoded, '\n'), 0644)
+}
+
+// openInputs opens every directory, file or archive argument and stacks them into one file system
+// The returned function closes all opened archives
+func openInputs(paths []string) (fs.FS, func(), error) {
+	var layers []fs.FS
+	var closers []io.Closer
+
+	closeAll := func() {
+		for _, closer := range closers {
+			closer.Close()
+		}
+	}
+
+	for _, path := range paths {
+		if !wordfreq.IsArchive(path) {
+			layer, err := wordfreq.OpenPath(path)
+			if err != nil {
+				closeAll()
+				return nil, nil, err
+			}
+			layers = append(layers, layer)
+			continue
+		}
+
+		archive, closer, err := wordfreq.OpenArchive(path)
 		if err != nil {
-			slog.Error("error processing file", slog.Any("error", err))
+			closeAll()
+			return nil, nil, err
 		}
+
+		layers = append(layers, archive)
+		closers = append(closers, closer)
+	}
+
+	if len(layers) == 1 {
+		return layers[0], closeAll, nil
 	}
 
-	slog.Info("results written to file", slog.String("filename", filename))
+	return wordfreq.Overlay(layers...), closeAll, nil
 }
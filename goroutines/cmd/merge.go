@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/DonAlexandro/go_advanced/pkg/wordfreq"
+)
+
+// runMerge combines the result files of runs over separate shards of a corpus into one result
+func runMerge(args []string) int {
+	flags := flag.NewFlagSet("merge", flag.ContinueOnError)
+	output := flags.String("o", "", "Merged result file; .json is written as JSON, .html as a report, anything else as markdown (default results/merged_<time>.md)")
+	conflictName := flags.String("conflict", "error", "Handling of files found in several shards: error, first or sum")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		slog.Error(fmt.Sprintf("usage: %s merge [-o <output>] [-conflict error|first|sum] <shard_result>...\n", os.Args[0]))
+		slog.Error(fmt.Sprintf("example: %s merge -o results/all.json node1/result.json node2/result.json\n", os.Args[0]))
+		return 1
+	}
+
+	conflict, err := wordfreq.ParseConflictMode(*conflictName)
+	if err != nil {
+		slog.Error("invalid conflict mode", slog.Any("error", err))
+		return 1
+	}
+
+	merged, err := wordfreq.MergeResultFiles(flags.Args(), conflict)
+	for _, c := range merged.Conflicts {
+		slog.Warn("file appears in more than one shard", slog.String("file", c.File), slog.Any("shards", c.Shards))
+	}
+	if err != nil {
+		slog.Error("failed to merge results", slog.Any("error", err))
+		return 1
+	}
+
+	filename := *output
+	if filename == "" {
+		if err := os.MkdirAll("results", 0755); err != nil {
+			slog.Error("failed to create results directory", slog.Any("error", err))
+			return 1
+		}
+		filename = filepath.Join("results", fmt.Sprintf("merged_%s.md", time.Now().Format("2006-01-02_15-04-05")))
+	}
+
+	format := "md"
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		format = "json"
+	case ".html":
+		format = "html"
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		slog.Error("failed to create output file", slog.Any("error", err))
+		return 1
+	}
+	defer file.Close()
+
+	if err := writeResults(file, format, wordfreq.MergedResultFile(merged), nil); err != nil {
+		slog.Error("failed to write merged result", slog.Any("error", err))
+		return 1
+	}
+
+	slog.Info("merged results written to file",
+		slog.String("filename", filename),
+		slog.Int("shards", flags.NArg()),
+		slog.Int("files", len(merged.Files)),
+		slog.Int("conflicts", len(merged.Conflicts)),
+	)
+	return 0
+}
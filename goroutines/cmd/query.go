@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/DonAlexandro/go_advanced/pkg/wordfreq"
+)
+
+// runQuery answers questions such as "which files mention timeout the most?" over stored results
+func runQuery(args []string) int {
+	flags := flag.NewFlagSet("query", flag.ContinueOnError)
+	word := flags.String("word", "", "Look up one word across files")
+	perFile := flags.Bool("per-file", false, "List the top words of every file instead of the corpus-wide top words")
+	top := flags.Int("n", 10, "Number of rows (per file with -per-file); 0 lists all")
+	minCount := flags.Int("min", 0, "Drop words counted fewer times")
+	files := flags.String("files", "", "Only use files matching this glob, e.g. 'logs/*.txt' or '*error*'")
+	sortName := flags.String("sort", "", "Row order: count, word or file (default count, or file with -per-file)")
+	reverse := flags.Bool("reverse", false, "Reverse the row order")
+	format := flags.String("format", "table", "Output format: table or json")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		slog.Error(fmt.Sprintf("usage: %s query [-word <word>] [-per-file] [-n <rows>] [-min <count>] [-files <glob>] [-sort count|word|file] [-reverse] [-format table|json] <result>...\n", os.Args[0]))
+		slog.Error(fmt.Sprintf("example: %s query -word timeout -n 5 results/result_2025-12-07_23-32-40.json\n", os.Args[0]))
+		return 1
+	}
+
+	if *format != "table" && *format != "json" {
+		slog.Error("invalid query format", slog.String("format", *format))
+		return 1
+	}
+
+	sort, err := wordfreq.ParseQuerySort(*sortName)
+	if err != nil {
+		slog.Error("invalid query sort", slog.Any("error", err))
+		return 1
+	}
+
+	// Several result files are queried as one result set
+	var results []wordfreq.FileWordFrequency
+	for _, filename := range flags.Args() {
+		loaded, err := wordfreq.LoadResults(filename)
+		if err != nil {
+			slog.Error("failed to load results", slog.String("filename", filename), slog.Any("error", err))
+			return 1
+		}
+		results = append(results, loaded...)
+	}
+
+	rows, err := wordfreq.RunQuery(results, wordfreq.Query{
+		Word:     *word,
+		PerFile:  *perFile,
+		Top:      *top,
+		MinCount: *minCount,
+		FileGlob: *files,
+		Sort:     sort,
+		Reverse:  *reverse,
+	})
+	if err != nil {
+		slog.Error("invalid query", slog.Any("error", err))
+		return 1
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(rows)
+	} else {
+		err = wordfreq.WriteQueryTable(os.Stdout, rows)
+	}
+
+	if err != nil {
+		slog.Error("failed to write query result", slog.Any("error", err))
+		return 1
+	}
+
+	return 0
+}
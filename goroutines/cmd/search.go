@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/DonAlexandro/go_advanced/pkg/wordfreq"
+)
+
+// runSearch finds where words occur using an index built with -index, showing keyword-in-context snippets
+func runSearch(args []string) int {
+	flags := flag.NewFlagSet("search", flag.ContinueOnError)
+	indexFile := flags.String("index", "results/index.gob.gz", "Index file written by a run with -index")
+	context := flags.Int("context", 30, "Characters of context shown on each side of a match")
+	limit := flags.Int("n", 50, "Maximum number of hits (0 shows all)")
+	format := flags.String("format", "table", "Output format: table or json")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		slog.Error(fmt.Sprintf("usage: %s search [-index <file>] [-context <chars>] [-n <hits>] [-format table|json] <query>\n", os.Args[0]))
+		slog.Error(fmt.Sprintf(`example: %s search '"worker pool" OR goroutine AND timeout'`+"\n", os.Args[0]))
+		return 1
+	}
+
+	if *format != "table" && *format != "json" {
+		slog.Error("invalid search format", slog.String("format", *format))
+		return 1
+	}
+
+	index, err := wordfreq.LoadIndex(*indexFile)
+	if err != nil {
+		slog.Error("failed to load index", slog.Any("error", err))
+		return 1
+	}
+
+	// Unquoted arguments form one query, so the shell quoting stays simple
+	hits, err := wordfreq.Search(index, strings.Join(flags.Args(), " "), *context, *limit)
+	if err != nil {
+		slog.Error("invalid search query", slog.Any("error", err))
+		return 1
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(hits)
+	} else {
+		err = wordfreq.WriteKWIC(os.Stdout, hits)
+	}
+
+	if err != nil {
+		slog.Error("failed to write search hits", slog.Any("error", err))
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,307 @@
+package internal
+
+import (
+	"cmp"
+	"io/fs"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/mdobak/go-xerrors"
+)
+
+// ApproximateOptions configures the approximate counting mode
+type ApproximateOptions struct {
+	// MemoryBudget is the size in bytes of one sketch.
+	// Every counting goroutine fills its own sketch, plus one sketch per file and one for the corpus.
+	MemoryBudget int64 `json:"memory_budget"`
+	// TopK is the number of most frequent words reported
+	TopK int `json:"top_k"`
+}
+
+const (
+	// countMinDepth gives a failure probability of e^-5 (below 1%) per estimate
+	countMinDepth = 5
+	// hyperLogLogShare is the fraction (1/n) of the budget given to the HyperLogLog registers
+	hyperLogLogShare = 64
+	// spaceSavingShare is the fraction (1/n) of the budget given to the heavy hitters summary
+	spaceSavingShare = 4
+	// spaceSavingEntryBytes is a rough size of one monitored word (entry, key and map slot)
+	spaceSavingEntryBytes = 128
+)
+
+// ApproximateWord is a top-K word with both bounds of its true count
+type ApproximateWord struct {
+	Word string `json:"word"`
+	// Count is the estimate; the true count is never higher
+	Count uint64 `json:"count"`
+	// MinCount is the guaranteed lower bound of the true count
+	MinCount uint64 `json:"min_count"`
+}
+
+// ApproximateStats reports approximate results together with their error bounds
+type ApproximateStats struct {
+	TotalWords uint64 `json:"total_words"`
+	// DistinctWords is estimated by HyperLogLog with relative DistinctStdError
+	DistinctWords    uint64  `json:"distinct_words"`
+	DistinctStdError float64 `json:"distinct_std_error"`
+	// CountErrorBound is the most a Count-Min estimate exceeds the true count,
+	// which holds with probability CountConfidence
+	CountErrorBound uint64  `json:"count_error_bound"`
+	CountConfidence float64 `json:"count_confidence"`
+	// MemoryBytes is the memory used by the sketches
+	MemoryBytes int64             `json:"memory_bytes"`
+	TopK        []ApproximateWord `json:"top_k"`
+}
+
+// ApproximateCounter estimates word counts, heavy hitters and the number of
+// distinct words in a fixed memory budget, whatever the size of the vocabulary
+type ApproximateCounter struct {
+	mu       sync.Mutex
+	options  ApproximateOptions
+	sketch   *countMinSketch
+	heavy    *spaceSaving
+	distinct *hyperLogLog
+	total    uint64
+}
+
+// Validate checks that the budget holds the top-K words. They are monitored by the heavy hitters
+// summary, which only gets its share of the budget, so the Count-Min sketch keeps the rest.
+func (o ApproximateOptions) Validate() error {
+	if o.MemoryBudget <= 0 || o.TopK < 1 {
+		return xerrors.Newf("approximate mode needs a positive memory budget and top-K, got: %d bytes, top %d", o.MemoryBudget, o.TopK)
+	}
+	if needed := int64(o.TopK) * spaceSavingEntryBytes * spaceSavingShare; needed > o.MemoryBudget {
+		return xerrors.Newf("approximate mode needs a memory budget of at least %d bytes for the top %d words, got: %d bytes", needed, o.TopK, o.MemoryBudget)
+	}
+	return nil
+}
+
+// NewApproximateCounter splits the memory budget between the three sketches.
+// The options must be valid, or the sketches may take more than the budget.
+func NewApproximateCounter(options ApproximateOptions) *ApproximateCounter {
+	budget := options.MemoryBudget
+	options.TopK = max(options.TopK, 1)
+
+	distinct := newHyperLogLog(budget / hyperLogLogShare)
+
+	// Monitoring more words than reported makes the top-K and its lower bounds more reliable
+	capacity := max(int(budget/spaceSavingShare/spaceSavingEntryBytes), options.TopK)
+	heavy := newSpaceSaving(capacity)
+
+	remaining := budget - distinct.Bytes() - int64(capacity)*spaceSavingEntryBytes
+
+	return &ApproximateCounter{
+		options:  options,
+		sketch:   newCountMinSketch(remaining, countMinDepth),
+		heavy:    heavy,
+		distinct: distinct,
+	}
+}
+
+// add counts one word; it is not synchronised and must only be used by one goroutine
+func (c *ApproximateCounter) add(word []byte) {
+	hash := hashWord(word)
+	c.sketch.Add(hash, 1)
+	c.distinct.Add(hash)
+	c.heavy.Add(word)
+	c.total++
+}
+
+// addTokens counts words that are not part of the text, such as redaction class tokens
+func (c *ApproximateCounter) addTokens(tokens Frequency) {
+	for word, count := range tokens {
+		for range count {
+			c.add([]byte(word))
+		}
+	}
+}
+
+// Merge adds the counts of a counter created with the same options
+// Safe for concurrent use, so workers can merge files into a shared corpus counter
+func (c *ApproximateCounter) Merge(other *ApproximateCounter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sketch.Merge(other.sketch)
+	c.distinct.Merge(other.distinct)
+	c.heavy.Merge(other.heavy)
+	c.total += other.total
+}
+
+// Stats returns the top-K words and the error bounds of every estimate
+func (c *ApproximateCounter) Stats() *ApproximateStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := &ApproximateStats{
+		TotalWords:       c.total,
+		DistinctWords:    c.distinct.Estimate(),
+		DistinctStdError: c.distinct.StandardError(),
+		CountErrorBound:  uint64(math.Ceil(c.sketch.Epsilon() * float64(c.total))),
+		CountConfidence:  1 - c.sketch.Delta(),
+		MemoryBytes:      c.sketch.Bytes() + c.distinct.Bytes() + int64(c.heavy.capacity)*spaceSavingEntryBytes,
+	}
+
+	// Both Space-Saving and Count-Min only overcount, so the smaller estimate is tighter
+	for _, entry := range c.heavy.Entries() {
+		estimate := min(entry.count, c.sketch.Estimate(hashWord([]byte(entry.word))))
+		stats.TopK = append(stats.TopK, ApproximateWord{
+			Word:     entry.word,
+			Count:    estimate,
+			MinCount: entry.count - entry.overestimation,
+		})
+	}
+
+	sortApproximateWords(stats.TopK)
+	stats.TopK = stats.TopK[:min(len(stats.TopK), c.options.TopK)]
+
+	return stats
+}
+
+// Words returns the estimated top-K words in the shape of exact results
+func (s *ApproximateStats) Words() []Word {
+	words := make([]Word, 0, len(s.TopK))
+	for _, w := range s.TopK {
+		words = append(words, Word{Word: w.Word, Count: int(w.Count)})
+	}
+	return words
+}
+
+// sortApproximateWords orders words by estimate (descending), then alphabetically
+func sortApproximateWords(words []ApproximateWord) {
+	slices.SortFunc(words, func(a, b ApproximateWord) int {
+		if a.Count != b.Count {
+			return cmp.Compare(b.Count, a.Count)
+		}
+		return strings.Compare(a.Word, b.Word)
+	})
+}
+
+// CountWordFrequencyApproximate counts a file into an ApproximateCounter.
+// Counter goroutines fill their own sketches over disjoint regions, which are merged at the end.
+func CountWordFrequencyApproximate(fsys fs.FS, filePath string, opts CountOptions, approx ApproximateOptions) (*ApproximateCounter, error) {
+	timings := newStageTimings(opts)
+
+	input, err := readInput(fsys, filePath, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := input.release(); err != nil {
+			slog.WarnContext(opts.logContext(), "failed to release file input", slog.String("file", filePath), slog.Any("error", err))
+		}
+	}()
+	timings.mark("read")
+
+	recordContent(filePath, input.data, opts)
+	timings.mark("record")
+
+	opts.cooccurrences = opts.Collocations.newFile()
+	opts.shingles = opts.Duplicates.newFile()
+	opts.timings = timings
+	counter := countApproximateInContent(input.data, input.writable, opts, approx)
+	opts.Collocations.addFile(filePath, opts.cooccurrences)
+	opts.Duplicates.addFile(filePath, opts.shingles)
+	counter.addTokens(opts.Redactor.tokens(filePath))
+	timings.log()
+
+	return counter, nil
+}
+
+// CountWordFrequencyApproximateInBytes counts content that is already in memory into an ApproximateCounter
+// Content may be lowercased in place, and the class tokens it was redacted with under the empty path are added.
+// Its collocations are recorded under the empty path too.
+func CountWordFrequencyApproximateInBytes(content []byte, opts CountOptions, approx ApproximateOptions) *ApproximateCounter {
+	opts.cooccurrences = opts.Collocations.newFile()
+	counter := countApproximateInContent(content, true, opts, approx)
+	opts.Collocations.addFile("", opts.cooccurrences)
+	counter.addTokens(opts.Redactor.tokens(""))
+	return counter
+}
+
+// countApproximateInContent fills an ApproximateCounter from loaded content
+// opts.timings, if not nil, gets the count, tokenise and merge stages
+func countApproximateInContent(content []byte, writable bool, opts CountOptions, approx ApproximateOptions) *ApproximateCounter {
+	timings := opts.timings
+	counter := NewApproximateCounter(approx)
+
+	// fill tokenises one region into a counter, normalising words and skipping stopwords
+	fill := func(region []byte, target *ApproximateCounter) {
+		var hits tokenRuleHits
+		cooccurrences := opts.cooccurrences.chunk()
+		shingles := opts.shingles.chunk()
+		clock := timings.clock("tokenise")
+		clock.run()
+		tokenizer := newByteTokenizer(writable)
+		tokenizer.Each(region, func(word []byte) {
+			word, keep := opts.Rules.applyBytes(word, &hits)
+			if keep && !opts.Stopwords.ContainsBytes(word) {
+				target.add(word)
+				cooccurrences.addBytes(word)
+				shingles.addBytes(word)
+			}
+		})
+		clock.pause()
+		clock.stop()
+		opts.Stats.addTokenRuleHits(&hits)
+	}
+
+	// If buffer is too small or we only have 1 counter, process sequentially
+	if len(content) < 100 || opts.Counters <= 1 {
+		_, span := StartSpan(opts.Context, "count chunk", slog.Int("chunk.id", 0), slog.Int("chunk.bytes", len(content)))
+		fill(content, counter)
+		span.End(nil)
+		timings.markCounted()
+		return counter
+	}
+
+	regions := splitBytesAtWordBoundaries(content, opts.Counters)
+	regionCounters := make([]*ApproximateCounter, len(regions))
+
+	var wg sync.WaitGroup
+
+	// Fan-Out: one sketch per region
+	for i, region := range regions {
+		wg.Go(func() {
+			_, span := StartSpan(opts.Context, "count chunk", slog.Int("chunk.id", i), slog.Int("chunk.bytes", len(region)))
+			regionCounters[i] = NewApproximateCounter(approx)
+			fill(region, regionCounters[i])
+			span.End(nil)
+		})
+	}
+
+	wg.Wait()
+	timings.markCounted()
+
+	// Fan-In: merge in region order - heavy hitter merges depend on the order,
+	// so a fixed order keeps results reproducible
+	_, span := StartSpan(opts.Context, "merge", slog.String("merge.mode", "sketch"), slog.Int("chunks", len(regionCounters)))
+	for _, regionCounter := range regionCounters {
+		counter.Merge(regionCounter)
+	}
+	span.End(nil)
+	timings.mark("merge")
+
+	return counter
+}
+
+// hashWord hashes a word with FNV-1a followed by a splitmix64 finaliser.
+// The hash is deterministic, so sketches built by different goroutines can be merged.
+func hashWord(word []byte) uint64 {
+	hash := uint64(14695981039346656037)
+	for _, b := range word {
+		hash ^= uint64(b)
+		hash *= 1099511628211
+	}
+
+	hash ^= hash >> 30
+	hash *= 0xbf58476d1ce4e5b9
+	hash ^= hash >> 27
+	hash *= 0x94d049bb133111eb
+	hash ^= hash >> 31
+
+	return hash
+}
@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"math"
+	"testing"
+)
+
+// TestApproximateCountWithinBounds compares approximate results with exact counts
+func TestApproximateCountWithinBounds(t *testing.T) {
+	words, err := CountWordFrequency(assetsFS, "large.txt", CountOptions{Counters: 1, Pipeline: PipelineBytes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exact := wordsToFrequency(words)
+
+	counter, err := CountWordFrequencyApproximate(assetsFS, "large.txt", CountOptions{Counters: 3}, ApproximateOptions{MemoryBudget: 256 << 10, TopK: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := counter.Stats()
+
+	for _, w := range stats.TopK {
+		count := uint64(exact[w.Word])
+		if count < w.MinCount || count > w.Count || w.Count > count+stats.CountErrorBound {
+			t.Errorf("%q: exact count %d outside [%d, %d] (error bound %d)", w.Word, count, w.MinCount, w.Count, stats.CountErrorBound)
+		}
+	}
+
+	// Three standard errors cover the estimate with overwhelming probability
+	relativeError := math.Abs(float64(stats.DistinctWords)-float64(len(exact))) / float64(len(exact))
+	if relativeError > 3*stats.DistinctStdError {
+		t.Errorf("distinct words: estimated %d, exact %d", stats.DistinctWords, len(exact))
+	}
+}
+
+// TestApproximateOptionsValidate checks that a top-K the budget cannot hold is refused
+func TestApproximateOptionsValidate(t *testing.T) {
+	if err := (ApproximateOptions{MemoryBudget: 256 << 10, TopK: 20}).Validate(); err != nil {
+		t.Errorf("got error %v for a budget that fits", err)
+	}
+
+	// 1000 monitored words take 128KB, more than the heavy hitters' quarter of 256KB
+	options := ApproximateOptions{MemoryBudget: 256 << 10, TopK: 1000}
+	if err := options.Validate(); err == nil {
+		t.Errorf("got no error for a top-K beyond the budget")
+	}
+}
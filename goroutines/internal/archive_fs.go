@@ -0,0 +1,255 @@
+package internal
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mdobak/go-xerrors"
+)
+
+// IsArchive reports whether name has an archive extension supported by OpenArchive
+func IsArchive(name string) bool {
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenArchive opens a .zip, .tar, .tar.gz or .tgz archive as a read-only fs.FS.
+// Zip and plain tar archives are read lazily: a tar archive is indexed once and
+// its files are read from disk when opened. A compressed tar stream cannot be
+// read at an offset, so all its regular files are decompressed into memory up
+// front and the archive must fit into memory. The closer must be called when done.
+func OpenArchive(archivePath string) (fs.FS, io.Closer, error) {
+	lower := strings.ToLower(archivePath)
+
+	if strings.HasSuffix(lower, ".zip") {
+		reader, err := zip.OpenReader(archivePath)
+		if err != nil {
+			return nil, nil, xerrors.Newf("failed to open zip archive %q: %w", archivePath, err)
+		}
+		return reader, reader, nil
+	}
+
+	if !IsArchive(lower) {
+		return nil, nil, xerrors.Newf("unsupported archive type: %s", archivePath)
+	}
+
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, nil, xerrors.Newf("failed to open tar archive %q: %w", archivePath, err)
+	}
+
+	if !strings.HasSuffix(lower, ".gz") && !strings.HasSuffix(lower, ".tgz") {
+		// The file stays open, the files of the archive are read from it
+		fsys, err := indexTarFS(file)
+		if err != nil {
+			file.Close()
+			return nil, nil, xerrors.Newf("failed to read tar archive %q: %w", archivePath, err)
+		}
+		return fsys, fsys, nil
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, nil, xerrors.Newf("failed to decompress tar archive %q: %w", archivePath, err)
+	}
+	defer gzipReader.Close()
+
+	fsys, err := loadTarFS(gzipReader)
+	if err != nil {
+		return nil, nil, xerrors.Newf("failed to read tar archive %q: %w", archivePath, err)
+	}
+
+	return fsys, fsys, nil
+}
+
+// tarFS is a read-only fs.FS over the regular files of a tar archive
+type tarFS struct {
+	files map[string]*tarFile
+	// dirs maps every directory, explicit or implied by a file path, to its entries
+	dirs map[string][]fs.DirEntry
+	// archive is the uncompressed archive the files are read from, or nil if they were
+	// loaded into memory
+	archive *os.File
+}
+
+// tarFile is a regular file of a tar archive: either loaded into data, or found at
+// offset in the archive
+type tarFile struct {
+	info   fs.FileInfo
+	data   []byte
+	offset int64
+}
+
+// newTarFS creates an empty tarFS with just the root directory
+func newTarFS() *tarFS {
+	return &tarFS{
+		files: make(map[string]*tarFile),
+		dirs:  map[string][]fs.DirEntry{".": nil},
+	}
+}
+
+// loadTarFS reads every regular file of a tar stream into memory
+func loadTarFS(r io.Reader) (*tarFS, error) {
+	fsys := newTarFS()
+	err := fsys.scan(tar.NewReader(r), func(reader *tar.Reader, file *tarFile) error {
+		var err error
+		file.data, err = io.ReadAll(reader)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fsys, nil
+}
+
+// indexTarFS records where every regular file of an uncompressed tar archive starts.
+// The tar reader seeks over the file contents, so indexing reads little more than the headers.
+func indexTarFS(archive *os.File) (*tarFS, error) {
+	fsys := newTarFS()
+	fsys.archive = archive
+	err := fsys.scan(tar.NewReader(archive), func(_ *tar.Reader, file *tarFile) error {
+		// Next has just read the header, so the archive is positioned at the file contents
+		var err error
+		file.offset, err = archive.Seek(0, io.SeekCurrent)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fsys, nil
+}
+
+// scan adds every regular file of reader, letting add load or locate its contents
+func (t *tarFS) scan(reader *tar.Reader, add func(*tar.Reader, *tarFile) error) error {
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		name := path.Clean(strings.TrimPrefix(header.Name, "/"))
+		if header.Typeflag != tar.TypeReg || !fs.ValidPath(name) {
+			continue
+		}
+
+		file := &tarFile{info: header.FileInfo()}
+		if err := add(reader, file); err != nil {
+			return err
+		}
+
+		// A name may occur more than once, e.g. in an appended archive; like tar extraction,
+		// the last entry wins and the file is listed once
+		_, replaced := t.files[name]
+		t.files[name] = file
+		if replaced {
+			t.replaceEntry(name, fs.FileInfoToDirEntry(file.info))
+		} else {
+			t.addEntry(name, fs.FileInfoToDirEntry(file.info))
+		}
+	}
+
+	// Entries are sorted by name, as fs.ReadDirFS requires
+	for dir := range t.dirs {
+		slices.SortFunc(t.dirs[dir], func(a, b fs.DirEntry) int {
+			return strings.Compare(a.Name(), b.Name())
+		})
+	}
+
+	return nil
+}
+
+// addEntry adds name to its parent directory, creating missing parents on the way
+func (t *tarFS) addEntry(name string, entry fs.DirEntry) {
+	parent := path.Dir(name)
+
+	if _, exists := t.dirs[parent]; !exists {
+		t.dirs[parent] = nil
+		t.addEntry(parent, fs.FileInfoToDirEntry(tarDirInfo{name: path.Base(parent)}))
+	}
+
+	t.dirs[parent] = append(t.dirs[parent], entry)
+}
+
+// replaceEntry replaces the entry of name in its parent directory
+func (t *tarFS) replaceEntry(name string, entry fs.DirEntry) {
+	entries := t.dirs[path.Dir(name)]
+	index := slices.IndexFunc(entries, func(e fs.DirEntry) bool { return e.Name() == entry.Name() })
+	entries[index] = entry
+}
+
+// Open implements fs.FS
+func (t *tarFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if file, ok := t.files[name]; ok {
+		if t.archive == nil {
+			return &openTarFile{SectionReader: io.NewSectionReader(bytes.NewReader(file.data), 0, int64(len(file.data))), info: file.info}, nil
+		}
+		return &openTarFile{SectionReader: io.NewSectionReader(t.archive, file.offset, file.info.Size()), info: file.info}, nil
+	}
+
+	if entries, ok := t.dirs[name]; ok {
+		return &dirFile{name: name, info: tarDirInfo{name: path.Base(name)}, entries: slices.Clone(entries)}, nil
+	}
+
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// Close closes the archive the files are read from, if any
+func (t *tarFS) Close() error {
+	if t.archive == nil {
+		return nil
+	}
+	return t.archive.Close()
+}
+
+// ReadDir implements fs.ReadDirFS, which is all fs.WalkDir needs for directories
+func (t *tarFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, ok := t.dirs[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	return slices.Clone(entries), nil
+}
+
+// openTarFile is an open regular file of a tarFS
+type openTarFile struct {
+	*io.SectionReader
+	info fs.FileInfo
+}
+
+func (f *openTarFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *openTarFile) Close() error               { return nil }
+
+// tarDirInfo describes a directory of a tarFS
+type tarDirInfo struct {
+	name string
+}
+
+func (d tarDirInfo) Name() string       { return d.name }
+func (d tarDirInfo) Size() int64        { return 0 }
+func (d tarDirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0555 }
+func (d tarDirInfo) ModTime() time.Time { return time.Time{} }
+func (d tarDirInfo) IsDir() bool        { return true }
+func (d tarDirInfo) Sys() any           { return nil }
@@ -0,0 +1,561 @@
+package internal
+
+import (
+	"cmp"
+	"container/heap"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/mdobak/go-xerrors"
+)
+
+// ClusterMethod selects the clustering algorithm
+type ClusterMethod int
+
+const (
+	// ClusterAgglomerative repeatedly joins the two clusters with the highest average similarity
+	ClusterAgglomerative ClusterMethod = iota
+	// ClusterKMeans runs spherical k-means over the TF-IDF vectors
+	ClusterKMeans
+)
+
+// String returns the command line name of the method
+func (m ClusterMethod) String() string {
+	if m == ClusterKMeans {
+		return "kmeans"
+	}
+	return "agglomerative"
+}
+
+// MarshalText encodes the method by name in JSON output
+func (m ClusterMethod) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// ParseClusterMethod converts a command line name into a ClusterMethod
+func ParseClusterMethod(name string) (ClusterMethod, error) {
+	switch name {
+	case "agglomerative":
+		return ClusterAgglomerative, nil
+	case "kmeans":
+		return ClusterKMeans, nil
+	}
+	return 0, xerrors.Newf("unknown cluster method %q (expected agglomerative or kmeans)", name)
+}
+
+// ClusterOptions configures document clustering
+type ClusterOptions struct {
+	Method ClusterMethod
+	// Clusters is the number of clusters wanted. Agglomerative clustering may return
+	// more when groups of files share no words with each other.
+	Clusters int
+	// Neighbours bounds the similarities kept per file; agglomerative clustering only
+	// sees these, so memory stays linear in the number of files. 0 keeps all.
+	Neighbours int
+	// Terms is the number of characteristic terms reported per cluster
+	Terms int
+	// Iterations caps the rounds of k-means
+	Iterations int
+	// Workers is the number of goroutines computing similarities
+	Workers int
+}
+
+// ClusterTerm is a word characterising a cluster with its mean TF-IDF weight
+type ClusterTerm struct {
+	Word   string  `json:"word"`
+	Weight float64 `json:"weight"`
+}
+
+// DocumentCluster is a group of similar files
+type DocumentCluster struct {
+	Files []string      `json:"files"`
+	Terms []ClusterTerm `json:"terms"`
+	// Cohesion is the mean cosine similarity of the files to the cluster centroid
+	Cohesion float64 `json:"cohesion"`
+}
+
+// SimilarFile is a neighbour of a file with their cosine similarity
+type SimilarFile struct {
+	File       string  `json:"file"`
+	Similarity float64 `json:"similarity"`
+}
+
+// FileNeighbours lists the files most similar to one file
+type FileNeighbours struct {
+	File    string        `json:"file"`
+	Similar []SimilarFile `json:"similar"`
+}
+
+// DocumentClusters is the result of clustering a result set
+type DocumentClusters struct {
+	Method ClusterMethod `json:"method"`
+	// Clusters are ordered by size, then by their first file
+	Clusters   []DocumentCluster `json:"clusters"`
+	Neighbours []FileNeighbours  `json:"neighbours"`
+	// Empty lists the files without any counted word, which cannot be clustered
+	Empty []string `json:"empty,omitempty"`
+}
+
+// termWeight is one non-zero entry of a sparse vector
+type termWeight struct {
+	term   int
+	weight float64
+}
+
+// sparseVector is a unit-length TF-IDF vector ordered by term
+type sparseVector []termWeight
+
+// neighbour is another document with its cosine similarity
+type neighbour struct {
+	doc        int
+	similarity float64
+}
+
+// ClusterDocuments groups results by the similarity of their TF-IDF vectors
+func ClusterDocuments(results []FileWordFrequency, options ClusterOptions) (DocumentClusters, error) {
+	if options.Clusters < 1 {
+		return DocumentClusters{}, xerrors.Newf("number of clusters must be positive, got: %d", options.Clusters)
+	}
+
+	clusters := DocumentClusters{Method: options.Method}
+
+	var files []string
+	var documents []FileWordFrequency
+	for _, result := range results {
+		if len(result.Words) == 0 {
+			clusters.Empty = append(clusters.Empty, mergedFileKey(result))
+			continue
+		}
+		files = append(files, mergedFileKey(result))
+		documents = append(documents, result)
+	}
+	if len(documents) == 0 {
+		return clusters, nil
+	}
+
+	vectors, vocabulary := tfidfVectors(documents)
+	neighbours := nearestNeighbours(vectors, options.Neighbours, max(options.Workers, 1))
+
+	var groups [][]int
+	if options.Method == ClusterKMeans {
+		groups = kMeans(vectors, len(vocabulary), min(options.Clusters, len(vectors)), options.Iterations)
+	} else {
+		groups = agglomerate(neighbours, options.Clusters)
+	}
+
+	for _, group := range groups {
+		clusters.Clusters = append(clusters.Clusters, describeCluster(group, files, vectors, vocabulary, options.Terms))
+	}
+	slices.SortFunc(clusters.Clusters, func(a, b DocumentCluster) int {
+		if c := cmp.Compare(len(b.Files), len(a.Files)); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Files[0], b.Files[0])
+	})
+
+	for doc, similar := range neighbours {
+		entry := FileNeighbours{File: files[doc], Similar: []SimilarFile{}}
+		for _, n := range similar {
+			entry.Similar = append(entry.Similar, SimilarFile{File: files[n.doc], Similarity: n.similarity})
+		}
+		clusters.Neighbours = append(clusters.Neighbours, entry)
+	}
+
+	return clusters, nil
+}
+
+// tfidfVectors weights every word by a sublinear term frequency (1 + ln count) and a
+// smoothed inverse document frequency, and normalises each vector to unit length.
+// Term ids follow the sorted vocabulary, so results do not depend on map order.
+func tfidfVectors(documents []FileWordFrequency) ([]sparseVector, []string) {
+	frequency := make(map[string]int)
+	for _, document := range documents {
+		for _, word := range document.Words {
+			frequency[word.Word]++
+		}
+	}
+
+	vocabulary := slices.Sorted(maps.Keys(frequency))
+	ids := make(map[string]int, len(vocabulary))
+	for id, word := range vocabulary {
+		ids[word] = id
+	}
+
+	n := float64(len(documents))
+	vectors := make([]sparseVector, len(documents))
+	for i, document := range documents {
+		vector := make(sparseVector, 0, len(document.Words))
+		norm := 0.0
+		for _, word := range document.Words {
+			if word.Count <= 0 {
+				continue
+			}
+			idf := math.Log((1+n)/(1+float64(frequency[word.Word]))) + 1
+			weight := (1 + math.Log(float64(word.Count))) * idf
+			vector = append(vector, termWeight{term: ids[word.Word], weight: weight})
+			norm += weight * weight
+		}
+
+		if norm = math.Sqrt(norm); norm > 0 {
+			for j := range vector {
+				vector[j].weight /= norm
+			}
+		}
+		slices.SortFunc(vector, func(a, b termWeight) int { return cmp.Compare(a.term, b.term) })
+		vectors[i] = vector
+	}
+
+	return vectors, vocabulary
+}
+
+// nearestNeighbours computes the cosine similarity of every pair of documents sharing a term
+// and keeps the k most similar of each (all when k is 0), using Fan-Out over documents.
+// Only documents sharing terms are visited, through a term to documents index.
+func nearestNeighbours(vectors []sparseVector, k, workers int) [][]neighbour {
+	postings := make(map[int][]neighbour)
+	for doc, vector := range vectors {
+		for _, entry := range vector {
+			postings[entry.term] = append(postings[entry.term], neighbour{doc: doc, similarity: entry.weight})
+		}
+	}
+
+	neighbours := make([][]neighbour, len(vectors))
+	jobs := make(chan int, len(vectors))
+	for doc := range vectors {
+		jobs <- doc
+	}
+	close(jobs)
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Go(func() {
+			// Scores are accumulated in a dense row reset after every document
+			scores := make([]float64, len(vectors))
+			var touched []int
+
+			for doc := range jobs {
+				for _, entry := range vectors[doc] {
+					for _, posting := range postings[entry.term] {
+						if posting.doc == doc {
+							continue
+						}
+						if scores[posting.doc] == 0 {
+							touched = append(touched, posting.doc)
+						}
+						scores[posting.doc] += entry.weight * posting.similarity
+					}
+				}
+
+				similar := make([]neighbour, 0, len(touched))
+				for _, other := range touched {
+					similar = append(similar, neighbour{doc: other, similarity: scores[other]})
+					scores[other] = 0
+				}
+				touched = touched[:0]
+
+				slices.SortFunc(similar, func(a, b neighbour) int {
+					if c := cmp.Compare(b.similarity, a.similarity); c != 0 {
+						return c
+					}
+					return cmp.Compare(a.doc, b.doc)
+				})
+				if k > 0 {
+					similar = truncate(similar, k)
+				}
+				neighbours[doc] = similar
+			}
+		})
+	}
+	wg.Wait()
+
+	return neighbours
+}
+
+// linkCandidate is a possible join of two clusters; versions detect candidates made stale by other joins
+type linkCandidate struct {
+	average float64
+	a, b    int
+	va, vb  int
+}
+
+// linkHeap pops the highest average similarity first, then the lowest cluster ids
+type linkHeap []linkCandidate
+
+func (h linkHeap) Len() int { return len(h) }
+func (h linkHeap) Less(i, j int) bool {
+	if h[i].average != h[j].average {
+		return h[i].average > h[j].average
+	}
+	if h[i].a != h[j].a {
+		return h[i].a < h[j].a
+	}
+	return h[i].b < h[j].b
+}
+func (h linkHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *linkHeap) Push(x any)   { *h = append(*h, x.(linkCandidate)) }
+func (h *linkHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// agglomerate runs average-linkage clustering over the neighbour graph until k clusters
+// remain or no linked clusters are left. Pairs outside the graph count as dissimilar.
+func agglomerate(neighbours [][]neighbour, k int) [][]int {
+	n := len(neighbours)
+
+	// links holds the summed similarity between two clusters, in both directions
+	links := make([]map[int]float64, n)
+	members := make([][]int, n)
+	versions := make([]int, n)
+	for doc := range n {
+		links[doc] = make(map[int]float64)
+		members[doc] = []int{doc}
+	}
+	for doc, similar := range neighbours {
+		for _, other := range similar {
+			links[doc][other.doc] = other.similarity
+			links[other.doc][doc] = other.similarity
+		}
+	}
+
+	candidates := &linkHeap{}
+	push := func(a, b int) {
+		a, b = min(a, b), max(a, b)
+		average := links[a][b] / float64(len(members[a])*len(members[b]))
+		heap.Push(candidates, linkCandidate{average: average, a: a, b: b, va: versions[a], vb: versions[b]})
+	}
+	for a := range n {
+		for b := range links[a] {
+			if a < b {
+				push(a, b)
+			}
+		}
+	}
+
+	remaining := n
+	for remaining > k && candidates.Len() > 0 {
+		candidate := heap.Pop(candidates).(linkCandidate)
+		a, b := candidate.a, candidate.b
+		if members[a] == nil || members[b] == nil || versions[a] != candidate.va || versions[b] != candidate.vb {
+			continue
+		}
+
+		// Join b into a, moving its links
+		for other, sum := range links[b] {
+			delete(links[other], b)
+			if other == a {
+				continue
+			}
+			links[a][other] += sum
+			links[other][a] += sum
+		}
+		members[a] = append(members[a], members[b]...)
+		members[b], links[b] = nil, nil
+		versions[a]++
+		remaining--
+
+		// Only the averages involving a changed; older candidates of a are now stale
+		for other := range links[a] {
+			push(a, other)
+		}
+	}
+
+	var groups [][]int
+	for _, group := range members {
+		if group != nil {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// kMeans runs spherical k-means: documents join the centroid with the highest cosine
+// similarity, and centroids are the normalised sums of their documents. Seeding uses
+// k-means++ with a fixed seed, so the same input always gives the same clusters.
+func kMeans(vectors []sparseVector, dimensions, k, iterations int) [][]int {
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	centroids := [][]float64{denseVector(vectors[rng.IntN(len(vectors))], dimensions)}
+	for len(centroids) < k {
+		// Pick the next seed with a probability growing with its distance to the chosen ones
+		distances := make([]float64, len(vectors))
+		total := 0.0
+		for doc, vector := range vectors {
+			best := 0.0
+			for _, centroid := range centroids {
+				best = max(best, dotDense(vector, centroid))
+			}
+			distances[doc] = (1 - best) * (1 - best)
+			total += distances[doc]
+		}
+		if total <= 0 {
+			break
+		}
+
+		target := rng.Float64() * total
+		chosen := -1
+		for doc, distance := range distances {
+			if distance == 0 {
+				continue
+			}
+			chosen = doc
+			if target -= distance; target <= 0 {
+				break
+			}
+		}
+		centroids = append(centroids, denseVector(vectors[chosen], dimensions))
+	}
+
+	assignment := make([]int, len(vectors))
+	for round := range max(iterations, 1) {
+		changed := round == 0
+		for doc, vector := range vectors {
+			best, bestSimilarity := 0, math.Inf(-1)
+			for c, centroid := range centroids {
+				if similarity := dotDense(vector, centroid); similarity > bestSimilarity {
+					best, bestSimilarity = c, similarity
+				}
+			}
+			if assignment[doc] != best {
+				assignment[doc] = best
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+
+		// Recompute centroids; a centroid that lost all documents keeps its position
+		for c := range centroids {
+			sum := make([]float64, dimensions)
+			found := false
+			for doc, vector := range vectors {
+				if assignment[doc] != c {
+					continue
+				}
+				found = true
+				for _, entry := range vector {
+					sum[entry.term] += entry.weight
+				}
+			}
+			if found {
+				centroids[c] = normalise(sum)
+			}
+		}
+	}
+
+	groups := make([][]int, len(centroids))
+	for doc, c := range assignment {
+		groups[c] = append(groups[c], doc)
+	}
+	return slices.DeleteFunc(groups, func(group []int) bool { return len(group) == 0 })
+}
+
+// denseVector expands a sparse vector
+func denseVector(vector sparseVector, dimensions int) []float64 {
+	dense := make([]float64, dimensions)
+	for _, entry := range vector {
+		dense[entry.term] = entry.weight
+	}
+	return dense
+}
+
+// dotDense is the dot product of a sparse and a dense vector
+func dotDense(vector sparseVector, dense []float64) float64 {
+	dot := 0.0
+	for _, entry := range vector {
+		dot += entry.weight * dense[entry.term]
+	}
+	return dot
+}
+
+// normalise scales a dense vector to unit length in place
+func normalise(dense []float64) []float64 {
+	norm := 0.0
+	for _, x := range dense {
+		norm += x * x
+	}
+	if norm = math.Sqrt(norm); norm > 0 {
+		for i := range dense {
+			dense[i] /= norm
+		}
+	}
+	return dense
+}
+
+// describeCluster lists the files of a group with its top terms by mean weight and its cohesion
+func describeCluster(group []int, files []string, vectors []sparseVector, vocabulary []string, terms int) DocumentCluster {
+	mean := make(map[int]float64)
+	for _, doc := range group {
+		for _, entry := range vectors[doc] {
+			mean[entry.term] += entry.weight / float64(len(group))
+		}
+	}
+
+	cluster := DocumentCluster{}
+	for _, doc := range group {
+		cluster.Files = append(cluster.Files, files[doc])
+	}
+	slices.Sort(cluster.Files)
+
+	for term, weight := range mean {
+		cluster.Terms = append(cluster.Terms, ClusterTerm{Word: vocabulary[term], Weight: weight})
+	}
+	slices.SortFunc(cluster.Terms, func(a, b ClusterTerm) int {
+		if c := cmp.Compare(b.Weight, a.Weight); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Word, b.Word)
+	})
+	cluster.Terms = truncate(cluster.Terms, terms)
+
+	// The cosine to the centroid is the dot product with the normalised mean
+	norm := 0.0
+	for _, weight := range mean {
+		norm += weight * weight
+	}
+	if norm = math.Sqrt(norm); norm > 0 {
+		for _, doc := range group {
+			for _, entry := range vectors[doc] {
+				cluster.Cohesion += entry.weight * mean[entry.term] / norm
+			}
+		}
+		cluster.Cohesion /= float64(len(group))
+	}
+
+	return cluster
+}
+
+// WriteClusterTable writes every cluster with its cohesion, top terms and files
+func WriteClusterTable(w io.Writer, clusters DocumentClusters) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	for i, cluster := range clusters.Clusters {
+		words := make([]string, 0, len(cluster.Terms))
+		for _, term := range cluster.Terms {
+			words = append(words, term.Word)
+		}
+
+		fmt.Fprintf(tw, "== cluster %d: %d files, cohesion %.2f ==\n", i+1, len(cluster.Files), cluster.Cohesion)
+		fmt.Fprintf(tw, "terms: %s\n", strings.Join(words, ", "))
+		for _, file := range cluster.Files {
+			fmt.Fprintf(tw, "\t%s\n", file)
+		}
+		fmt.Fprintln(tw)
+	}
+
+	if len(clusters.Empty) > 0 {
+		fmt.Fprintf(tw, "not clustered (no words): %s\n", strings.Join(clusters.Empty, ", "))
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,41 @@
+package internal
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestClusterDocuments checks both methods separate two topics and name them by their terms
+func TestClusterDocuments(t *testing.T) {
+	results := []FileWordFrequency{
+		{Path: "logs/a.txt", Words: []Word{{"timeout", 9}, {"retry", 4}, {"queue", 2}}},
+		{Path: "logs/b.txt", Words: []Word{{"timeout", 5}, {"retry", 6}, {"disk", 1}}},
+		{Path: "logs/c.txt", Words: []Word{{"retry", 3}, {"timeout", 2}, {"queue", 4}}},
+		{Path: "docs/x.txt", Words: []Word{{"goroutine", 7}, {"channel", 5}, {"queue", 1}}},
+		{Path: "docs/y.txt", Words: []Word{{"channel", 4}, {"goroutine", 3}, {"select", 2}}},
+		{Path: "empty.txt"},
+	}
+
+	for _, method := range []ClusterMethod{ClusterAgglomerative, ClusterKMeans} {
+		got, err := ClusterDocuments(results, ClusterOptions{Method: method, Clusters: 2, Neighbours: 2, Terms: 2, Iterations: 10, Workers: 2})
+		if err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+
+		if len(got.Clusters) != 2 {
+			t.Fatalf("%s: got %d clusters, want 2: %+v", method, len(got.Clusters), got.Clusters)
+		}
+		if want := []string{"logs/a.txt", "logs/b.txt", "logs/c.txt"}; !slices.Equal(got.Clusters[0].Files, want) {
+			t.Errorf("%s: got first cluster %v, want %v", method, got.Clusters[0].Files, want)
+		}
+		if want := []string{"docs/x.txt", "docs/y.txt"}; !slices.Equal(got.Clusters[1].Files, want) {
+			t.Errorf("%s: got second cluster %v, want %v", method, got.Clusters[1].Files, want)
+		}
+		if terms := got.Clusters[1].Terms; len(terms) != 2 || terms[0].Word != "goroutine" || terms[1].Word != "channel" {
+			t.Errorf("%s: got terms %+v, want goroutine and channel", method, terms)
+		}
+		if !slices.Equal(got.Empty, []string{"empty.txt"}) || len(got.Neighbours) != 5 || len(got.Neighbours[0].Similar) != 2 {
+			t.Errorf("%s: got empty %v and %d neighbour lists", method, got.Empty, len(got.Neighbours))
+		}
+	}
+}
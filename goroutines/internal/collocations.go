@@ -0,0 +1,518 @@
+package internal
+
+import (
+	"cmp"
+	"iter"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/mdobak/go-xerrors"
+)
+
+// CollocationRank selects the score collocations are ranked by
+type CollocationRank int
+
+const (
+	// RankLogLikelihood ranks by Dunning's log-likelihood ratio, which favours frequent, reliable pairs
+	RankLogLikelihood CollocationRank = iota
+	// RankPMI ranks by pointwise mutual information, which favours pairs that rarely occur apart
+	RankPMI
+)
+
+// String returns the command line name of the rank
+func (r CollocationRank) String() string {
+	if r == RankPMI {
+		return "pmi"
+	}
+	return "llr"
+}
+
+// MarshalText encodes the rank by name, e.g. in the run manifest
+func (r CollocationRank) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// ParseCollocationRank converts a command line name into a CollocationRank
+func ParseCollocationRank(name string) (CollocationRank, error) {
+	switch name {
+	case "llr":
+		return RankLogLikelihood, nil
+	case "pmi":
+		return RankPMI, nil
+	}
+	return 0, xerrors.Newf("unknown collocation rank %q (expected llr or pmi)", name)
+}
+
+// CollocationOptions configures co-occurrence counting
+type CollocationOptions struct {
+	// Window is the largest distance between two words counted as co-occurring
+	Window int `json:"window"`
+	// MinCount drops pairs seen fewer times, as their scores are unreliable
+	MinCount int `json:"min_count"`
+	// TopN is the number of pairs reported per file and for the corpus
+	TopN int `json:"top_n"`
+	// MemoryBudget caps the pair table of one counter in bytes; rare pairs are pruned beyond it
+	MemoryBudget int64           `json:"memory_budget"`
+	Rank         CollocationRank `json:"rank"`
+}
+
+// cooccurrencePairBytes is a rough size of one pair in the table (map slot, key and count)
+const cooccurrencePairBytes = 48
+
+// Collocation is a pair of words with how strongly they are associated
+type Collocation struct {
+	A     string `json:"a"`
+	B     string `json:"b"`
+	Count int    `json:"count"`
+	// PMI is log2 of how much more often the pair occurs than if the words were independent
+	PMI float64 `json:"pmi"`
+	// LogLikelihood is Dunning's G² statistic of the pair's 2x2 contingency table
+	LogLikelihood float64 `json:"log_likelihood"`
+}
+
+// CollocationStats holds the top collocations of a file or the corpus
+type CollocationStats struct {
+	Window   int `json:"window"`
+	MinCount int `json:"min_count"`
+	// Pairs is the number of co-occurrences counted in all windows
+	Pairs int `json:"pairs"`
+	// DistinctPairs is the number of different pairs kept in the table
+	DistinctPairs int `json:"distinct_pairs"`
+	// PrunedPairs is the number of rare pairs dropped to stay within the memory budget.
+	// The count of any pair may be too low by at most MaxUndercount.
+	PrunedPairs   int           `json:"pruned_pairs"`
+	MaxUndercount int           `json:"max_undercount"`
+	Top           []Collocation `json:"top"`
+}
+
+// CooccurrenceCounter counts how often two words occur within a window of each other.
+// Words are interned once and pairs are keyed by word ids, so the table stays compact.
+type CooccurrenceCounter struct {
+	mu      sync.Mutex
+	options CollocationOptions
+
+	ids   map[string]uint32
+	words []string
+	// pairs maps a pair of word ids (smaller id first) to its count
+	pairs map[uint64]int
+	// marginals counts the pairs every word takes part in; pruning leaves them exact
+	marginals []int
+	total     int
+	maxPairs  int
+
+	pruned        int
+	maxUndercount int
+
+	// recent holds the ids of the last window words of the stream in a ring, next is the oldest
+	recent []uint32
+	next   int
+}
+
+// NewCooccurrenceCounter creates a counter whose pair table fits the memory budget
+func NewCooccurrenceCounter(options CollocationOptions) *CooccurrenceCounter {
+	return &CooccurrenceCounter{
+		options:  options,
+		ids:      make(map[string]uint32),
+		pairs:    make(map[uint64]int),
+		maxPairs: max(int(options.MemoryBudget/cooccurrencePairBytes), 1024),
+	}
+}
+
+// id interns word and returns its id
+func (c *CooccurrenceCounter) id(word string) uint32 {
+	if id, ok := c.ids[word]; ok {
+		return id
+	}
+
+	// Words from the pipeline point into the whole chunk text; a copy lets the chunk be collected
+	return c.intern(strings.Clone(word))
+}
+
+// intern adds a word that has no id yet; word must not share memory that changes
+func (c *CooccurrenceCounter) intern(word string) uint32 {
+	id := uint32(len(c.words))
+	c.ids[word] = id
+	c.words = append(c.words, word)
+	c.marginals = append(c.marginals, 0)
+	return id
+}
+
+// pairKey packs two word ids, smaller first, so (a, b) and (b, a) are the same pair
+func pairKey(a, b uint32) uint64 {
+	if a > b {
+		a, b = b, a
+	}
+	return uint64(a)<<32 | uint64(b)
+}
+
+// Count adds the co-occurrences of a separate word stream, such as the output of FilterStopwords.
+// It is not synchronised and must only be used by one goroutine.
+func (c *CooccurrenceCounter) Count(words iter.Seq[string]) {
+	// Words of an earlier stream do not pair with the first words of this one
+	c.recent = c.recent[:0]
+	c.next = 0
+
+	for word := range words {
+		c.Add(word)
+	}
+}
+
+// Add counts word as the next word of the stream, pairing it with the words before it in the window.
+// A nil counter ignores the call, so the counting stages can tap their words unconditionally.
+// It is not synchronised and must only be used by one goroutine.
+func (c *CooccurrenceCounter) Add(word string) {
+	if c == nil {
+		return
+	}
+	c.addID(c.id(word))
+}
+
+// addBytes is Add for a word held in a byte slice that is only valid during the call
+func (c *CooccurrenceCounter) addBytes(word []byte) {
+	if c == nil {
+		return
+	}
+
+	// Lookups keyed by string(word) do not allocate
+	id, ok := c.ids[string(word)]
+	if !ok {
+		id = c.intern(string(word))
+	}
+	c.addID(id)
+}
+
+// addID pairs a word with the words before it in the window and moves the window on
+func (c *CooccurrenceCounter) addID(id uint32) {
+	for _, other := range c.recent {
+		if other == id {
+			continue
+		}
+		c.pairs[pairKey(id, other)]++
+		c.marginals[id]++
+		c.marginals[other]++
+		c.total++
+	}
+
+	if window := max(c.options.Window, 1); len(c.recent) < window {
+		c.recent = append(c.recent, id)
+	} else {
+		c.recent[c.next] = id
+		c.next = (c.next + 1) % window
+	}
+
+	if len(c.pairs) > c.maxPairs {
+		c.prune()
+	}
+}
+
+// prune drops the rarest pairs until the table is back to three quarters of its cap.
+// Like lossy counting, every round raises the count below which pairs are dropped.
+func (c *CooccurrenceCounter) prune() {
+	for level := c.maxUndercount + 1; len(c.pairs) > c.maxPairs*3/4; level++ {
+		for key, count := range c.pairs {
+			if count <= level {
+				delete(c.pairs, key)
+				c.pruned++
+			}
+		}
+		c.maxUndercount = level
+	}
+}
+
+// Merge adds the counts of another counter; it is safe for concurrent use
+func (c *CooccurrenceCounter) Merge(other *CooccurrenceCounter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.merge(other)
+	if len(c.pairs) > c.maxPairs {
+		c.prune()
+	}
+}
+
+// merge adds the counts of another counter without pruning. Additions commute, so
+// counters merged this way give the same table whatever order they come in.
+func (c *CooccurrenceCounter) merge(other *CooccurrenceCounter) {
+	// Word ids differ between counters, so other's ids are translated first
+	translated := make([]uint32, len(other.words))
+	for i, word := range other.words {
+		translated[i] = c.id(word)
+		c.marginals[translated[i]] += other.marginals[i]
+	}
+
+	for key, count := range other.pairs {
+		c.pairs[pairKey(translated[key>>32], translated[uint32(key)])] += count
+	}
+
+	c.total += other.total
+	c.pruned += other.pruned
+	c.maxUndercount += other.maxUndercount
+}
+
+// Stats scores the pairs seen at least MinCount times and returns the top ones
+func (c *CooccurrenceCounter) Stats() *CollocationStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := &CollocationStats{
+		Window:        c.options.Window,
+		MinCount:      c.options.MinCount,
+		Pairs:         c.total,
+		DistinctPairs: len(c.pairs),
+		PrunedPairs:   c.pruned,
+		MaxUndercount: c.maxUndercount,
+	}
+
+	for key, count := range c.pairs {
+		if count < c.options.MinCount {
+			continue
+		}
+
+		a, b := uint32(key>>32), uint32(key)
+		pmi, llr := collocationScores(count, c.marginals[a], c.marginals[b], c.total)
+		stats.Top = append(stats.Top, Collocation{A: c.words[a], B: c.words[b], Count: count, PMI: pmi, LogLikelihood: llr})
+	}
+
+	// Alphabetical order of the pair words breaks ties, so map order never shows
+	for i := range stats.Top {
+		if stats.Top[i].A > stats.Top[i].B {
+			stats.Top[i].A, stats.Top[i].B = stats.Top[i].B, stats.Top[i].A
+		}
+	}
+	score := func(c Collocation) float64 { return c.LogLikelihood }
+	if c.options.Rank == RankPMI {
+		score = func(c Collocation) float64 { return c.PMI }
+	}
+	slices.SortFunc(stats.Top, func(x, y Collocation) int {
+		if c := cmp.Compare(score(y), score(x)); c != 0 {
+			return c
+		}
+		if c := strings.Compare(x.A, y.A); c != 0 {
+			return c
+		}
+		return strings.Compare(x.B, y.B)
+	})
+	stats.Top = truncate(stats.Top, c.options.TopN)
+
+	return stats
+}
+
+// collocationScores computes PMI and the log-likelihood ratio of a pair from its
+// 2x2 contingency table: windows with both words, with only one and with neither
+func collocationScores(pair, a, b, total int) (float64, float64) {
+	n := float64(total)
+	k11 := float64(pair)
+	k12 := float64(a - pair)
+	k21 := float64(b - pair)
+	k22 := n - k11 - k12 - k21
+
+	pmi := math.Log2(k11 * n / (float64(a) * float64(b)))
+
+	// G² = 2 Σ observed · ln(observed / expected)
+	llr := 0.0
+	for _, cell := range [][3]float64{
+		{k11, k11 + k12, k11 + k21},
+		{k12, k11 + k12, k12 + k22},
+		{k21, k21 + k22, k11 + k21},
+		{k22, k21 + k22, k12 + k22},
+	} {
+		observed, row, column := cell[0], cell[1], cell[2]
+		if observed > 0 {
+			llr += observed * math.Log(observed*n/(row*column))
+		}
+	}
+
+	return pmi, 2 * llr
+}
+
+// fileCooccurrences gathers the co-occurrence counters the counting stages fill for the
+// chunks of one file. Pairs across two chunks are not counted, which misses at most a
+// window of pairs at every chunk boundary. A nil value gathers nothing.
+type fileCooccurrences struct {
+	options CollocationOptions
+
+	mu     sync.Mutex
+	chunks []*CooccurrenceCounter
+}
+
+// chunk returns a counter for the words of one more chunk, or nil if nothing is gathered
+func (f *fileCooccurrences) chunk() *CooccurrenceCounter {
+	if f == nil {
+		return nil
+	}
+
+	counter := NewCooccurrenceCounter(f.options)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.chunks = append(f.chunks, counter)
+	return counter
+}
+
+// counter merges the chunk counters into one for the file. Chunks finish in any order,
+// so they are all added up before anything is pruned, which keeps the result reproducible.
+func (f *fileCooccurrences) counter() *CooccurrenceCounter {
+	counter := NewCooccurrenceCounter(f.options)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, chunk := range f.chunks {
+		counter.merge(chunk)
+	}
+	f.chunks = nil
+
+	if len(counter.pairs) > counter.maxPairs {
+		counter.prune()
+	}
+	return counter
+}
+
+// CollocationCollector receives the co-occurrence counts of every file as it is counted and
+// folds them into a corpus counter. Workers add files concurrently; a nil collector counts nothing.
+type CollocationCollector struct {
+	options CollocationOptions
+	corpus  *CooccurrenceCounter
+	// keep holds every file counter until Corpus, so files can still be left out of the corpus
+	keep bool
+
+	mu    sync.Mutex
+	files map[string]*CooccurrenceCounter
+	stats map[string]*CollocationStats
+	// With an order, files are folded in that order so pruning does not depend on scheduling:
+	// position gives the index of every path, and pending holds the files that finished
+	// before all files ahead of them (nil for files without counts) until next reaches them
+	position map[string]int
+	pending  map[int]*CooccurrenceCounter
+	next     int
+}
+
+// NewCollocationCollector creates a collector that folds files into the corpus as they are added.
+// With order set, files are folded in the order of the paths listed in it instead, and only files
+// finishing ahead of their turn wait in memory. With keep set, every file counter is kept until
+// Corpus, which merges them in path order.
+func NewCollocationCollector(options CollocationOptions, order []string, keep bool) *CollocationCollector {
+	c := &CollocationCollector{
+		options: options,
+		corpus:  NewCooccurrenceCounter(options),
+		keep:    keep,
+		files:   make(map[string]*CooccurrenceCounter),
+		stats:   make(map[string]*CollocationStats),
+	}
+
+	if order != nil && !keep {
+		c.position = make(map[string]int, len(order))
+		for i, filePath := range order {
+			c.position[filePath] = i
+		}
+		c.pending = make(map[int]*CooccurrenceCounter)
+	}
+	return c
+}
+
+// newFile starts gathering the co-occurrences of one file, or returns nil for a nil collector
+func (c *CollocationCollector) newFile() *fileCooccurrences {
+	if c == nil {
+		return nil
+	}
+	return &fileCooccurrences{options: c.options}
+}
+
+// addFile takes the co-occurrences gathered while a file was counted
+func (c *CollocationCollector) addFile(filePath string, file *fileCooccurrences) {
+	if c == nil || file == nil {
+		return
+	}
+
+	counter := file.counter()
+	stats := counter.Stats()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats[filePath] = stats
+	c.fold(filePath, counter)
+}
+
+// Skip lets the files after filePath in the order be folded when it failed and has no counts
+func (c *CollocationCollector) Skip(filePath string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.fold(filePath, nil)
+}
+
+// fold merges a file counter into the corpus once its turn comes; c.mu must be held
+func (c *CollocationCollector) fold(filePath string, counter *CooccurrenceCounter) {
+	if c.keep {
+		if counter != nil {
+			c.files[filePath] = counter
+		}
+		return
+	}
+
+	index, ordered := c.position[filePath]
+	if !ordered {
+		if counter != nil {
+			c.corpus.Merge(counter)
+		}
+		return
+	}
+
+	c.pending[index] = counter
+	for {
+		next, ok := c.pending[c.next]
+		if !ok {
+			return
+		}
+		delete(c.pending, c.next)
+		c.next++
+
+		if next != nil {
+			c.corpus.Merge(next)
+		}
+	}
+}
+
+// File returns the collocations of one file, or nil if it was not counted
+func (c *CollocationCollector) File(filePath string) *CollocationStats {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats[filePath]
+}
+
+// Corpus returns the corpus-wide collocations once all files are added.
+// Files still waiting for their turn, e.g. behind a cancelled file, are folded in order.
+// With keep set, the files in skip are left out; skip may be nil.
+func (c *CollocationCollector) Corpus(skip map[string]bool) *CollocationStats {
+	c.mu.Lock()
+	for _, filePath := range slices.Sorted(maps.Keys(c.files)) {
+		if !skip[filePath] {
+			c.corpus.Merge(c.files[filePath])
+		}
+	}
+	clear(c.files)
+
+	for _, index := range slices.Sorted(maps.Keys(c.pending)) {
+		if counter := c.pending[index]; counter != nil {
+			c.corpus.Merge(counter)
+		}
+	}
+	clear(c.pending)
+	c.mu.Unlock()
+
+	return c.corpus.Stats()
+}
@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"reflect"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/DonAlexandro/go_advanced/pkg"
+)
+
+// TestCooccurrenceCounter checks windowed pairs, the minimum count and that a merge matches a single count
+func TestCooccurrenceCounter(t *testing.T) {
+	options := CollocationOptions{Window: 2, MinCount: 2, TopN: 10}
+	words := []string{"worker", "pool", "queue", "worker", "pool", "drain"}
+
+	whole := NewCooccurrenceCounter(options)
+	whole.Count(slices.Values(words))
+
+	stats := whole.Stats()
+	if stats.Pairs != 9 {
+		t.Errorf("got %d pairs, want 9", stats.Pairs)
+	}
+	var got []string
+	for _, pair := range stats.Top {
+		got = append(got, pair.A+" "+pair.B+":"+strconv.Itoa(pair.Count))
+	}
+	if want := []string{"pool worker:3", "pool queue:2", "queue worker:2"}; !slices.Equal(got, want) {
+		t.Errorf("got top %v, want %v", got, want)
+	}
+
+	// Splitting the stream between the two halves loses the pairs across the split, and nothing else
+	first, second := NewCooccurrenceCounter(options), NewCooccurrenceCounter(options)
+	first.Count(slices.Values(words[:3]))
+	second.Count(slices.Values(words[3:]))
+	merged := NewCooccurrenceCounter(options)
+	merged.Merge(first)
+	merged.Merge(second)
+
+	if got := merged.Stats(); got.Pairs != 6 || len(got.Top) != 1 || got.Top[0].A != "pool" || got.Top[0].Count != 2 {
+		t.Errorf("got merged %+v, want 6 pairs with only pool worker seen twice", got)
+	}
+}
+
+// TestCollocationScores checks PMI and the log-likelihood ratio against hand-computed values
+func TestCollocationScores(t *testing.T) {
+	// Independent words: the pair occurs exactly as often as expected
+	pmi, llr := collocationScores(10, 100, 100, 1000)
+	if pmi != 0 || llr > 1e-9 {
+		t.Errorf("independent pair: got pmi %v, llr %v, want 0", pmi, llr)
+	}
+
+	// Words that only occur together
+	pmi, llr = collocationScores(10, 10, 10, 1000)
+	if want := 6.643856; pmi < want-1e-6 || pmi > want+1e-6 {
+		t.Errorf("got pmi %v, want %v", pmi, want)
+	}
+	if llr <= 0 {
+		t.Errorf("got llr %v, want a positive score", llr)
+	}
+}
+
+// TestCooccurrenceCounterPrune checks the table stays within its cap and reports the undercount
+func TestCooccurrenceCounterPrune(t *testing.T) {
+	counter := NewCooccurrenceCounter(CollocationOptions{Window: 1, MinCount: 1, TopN: 1})
+	for i := range 5000 {
+		counter.Count(slices.Values([]string{"a", string(rune('a'+i%26)) + string(rune('a'+i/26%26)) + string(rune('a'+i/676))}))
+	}
+
+	stats := counter.Stats()
+	if stats.DistinctPairs > counter.maxPairs || stats.PrunedPairs == 0 || stats.MaxUndercount == 0 {
+		t.Errorf("got %+v, want at most %d pruned pairs with an undercount", stats, counter.maxPairs)
+	}
+}
+
+// TestCollocationsTapCountingStages checks that every pipeline feeds the collocations of the words it counts
+func TestCollocationsTapCountingStages(t *testing.T) {
+	text := "The worker pool drains the queue. A worker pool, a queue: the worker pool!"
+	stopwords := pkg.StopwordSet{"the": {}, "a": {}}
+	options := CollocationOptions{Window: 2, MinCount: 1, TopN: 10, MemoryBudget: 1 << 20}
+
+	tp := TextPreprocessor{Stopwords: stopwords}
+	want := NewCooccurrenceCounter(options)
+	want.Count(tp.PreprocessTextFused(text))
+
+	for _, mode := range []PipelineMode{PipelineStream, PipelineBatch, PipelineFused, PipelineBytes} {
+		collector := NewCollocationCollector(options, nil, false)
+		CountWordFrequencyInBytes([]byte(text), CountOptions{Counters: 1, Pipeline: mode, Stopwords: stopwords, Collocations: collector})
+
+		if got := collector.File(""); !reflect.DeepEqual(got, want.Stats()) {
+			t.Errorf("%s pipeline: got %+v, want %+v", mode, got, want.Stats())
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"math"
+)
+
+// countMinSketch estimates word counts in fixed memory.
+// Every word increments one cell per row; the estimate is the smallest of its
+// cells, which never undercounts and overcounts by at most epsilon*N with
+// probability 1-delta, where N is the total number of added words.
+type countMinSketch struct {
+	width int
+	depth int
+	// cells holds depth rows of width counters, row after row
+	cells []uint64
+}
+
+// newCountMinSketch sizes the sketch to fit into budget bytes
+func newCountMinSketch(budget int64, depth int) *countMinSketch {
+	width := max(int(budget/8/int64(depth)), 16)
+
+	return &countMinSketch{
+		width: width,
+		depth: depth,
+		cells: make([]uint64, width*depth),
+	}
+}
+
+// cellIndex returns the cell of hash in the given row using double hashing
+func (s *countMinSketch) cellIndex(hash uint64, row int) int {
+	h1, h2 := hash&0xffffffff, hash>>32
+	return row*s.width + int((h1+uint64(row)*h2)%uint64(s.width))
+}
+
+// Add increments the counters of a hashed word
+func (s *countMinSketch) Add(hash uint64, count uint64) {
+	for row := range s.depth {
+		s.cells[s.cellIndex(hash, row)] += count
+	}
+}
+
+// Estimate returns the estimated count of a hashed word
+func (s *countMinSketch) Estimate(hash uint64) uint64 {
+	estimate := uint64(math.MaxUint64)
+	for row := range s.depth {
+		estimate = min(estimate, s.cells[s.cellIndex(hash, row)])
+	}
+	return estimate
+}
+
+// Merge adds the counters of another sketch with identical dimensions
+func (s *countMinSketch) Merge(other *countMinSketch) {
+	for i, count := range other.cells {
+		s.cells[i] += count
+	}
+}
+
+// Epsilon is the relative overcount bound: estimates exceed true counts by at most Epsilon*N
+func (s *countMinSketch) Epsilon() float64 {
+	return math.E / float64(s.width)
+}
+
+// Delta is the probability that an estimate exceeds the Epsilon bound
+func (s *countMinSketch) Delta() float64 {
+	return math.Exp(-float64(s.depth))
+}
+
+// Bytes returns the memory used by the counters
+func (s *countMinSketch) Bytes() int64 {
+	return int64(len(s.cells)) * 8
+}
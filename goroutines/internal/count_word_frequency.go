@@ -1,11 +1,13 @@
 package internal
 
 import (
-	"os"
+	"context"
+	"io/fs"
+	"log/slog"
 	"strings"
 	"sync"
 
-	"github.com/mdobak/go-xerrors"
+	"github.com/DonAlexandro/go_advanced/pkg"
 )
 
 type Frequency = map[string]int
@@ -27,23 +29,144 @@ type ChunkResult struct {
 	id        int
 }
 
-// CountWordFrequency reads a file and counts the frequency of each word using Fan-Out/Fan-In pattern
-func CountWordFrequency(filePath string, counters *int) ([]Word, error) {
-	content, err := os.ReadFile(filePath)
+// CountOptions configures how CountWordFrequency reads and counts a file
+type CountOptions struct {
+	// Counters is the number of goroutines counting chunks of one file
+	Counters int
+	// Pipeline decides how each chunk goes through the preprocessing stages
+	Pipeline PipelineMode
+	// Input decides how the file is loaded into memory
+	Input InputMode
+	// Merge decides how chunk frequencies are combined
+	Merge MergeMode
+	// Stopwords are filtered out of the counts; nil disables filtering
+	Stopwords pkg.StopwordSet
+	// Stats receives input counters; it may be nil
+	Stats *RunStats
+	// Digests receives the content hash of every file read; it may be nil
+	Digests *InputDigests
+	// Index receives the word positions of every file read; it may be nil
+	Index *InvertedIndex
+	// Extract decides which text of a file is counted
+	Extract ExtractOptions
+	// Collocations receives the co-occurrences of every file read; it may be nil
+	Collocations *CollocationCollector
+	// Duplicates receives the MinHash signature of every file read; it may be nil
+	Duplicates *DuplicateDetector
+	// Readability receives the sentence and vocabulary metrics of every file read; it may be nil
+	Readability *ReadabilityCollector
+	// Context carries the run and file identifiers of log lines; nil means context.Background
+	Context context.Context
+	// Metrics receives the stage latencies of every file read; it may be nil
+	Metrics *Metrics
+	// Redactor blanks sensitive text out of every file read before any other stage; it may be nil
+	Redactor *Redactor
+	// Rules normalise the words ahead of stopword filtering; nil keeps every word
+	Rules *TokenRules
+
+	// cooccurrences gathers the co-occurrences of the chunks of the file being counted
+	cooccurrences *fileCooccurrences
+	// shingles gathers the MinHash signatures of the chunks of the file being counted
+	shingles *fileShingles
+	// timings receives the working time of the text stages of the file being counted
+	timings *stageTimings
+}
+
+// preprocessor returns the text preprocessor of one chunk of the counting stages
+func (o CountOptions) preprocessor() TextPreprocessor {
+	return TextPreprocessor{Stopwords: o.Stopwords, Rules: o.Rules, Stats: o.Stats, Cooccurrences: o.cooccurrences.chunk(), MinHasher: o.shingles.chunk(), timings: o.timings}
+}
+
+// logContext returns the context log lines about the file are written with
+func (o CountOptions) logContext() context.Context {
+	if o.Context == nil {
+		return context.Background()
+	}
+	return o.Context
+}
+
+// CountWordFrequency reads a file of fsys and counts the frequency of each word using Fan-Out/Fan-In pattern
+func CountWordFrequency(fsys fs.FS, filePath string, opts CountOptions) ([]Word, error) {
+	timings := newStageTimings(opts)
+
+	input, err := readInput(fsys, filePath, opts)
 	if err != nil {
-		return nil, xerrors.Newf("failed to read a file %q: %w", filePath, err)
+		return nil, err
+	}
+	defer func() {
+		if err := input.release(); err != nil {
+			slog.WarnContext(opts.logContext(), "failed to release file input", slog.String("file", filePath), slog.Any("error", err))
+		}
+	}()
+	timings.mark("read")
+
+	recordContent(filePath, input.data, opts)
+	timings.mark("record")
+
+	opts.cooccurrences = opts.Collocations.newFile()
+	opts.shingles = opts.Duplicates.newFile()
+	opts.timings = timings
+	words := countWordFrequencyInContent(input.data, input.writable, opts)
+	opts.Collocations.addFile(filePath, opts.cooccurrences)
+	opts.Duplicates.addFile(filePath, opts.shingles)
+	words = opts.Redactor.addTokens(filePath, words)
+	words = opts.Rules.dropRare(words, opts.Stats)
+	timings.log()
+
+	return words, nil
+}
+
+// recordContent feeds the collectors that need the whole text of a file.
+// It runs before counting, as the bytes pipeline may lowercase the buffer in place,
+// and sees the punctuation the preprocessing stages remove.
+// Collocations and near-duplicate signatures are not among them, they are computed from
+// the words the counting stages keep.
+func recordContent(filePath string, content []byte, opts CountOptions) {
+	if opts.Index == nil && opts.Readability == nil {
+		return
 	}
 
 	text := string(content)
+	opts.Index.AddFile(filePath, text)
+	opts.Readability.AddFile(filePath, text)
+}
+
+// CountWordFrequencyInBytes counts the frequency of each word of content that is already in memory
+// The bytes pipeline may lowercase content in place. Content redacted beforehand is recorded
+// under the empty path, whose class tokens are added to the counts, as are its collocations.
+func CountWordFrequencyInBytes(content []byte, opts CountOptions) []Word {
+	opts.cooccurrences = opts.Collocations.newFile()
+	words := countWordFrequencyInContent(content, true, opts)
+	opts.Collocations.addFile("", opts.cooccurrences)
+
+	words = opts.Redactor.addTokens("", words)
+	return opts.Rules.dropRare(words, opts.Stats)
+}
+
+// countWordFrequencyInContent counts loaded content using Fan-Out/Fan-In pattern
+// opts.timings, if not nil, gets the count, text and merge stages
+func countWordFrequencyInContent(content []byte, writable bool, opts CountOptions) []Word {
+	timings := opts.timings
+
+	// Zero-copy path: tokenise the buffer directly, lowercasing in place when it is writable
+	if opts.Pipeline == PipelineBytes {
+		return countWordFrequencyInRegions(content, writable, opts)
+	}
+
+	text := string(content)
+	mode := opts.Pipeline
 
 	// If text is too small or we only have 1 counter, process sequentially
-	if len(text) < 100 || *counters <= 1 {
-		frequency := countWordFrequencyInChunk(text)
-		return convertFrequencyToWord(frequency), nil
+	if len(text) < 100 || opts.Counters <= 1 {
+		frequency := countChunkTraced(opts, 0, len(text), func() Frequency {
+			return countWordFrequencyInChunk(text, mode, opts.preprocessor())
+		})
+		timings.markCounted()
+		return convertFrequencyToWord(frequency)
 	}
 
 	// Fan-Out: Split text into chunks by lines for better word boundary handling
-	numCounters := *counters
+	numCounters := opts.Counters
 
 	// Create channels for Fan-Out/Fan-In
 	jobs := make(chan ChunkProcessor, numCounters)
@@ -55,7 +178,9 @@ func CountWordFrequency(filePath string, counters *int) ([]Word, error) {
 	for range numCounters {
 		wg.Go(func() {
 			for job := range jobs {
-				frequency := countWordFrequencyInChunk(job.chunk)
+				frequency := countChunkTraced(opts, job.id, len(job.chunk), func() Frequency {
+					return countWordFrequencyInChunk(job.chunk, mode, opts.preprocessor())
+				})
 
 				results <- ChunkResult{
 					frequency: frequency,
@@ -83,16 +208,92 @@ func CountWordFrequency(filePath string, counters *int) ([]Word, error) {
 		}
 	}()
 
-	// Wait for all workers to complete
-	wg.Wait()
+	// Close the results once all workers complete to indicate no more chunks will be provided.
+	// The mark happens before the close, and so before the merge below returns.
+	go func() {
+		wg.Wait()
+		timings.markCounted()
+		close(results)
+	}()
 
-	// Close the results to indicate no more chunks will be provided
-	close(results)
+	// Fan-In: Collect and merge results while the workers are still counting;
+	// the merge timing is what is left of the merge after the last chunk was counted
+	words := mergeChunkResultsTraced(results, opts, numCounters)
+	timings.mark("merge")
 
-	// Fan-In: Collect and merge results with thread-safe operation
-	finalFrequency := mergeChunkFrequenciesIntoSingleFrequency(results)
+	return words
+}
 
-	return convertFrequencyToWord(finalFrequency), nil
+// countWordFrequencyInRegions counts words of buf using Fan-Out/Fan-In over disjoint regions.
+// Regions are subslices aligned to word boundaries, so nothing is copied before counting.
+func countWordFrequencyInRegions(buf []byte, writable bool, opts CountOptions) []Word {
+	timings := opts.timings
+
+	// If buffer is too small or we only have 1 counter, process sequentially
+	if len(buf) < 100 || opts.Counters <= 1 {
+		frequency := countChunkTraced(opts, 0, len(buf), func() Frequency {
+			return countWordFrequencyInBytes(buf, writable, opts.preprocessor())
+		})
+		timings.markCounted()
+		return convertFrequencyToWord(frequency)
+	}
+
+	regions := splitBytesAtWordBoundaries(buf, opts.Counters)
+	results := make(chan ChunkResult, len(regions))
+
+	var wg sync.WaitGroup
+
+	// Fan-Out: one counter goroutine per region
+	for i, region := range regions {
+		wg.Go(func() {
+			frequency := countChunkTraced(opts, i, len(region), func() Frequency {
+				return countWordFrequencyInBytes(region, writable, opts.preprocessor())
+			})
+			results <- ChunkResult{
+				frequency: frequency,
+				id:        i,
+			}
+		})
+	}
+
+	go func() {
+		wg.Wait()
+		timings.markCounted()
+		close(results)
+	}()
+
+	// Fan-In: merge region frequencies as the counters finish
+	words := mergeChunkResultsTraced(results, opts, len(regions))
+	timings.mark("merge")
+
+	return words
+}
+
+// countChunkTraced runs count for one chunk of size bytes inside a "count chunk" span
+func countChunkTraced(opts CountOptions, id, size int, count func() Frequency) Frequency {
+	_, span := StartSpan(opts.Context, "count chunk", slog.Int("chunk.id", id), slog.Int("chunk.bytes", size))
+	frequency := count()
+
+	if span != nil {
+		total := 0
+		for _, n := range frequency {
+			total += n
+		}
+		span.SetAttributes(slog.Int("words.total", total), slog.Int("words.distinct", len(frequency)))
+	}
+	span.End(nil)
+
+	return frequency
+}
+
+// mergeChunkResultsTraced merges chunk results inside a "merge" span
+func mergeChunkResultsTraced(results chan ChunkResult, opts CountOptions, mergers int) []Word {
+	_, span := StartSpan(opts.Context, "merge", slog.String("merge.mode", opts.Merge.String()), slog.Int("chunks", mergers))
+	words := mergeChunkResults(results, opts.Merge, mergers)
+	span.SetAttributes(slog.Int("words.distinct", len(words)))
+	span.End(nil)
+
+	return words
 }
 
 func mergeChunkFrequenciesIntoSingleFrequency(results chan ChunkResult) Frequency {
@@ -124,16 +325,40 @@ func convertFrequencyToWord(frequency Frequency) []Word {
 }
 
 // countWordFrequencyInChunk processes a text chunk using pipeline and returns word frequencies
-func countWordFrequencyInChunk(chunk string) map[string]int {
-	// Create preprocessor - pipeline stages will use the package-level sync.Pool
+func countWordFrequencyInChunk(chunk string, mode PipelineMode, tp TextPreprocessor) map[string]int {
+	// Pipeline stages will use the package-level sync.Pool
 	// to reuse string.Builder instances for reduced memory allocations
-	preprocessor := &TextPreprocessor{}
-	words := preprocessor.PreprocessText(chunk)
+	preprocessor := &tp
 
 	// Count word frequencies using a map
 	frequency := make(Frequency)
-	for word := range words {
-		frequency[word]++
+
+	switch mode {
+	case PipelineBatch:
+		for batch := range preprocessor.PreprocessTextBatched(chunk) {
+			for _, word := range *batch {
+				frequency[word]++
+				tp.Cooccurrences.Add(word)
+				tp.MinHasher.Add(word)
+			}
+			// Hand the batch back so the split stage can refill it
+			putWordBatch(batch)
+		}
+	case PipelineFused:
+		for word := range preprocessor.PreprocessTextFused(chunk) {
+			frequency[word]++
+			tp.Cooccurrences.Add(word)
+			tp.MinHasher.Add(word)
+		}
+	case PipelineBytes:
+		// The chunk is a string, so it has to be copied once to get a writable buffer
+		return countWordFrequencyInBytes([]byte(chunk), true, tp)
+	default:
+		for word := range preprocessor.PreprocessText(chunk) {
+			frequency[word]++
+			tp.Cooccurrences.Add(word)
+			tp.MinHasher.Add(word)
+		}
 	}
 
 	return frequency
@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"testing/fstest"
+)
+
+// assetsFS holds the sample files shipped with the project
+var assetsFS = os.DirFS("../assets")
+
+// wordsToFrequency turns CountWordFrequency output back into a map for comparison
+func wordsToFrequency(words []Word) Frequency {
+	frequency := make(Frequency, len(words))
+	for _, w := range words {
+		frequency[w.Word] = w.Count
+	}
+	return frequency
+}
+
+// TestCountWordFrequencyBytesMatchesStream checks the zero-copy path on tricky input
+func TestCountWordFrequencyBytesMatchesStream(t *testing.T) {
+	text := "Hello, WORLD! hello\tworld\n" +
+		"Ünïcödé ÜNÏCÖDÉ straße STRASSE Ⱥpple ⱥpple\n" +
+		"K-9 42 x42 \xff\xfeinvalid\xe2\x82 bytes\r\n" +
+		"İstanbul ıstanbul don't stop-words\n"
+
+	// Repeat the text so CountWordFrequency splits it across counters
+	var content []byte
+	for range 20 {
+		content = append(content, text...)
+	}
+
+	fsys := fstest.MapFS{"tricky.txt": {Data: content}}
+
+	stopwords := loadTestStopwords(t)
+
+	for _, counters := range []int{1, 3} {
+		want, err := CountWordFrequency(fsys, "tricky.txt", CountOptions{Counters: counters, Pipeline: PipelineStream, Stopwords: stopwords})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := CountWordFrequency(fsys, "tricky.txt", CountOptions{Counters: counters, Pipeline: PipelineBytes, Stopwords: stopwords})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !maps.Equal(wordsToFrequency(got), wordsToFrequency(want)) {
+			t.Errorf("counters=%d: bytes path %v, stream path %v", counters, wordsToFrequency(got), wordsToFrequency(want))
+		}
+	}
+}
+
+// TestCountWordFrequencyMmapMatchesReadFile checks that mapped input counts the same words
+func TestCountWordFrequencyMmapMatchesReadFile(t *testing.T) {
+	stats := &RunStats{}
+
+	for _, mode := range []PipelineMode{PipelineFused, PipelineBytes} {
+		want, err := CountWordFrequency(assetsFS, "large.txt", CountOptions{Counters: 4, Pipeline: mode})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := CountWordFrequency(assetsFS, "large.txt", CountOptions{Counters: 4, Pipeline: mode, Input: InputMmap, Stats: stats})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !maps.Equal(wordsToFrequency(got), wordsToFrequency(want)) {
+			t.Errorf("%s pipeline: mmap input counted different words", mode)
+		}
+	}
+
+	if runtime.GOOS == "linux" && stats.MmapFiles.Load() != 2 {
+		t.Errorf("expected 2 mapped files, got %d", stats.MmapFiles.Load())
+	}
+}
+
+// BenchmarkCountWordFrequency measures the whole read-and-count path per pipeline mode,
+// including the file read, so allocation counts cover every copy made along the way
+func BenchmarkCountWordFrequency(b *testing.B) {
+	for _, mode := range []PipelineMode{PipelineStream, PipelineBatch, PipelineFused, PipelineBytes} {
+		b.Run(fmt.Sprint(mode), func(b *testing.B) {
+			b.ReportAllocs()
+			opts := CountOptions{Counters: 1, Pipeline: mode}
+
+			for b.Loop() {
+				if _, err := CountWordFrequency(assetsFS, "large.txt", opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// TestCountWordFrequencyMmapSkipsCompressed checks that a compressed file named directly is read, not mapped
+func TestCountWordFrequencyMmapSkipsCompressed(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("mmap input is only supported on linux")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "big.txt.gz"), bytes.Repeat([]byte("word "), mmapMinSize), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := &RunStats{}
+	if _, err := CountWordFrequency(os.DirFS(dir), "big.txt.gz", CountOptions{Counters: 1, Input: InputMmap, Stats: stats}); err != nil {
+		t.Fatal(err)
+	}
+	if stats.MmapFallbackCompressed.Load() != 1 || stats.MmapFiles.Load() != 0 {
+		t.Errorf("got %d compressed fallbacks and %d mapped files, want 1 and 0", stats.MmapFallbackCompressed.Load(), stats.MmapFiles.Load())
+	}
+}
@@ -0,0 +1,242 @@
+package internal
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// WordChange is the count of a word present in both result sets
+type WordChange struct {
+	Word   string `json:"word"`
+	Before int    `json:"before"`
+	After  int    `json:"after"`
+	// Delta is After - Before
+	Delta int `json:"delta"`
+	// Relative is Delta / Before, so 0.5 means the word occurs 50% more often
+	Relative float64 `json:"relative"`
+}
+
+// FrequencyDiff describes how the words of one file (or the whole corpus) changed
+type FrequencyDiff struct {
+	Name string `json:"name"`
+	// NewWords only occur in the second result set, most frequent first
+	NewWords []Word `json:"new_words"`
+	// VanishedWords only occur in the first result set, most frequent first
+	VanishedWords []Word `json:"vanished_words"`
+	// LargestChanges are ordered by absolute Delta, largest first
+	LargestChanges []WordChange `json:"largest_changes"`
+	// LargestRelativeChanges are ordered by absolute Relative, largest first
+	LargestRelativeChanges []WordChange `json:"largest_relative_changes"`
+}
+
+// ResultDiff is the difference between two result sets
+type ResultDiff struct {
+	AddedFiles   []string `json:"added_files"`
+	RemovedFiles []string `json:"removed_files"`
+	// Files holds the files present in both result sets that changed, ordered by name
+	Files  []FrequencyDiff `json:"files"`
+	Corpus FrequencyDiff   `json:"corpus"`
+}
+
+// DiffResults compares two result sets; every word list is cut to limit entries (0 keeps all)
+// Files are matched by path, or by file name when either side carries no paths at all,
+// as a markdown result written before paths were annotated does.
+func DiffResults(before, after []FileWordFrequency, limit int) ResultDiff {
+	byPath := hasPaths(before) && hasPaths(after)
+	beforeFiles := indexResults(before, byPath)
+	afterFiles := indexResults(after, byPath)
+
+	var diff ResultDiff
+	for _, name := range slices.Sorted(maps.Keys(beforeFiles)) {
+		if _, ok := afterFiles[name]; !ok {
+			diff.RemovedFiles = append(diff.RemovedFiles, name)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(afterFiles)) {
+		beforeWords, ok := beforeFiles[name]
+		if !ok {
+			diff.AddedFiles = append(diff.AddedFiles, name)
+			continue
+		}
+
+		fileDiff := diffFrequencies(name, beforeWords, afterFiles[name], limit)
+		if !fileDiff.empty() {
+			diff.Files = append(diff.Files, fileDiff)
+		}
+	}
+
+	diff.Corpus = diffFrequencies(CorpusSectionName, corpusFrequency(before), corpusFrequency(after), limit)
+
+	return diff
+}
+
+// hasPaths reports whether the results carry their paths. Markdown only annotates the paths
+// of nested files, so a single path is enough; the others are at the top level.
+// An empty result set matches either way.
+func hasPaths(results []FileWordFrequency) bool {
+	return len(results) == 0 || slices.ContainsFunc(results, func(result FileWordFrequency) bool {
+		return result.Path != ""
+	})
+}
+
+// indexResults maps every file to its word counts
+// Results with the same key (a file name seen in several directories) are added up
+func indexResults(results []FileWordFrequency, byPath bool) map[string]Frequency {
+	index := make(map[string]Frequency, len(results))
+	for _, result := range results {
+		name := result.FileName
+		if byPath && result.Path != "" {
+			name = result.Path
+		}
+
+		if index[name] == nil {
+			index[name] = make(Frequency, len(result.Words))
+		}
+		for _, w := range result.Words {
+			index[name][w.Word] += w.Count
+		}
+	}
+	return index
+}
+
+// corpusFrequency adds up the word counts of all results
+func corpusFrequency(results []FileWordFrequency) Frequency {
+	corpus := make(Frequency)
+	for _, result := range results {
+		for _, w := range result.Words {
+			corpus[w.Word] += w.Count
+		}
+	}
+	return corpus
+}
+
+// diffFrequencies compares the word counts of one file or of the corpus
+func diffFrequencies(name string, before, after Frequency, limit int) FrequencyDiff {
+	diff := FrequencyDiff{Name: name}
+	var changes []WordChange
+
+	for word, count := range after {
+		beforeCount, ok := before[word]
+		if !ok {
+			diff.NewWords = append(diff.NewWords, Word{Word: word, Count: count})
+			continue
+		}
+
+		if count != beforeCount {
+			changes = append(changes, WordChange{
+				Word:     word,
+				Before:   beforeCount,
+				After:    count,
+				Delta:    count - beforeCount,
+				Relative: float64(count-beforeCount) / float64(beforeCount),
+			})
+		}
+	}
+
+	for word, count := range before {
+		if _, ok := after[word]; !ok {
+			diff.VanishedWords = append(diff.VanishedWords, Word{Word: word, Count: count})
+		}
+	}
+
+	SortWords(diff.NewWords)
+	SortWords(diff.VanishedWords)
+	diff.NewWords = truncate(diff.NewWords, limit)
+	diff.VanishedWords = truncate(diff.VanishedWords, limit)
+
+	// Ties are broken by word so the output does not depend on map iteration order
+	diff.LargestChanges = truncate(sortedChanges(changes, func(c WordChange) float64 {
+		return math.Abs(float64(c.Delta))
+	}), limit)
+	diff.LargestRelativeChanges = truncate(sortedChanges(changes, func(c WordChange) float64 {
+		return math.Abs(c.Relative)
+	}), limit)
+
+	return diff
+}
+
+// sortedChanges returns a copy of changes ordered by key (descending), then by word
+func sortedChanges(changes []WordChange, key func(WordChange) float64) []WordChange {
+	sorted := slices.Clone(changes)
+	slices.SortFunc(sorted, func(a, b WordChange) int {
+		if c := cmp.Compare(key(b), key(a)); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Word, b.Word)
+	})
+	return sorted
+}
+
+// truncate keeps the first limit elements; a limit of 0 or less keeps all of them
+func truncate[T any](s []T, limit int) []T {
+	if limit > 0 && len(s) > limit {
+		return s[:limit]
+	}
+	return s
+}
+
+// empty reports whether nothing changed
+func (d FrequencyDiff) empty() bool {
+	return len(d.NewWords) == 0 && len(d.VanishedWords) == 0 && len(d.LargestChanges) == 0
+}
+
+// WriteTable writes the diff as aligned plain-text tables
+func (d ResultDiff) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "files added: %d, removed: %d, changed: %d\n", len(d.AddedFiles), len(d.RemovedFiles), len(d.Files))
+	for _, name := range d.AddedFiles {
+		fmt.Fprintf(tw, "  + %s\n", name)
+	}
+	for _, name := range d.RemovedFiles {
+		fmt.Fprintf(tw, "  - %s\n", name)
+	}
+
+	d.Corpus.writeTable(tw)
+	for _, file := range d.Files {
+		file.writeTable(tw)
+	}
+
+	return tw.Flush()
+}
+
+// writeTable writes the sections of one file that have entries
+func (d FrequencyDiff) writeTable(tw *tabwriter.Writer) {
+	fmt.Fprintf(tw, "\n== %s ==\n", d.Name)
+
+	if len(d.NewWords) > 0 {
+		fmt.Fprintln(tw, "new words\tcount\t")
+		for _, w := range d.NewWords {
+			fmt.Fprintf(tw, "  %s\t%d\t\n", w.Word, w.Count)
+		}
+	}
+
+	if len(d.VanishedWords) > 0 {
+		fmt.Fprintln(tw, "vanished words\tcount\t")
+		for _, w := range d.VanishedWords {
+			fmt.Fprintf(tw, "  %s\t%d\t\n", w.Word, w.Count)
+		}
+	}
+
+	writeChanges(tw, "largest changes", d.LargestChanges)
+	writeChanges(tw, "largest relative changes", d.LargestRelativeChanges)
+}
+
+// writeChanges writes one table of word count changes
+func writeChanges(tw *tabwriter.Writer, title string, changes []WordChange) {
+	if len(changes) == 0 {
+		return
+	}
+
+	fmt.Fprintf(tw, "%s\tbefore\tafter\tdelta\trelative\t\n", title)
+	for _, c := range changes {
+		fmt.Fprintf(tw, "  %s\t%d\t%d\t%+d\t%+.1f%%\t\n", c.Word, c.Before, c.After, c.Delta, c.Relative*100)
+	}
+}
@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestParseHumanReadableRoundTrip checks that markdown results parse back to what was written
+func TestParseHumanReadableRoundTrip(t *testing.T) {
+	written := []FileWordFrequency{
+		{FileName: "a.txt", Words: []Word{{"go", 3}, {"rust", 1}}},
+		{FileName: "empty.txt"},
+		{FileName: "b.txt", Words: []Word{{"zig", 2}}},
+	}
+
+	var builder strings.Builder
+	for _, result := range written {
+		builder.WriteString(result.ToHumanReadable())
+	}
+
+	parsed, err := ParseHumanReadable(strings.NewReader(builder.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(parsed) != len(written) {
+		t.Fatalf("got %d results, want %d", len(parsed), len(written))
+	}
+	for i := range written {
+		if parsed[i].FileName != written[i].FileName || !slices.Equal(parsed[i].Words, written[i].Words) {
+			t.Errorf("result %d: got %+v, want %+v", i, parsed[i], written[i])
+		}
+	}
+}
+
+// TestDiffResults checks new, vanished and changed words as well as added and removed files
+func TestDiffResults(t *testing.T) {
+	before := []FileWordFrequency{
+		{FileName: "a.txt", Path: "x/a.txt", Words: []Word{{"go", 10}, {"rust", 2}, {"perl", 1}}},
+		{FileName: "old.txt", Path: "x/old.txt", Words: []Word{{"go", 1}}},
+	}
+	after := []FileWordFrequency{
+		{FileName: "a.txt", Path: "x/a.txt", Words: []Word{{"go", 4}, {"rust", 4}, {"zig", 7}}},
+		{FileName: "new.txt", Path: "x/new.txt", Words: []Word{{"go", 1}}},
+	}
+
+	diff := DiffResults(before, after, 0)
+
+	if !slices.Equal(diff.AddedFiles, []string{"x/new.txt"}) || !slices.Equal(diff.RemovedFiles, []string{"x/old.txt"}) {
+		t.Errorf("got added %v, removed %v", diff.AddedFiles, diff.RemovedFiles)
+	}
+	if len(diff.Files) != 1 {
+		t.Fatalf("got %d changed files, want 1", len(diff.Files))
+	}
+
+	file := diff.Files[0]
+	if !slices.Equal(file.NewWords, []Word{{"zig", 7}}) || !slices.Equal(file.VanishedWords, []Word{{"perl", 1}}) {
+		t.Errorf("got new %v, vanished %v", file.NewWords, file.VanishedWords)
+	}
+
+	// go dropped by 6 (-60%), rust grew by 2 (+100%)
+	if got := file.LargestChanges[0].Word; got != "go" {
+		t.Errorf("largest change: got %q, want go", got)
+	}
+	if got := file.LargestRelativeChanges[0].Word; got != "rust" {
+		t.Errorf("largest relative change: got %q, want rust", got)
+	}
+
+	// Corpus-wide, go went from 11 to 5
+	if len(diff.Corpus.LargestChanges) == 0 || diff.Corpus.LargestChanges[0] != (WordChange{Word: "go", Before: 11, After: 5, Delta: -6, Relative: -6.0 / 11}) {
+		t.Errorf("corpus changes: got %+v", diff.Corpus.LargestChanges)
+	}
+}
+
+// TestDiffResultsMarkdownWithoutPaths checks that markdown written without path annotations
+// is matched by file name against results that carry nested paths
+func TestDiffResultsMarkdownWithoutPaths(t *testing.T) {
+	var builder strings.Builder
+	for _, result := range []FileWordFrequency{
+		{FileName: "a.txt", Words: []Word{{"go", 2}}},
+		{FileName: "old.txt", Words: []Word{{"go", 1}}},
+	} {
+		builder.WriteString(result.ToHumanReadable())
+	}
+
+	before, err := ParseHumanReadable(strings.NewReader(builder.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := []FileWordFrequency{
+		{FileName: "a.txt", Path: "x/a.txt", Words: []Word{{"go", 5}}},
+		{FileName: "new.txt", Path: "x/new.txt", Words: []Word{{"go", 1}}},
+	}
+
+	diff := DiffResults(before, after, 0)
+
+	if !slices.Equal(diff.AddedFiles, []string{"new.txt"}) || !slices.Equal(diff.RemovedFiles, []string{"old.txt"}) {
+		t.Errorf("got added %v, removed %v", diff.AddedFiles, diff.RemovedFiles)
+	}
+	if len(diff.Files) != 1 || diff.Files[0].LargestChanges[0] != (WordChange{Word: "go", Before: 2, After: 5, Delta: 3, Relative: 1.5}) {
+		t.Errorf("got changed files %+v", diff.Files)
+	}
+}
@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"log/slog"
+	"path"
+	"strings"
+
+	"github.com/mdobak/go-xerrors"
+)
+
+// ExtractMode selects how the text to count is extracted from a file
+type ExtractMode int
+
+const (
+	// ExtractPlain counts files as they are and only discovers .txt files
+	ExtractPlain ExtractMode = iota
+	// ExtractAuto picks the extractor from the file extension and also discovers markup files
+	ExtractAuto
+	// ExtractHTML keeps the text of HTML documents, skipping tags, scripts and styles
+	ExtractHTML
+	// ExtractMarkdown strips Markdown syntax such as link targets and code blocks
+	ExtractMarkdown
+	// ExtractJSON keeps the configured string fields of JSON documents and NDJSON logs
+	ExtractJSON
+)
+
+// String returns the command line name of the mode
+func (m ExtractMode) String() string {
+	switch m {
+	case ExtractAuto:
+		return "auto"
+	case ExtractHTML:
+		return "html"
+	case ExtractMarkdown:
+		return "markdown"
+	case ExtractJSON:
+		return "json"
+	}
+	return "plain"
+}
+
+// ParseExtractMode converts a command line name into an ExtractMode
+func ParseExtractMode(name string) (ExtractMode, error) {
+	switch name {
+	case "auto":
+		return ExtractAuto, nil
+	case "plain":
+		return ExtractPlain, nil
+	case "html":
+		return ExtractHTML, nil
+	case "markdown":
+		return ExtractMarkdown, nil
+	case "json":
+		return ExtractJSON, nil
+	}
+	return 0, xerrors.Newf("unknown extract mode %q (expected auto, plain, html, markdown or json)", name)
+}
+
+// ExtractOptions configures the extraction stage that runs before preprocessing
+type ExtractOptions struct {
+	Mode ExtractMode
+	// JSONFields are the string fields kept by the JSON extractor, either a key
+	// matched at any depth ("message") or a dotted path from the root ("request.body")
+	JSONFields []string
+}
+
+// markupExtensions maps the extensions discovered in auto mode to their extractor
+var markupExtensions = map[string]ExtractMode{
+	".html":     ExtractHTML,
+	".htm":      ExtractHTML,
+	".xhtml":    ExtractHTML,
+	".md":       ExtractMarkdown,
+	".markdown": ExtractMarkdown,
+	".json":     ExtractJSON,
+	".ndjson":   ExtractJSON,
+	".jsonl":    ExtractJSON,
+}
+
+// modeFor returns the extractor used for name; it is never ExtractAuto
+func (o ExtractOptions) modeFor(name string) ExtractMode {
+	if o.Mode != ExtractAuto {
+		return o.Mode
+	}
+
+	if mode, ok := markupExtensions[strings.ToLower(path.Ext(name))]; ok {
+		return mode
+	}
+	return ExtractPlain
+}
+
+// IsInputFile reports whether name is discovered for analysis: text files always,
+// markup files in auto mode, and the files of a forced extractor's own format
+// (e.g. .md and .markdown files with ExtractMarkdown)
+func (o ExtractOptions) IsInputFile(name string) bool {
+	if IsTxtFile(name) {
+		return true
+	}
+
+	mode, ok := markupExtensions[strings.ToLower(path.Ext(name))]
+	return ok && (o.Mode == ExtractAuto || o.Mode == mode)
+}
+
+// extractInput replaces the content of a file by the text its extractor keeps.
+// Plain files are returned unchanged; otherwise the raw input is released and
+// the extracted text, a fresh heap buffer, is writable.
+func extractInput(name string, input fileInput, opts CountOptions) (fileInput, error) {
+	mode := opts.Extract.modeFor(name)
+	if mode == ExtractPlain {
+		return input, nil
+	}
+
+	text, skipped, err := extractText(mode, input.data, opts.Extract.JSONFields)
+	if releaseErr := input.release(); releaseErr != nil && err == nil {
+		err = releaseErr
+	}
+	if err != nil {
+		return fileInput{}, xerrors.Newf("failed to extract %s text from a file %q: %w", mode, name, err)
+	}
+
+	if skipped > 0 {
+		opts.Stats.addSkippedJSONLines(skipped)
+		slog.WarnContext(opts.logContext(), "skipped malformed JSON lines", slog.String("file", name), slog.Int("lines", skipped))
+	}
+
+	return fileInput{
+		data:     text,
+		writable: true,
+		method:   input.method,
+		release:  func() error { return nil },
+	}, nil
+}
+
+// ExtractText runs the extractor of mode over data, which is not modified.
+// ExtractPlain and ExtractAuto return data unchanged. Malformed lines of NDJSON
+// input are skipped.
+func ExtractText(mode ExtractMode, data []byte, jsonFields []string) ([]byte, error) {
+	text, _, err := extractText(mode, data, jsonFields)
+	return text, err
+}
+
+// extractText is ExtractText that also returns the number of skipped NDJSON lines
+func extractText(mode ExtractMode, data []byte, jsonFields []string) ([]byte, int, error) {
+	switch mode {
+	case ExtractHTML:
+		return extractHTML(data), 0, nil
+	case ExtractMarkdown:
+		return extractMarkdown(data), 0, nil
+	case ExtractJSON:
+		return extractJSON(data, jsonFields)
+	}
+	return data, 0, nil
+}
@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// TestExtractText checks that markup and field names do not reach the counts
+func TestExtractText(t *testing.T) {
+	tests := []struct {
+		name   string
+		mode   ExtractMode
+		input  string
+		fields []string
+		want   string
+	}{
+		{
+			name:  "html",
+			mode:  ExtractHTML,
+			input: `<p class="a" title='x>y'>Fast&amp;cheap</p><SCRIPT>var href;</SCRIPT><style>div{}</style>a < b<!-- div -->`,
+			want:  "fast cheap a b",
+		},
+		{
+			name:  "markdown",
+			mode:  ExtractMarkdown,
+			input: "# Title\nSee [docs](https://go.dev) <https://x.org> http://y.org <b>bold</b>\n```\nhref code\n```\n[id]: http://z.org\n",
+			want:  "title see docs bold",
+		},
+		{
+			name:   "ndjson",
+			mode:   ExtractJSON,
+			input:  `{"msg":"queue full","level":"warn"}` + "\n" + `{"req":{"body":"slow disk","id":"x"},"other":{"msg":["retry"]}}`,
+			fields: []string{"msg", "req.body"},
+			want:   "queue full retry slow disk",
+		},
+		{
+			name:   "json array",
+			mode:   ExtractJSON,
+			input:  `[{"text":"one"},{"text":"two","message":3}]`,
+			fields: []string{"text", "message"},
+			want:   "one two",
+		},
+	}
+
+	for _, tt := range tests {
+		text, err := ExtractText(tt.mode, []byte(tt.input), tt.fields)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		var words []string
+		for word := range (&TextPreprocessor{}).PreprocessTextFused(string(text)) {
+			words = append(words, word)
+		}
+		if got := strings.Join(words, " "); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := ExtractText(ExtractJSON, []byte(`{"msg":`), nil); err == nil {
+		t.Error("expected an error for truncated JSON")
+	}
+
+	// A malformed log line is skipped without losing the lines around it
+	text, skipped, err := extractText(ExtractJSON, []byte(`{"msg":"one"}`+"\n"+`{"msg":`+"\n"+`{"msg":"two"}`), DefaultJSONFields)
+	if err != nil || skipped != 1 || string(text) != "one\ntwo\n" {
+		t.Errorf("ndjson with a bad line: got %q, %d skipped, error %v", text, skipped, err)
+	}
+}
+
+// TestGetInputFilesByExtractMode checks that markup files are discovered in auto mode and by their own forced extractor
+func TestGetInputFilesByExtractMode(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.txt":          {Data: []byte("a")},
+		"page.HTML":      {Data: []byte("<p>b</p>")},
+		"docs/readme.md": {Data: []byte("c")},
+		"logs/app.jsonl": {Data: []byte(`{"msg":"d"}`)},
+		"image.png":      {Data: []byte{0x89}},
+	}
+
+	auto, err := GetInputFiles(fsys, ExtractOptions{Mode: ExtractAuto})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a.txt", "docs/readme.md", "logs/app.jsonl", "page.HTML"}; !slices.Equal(auto, want) {
+		t.Errorf("auto: got %v, want %v", auto, want)
+	}
+
+	html, err := GetInputFiles(fsys, ExtractOptions{Mode: ExtractHTML})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a.txt", "page.HTML"}; !slices.Equal(html, want) {
+		t.Errorf("html: got %v, want %v", html, want)
+	}
+
+	plain, err := GetInputFiles(fsys, ExtractOptions{Mode: ExtractPlain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a.txt"}; !slices.Equal(plain, want) {
+		t.Errorf("plain: got %v, want %v", plain, want)
+	}
+}
@@ -0,0 +1,127 @@
+package internal
+
+import (
+	"bytes"
+	"html"
+)
+
+// htmlRawTextElements hold code or styling instead of text, so their content is skipped
+var htmlRawTextElements = []string{"script", "style"}
+
+// extractHTML returns the text of an HTML document.
+// Tags, attributes and comments are replaced by spaces so neighbouring words stay
+// apart, script and style contents are skipped and entities are decoded.
+func extractHTML(data []byte) []byte {
+	var out bytes.Buffer
+	out.Grow(len(data))
+
+	for i := 0; i < len(data); {
+		// Text runs up to the next tag
+		if data[i] != '<' {
+			end := bytes.IndexByte(data[i:], '<')
+			if end < 0 {
+				end = len(data) - i
+			}
+			out.WriteString(html.UnescapeString(string(data[i : i+end])))
+			i += end
+			continue
+		}
+
+		rest := data[i:]
+		switch {
+		case bytes.HasPrefix(rest, []byte("<!--")):
+			i += skipPast(rest, "-->")
+			out.WriteByte(' ')
+			continue
+
+		case len(rest) < 2 || !isTagStart(rest[1]):
+			// A lone '<' such as in "a < b" is text
+			out.WriteByte('<')
+			i++
+			continue
+		}
+
+		name, closing := htmlTagName(rest)
+		i += htmlTagEnd(rest)
+		out.WriteByte(' ')
+
+		// Skip everything up to the matching end tag of script and style elements
+		for _, element := range htmlRawTextElements {
+			if !closing && name == element {
+				end := indexFold(data[i:], "</"+element)
+				if end < 0 {
+					i = len(data)
+					break
+				}
+				i += end
+				i += htmlTagEnd(data[i:])
+			}
+		}
+	}
+
+	return out.Bytes()
+}
+
+// isTagStart reports whether the byte after '<' starts a tag, end tag, comment or declaration
+func isTagStart(c byte) bool {
+	return c == '/' || c == '!' || c == '?' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// htmlTagName returns the lowercased name of the tag at the start of tag and whether it is an end tag
+func htmlTagName(tag []byte) (string, bool) {
+	tag = tag[1:]
+	closing := len(tag) > 0 && tag[0] == '/'
+	if closing {
+		tag = tag[1:]
+	}
+
+	end := 0
+	for end < len(tag) && isASCIIAlphanumeric(tag[end]) {
+		end++
+	}
+
+	return string(bytes.ToLower(tag[:end])), closing
+}
+
+// isASCIIAlphanumeric reports whether c can be part of a tag name
+func isASCIIAlphanumeric(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+// htmlTagEnd returns the length of the tag at the start of tag, ignoring '>' inside quoted attributes
+func htmlTagEnd(tag []byte) int {
+	var quote byte
+	for i := 1; i < len(tag); i++ {
+		switch c := tag[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return i + 1
+		}
+	}
+	return len(tag)
+}
+
+// skipPast returns the length of data up to and including the first terminator
+func skipPast(data []byte, terminator string) int {
+	end := bytes.Index(data, []byte(terminator))
+	if end < 0 {
+		return len(data)
+	}
+	return end + len(terminator)
+}
+
+// indexFold is bytes.Index for an ASCII needle, ignoring case
+func indexFold(data []byte, needle string) int {
+	pattern := []byte(needle)
+	for i := 0; i+len(pattern) <= len(data); i++ {
+		if bytes.EqualFold(data[i:i+len(pattern)], pattern) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,112 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/mdobak/go-xerrors"
+)
+
+// extractJSON keeps the string values of the configured fields of a JSON document,
+// a JSON array or a stream of JSON values such as NDJSON logs. Field names and
+// all other values are dropped. Each kept value goes on its own line.
+// When the input does not decode as a whole, every line is decoded on its own and
+// malformed lines are skipped and counted, so one broken log line does not lose
+// the rest of the file. It fails only if no line decodes at all.
+func extractJSON(data []byte, fields []string) ([]byte, int, error) {
+	var out bytes.Buffer
+	wanted := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		wanted[field] = true
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var value any
+		err := decoder.Decode(&value)
+		if err == io.EOF {
+			return out.Bytes(), 0, nil
+		}
+		if err != nil {
+			return extractJSONLines(data, wanted, xerrors.Newf("invalid JSON at byte %d: %w", decoder.InputOffset(), err))
+		}
+
+		collectJSONFields(&out, value, "", wanted, false)
+	}
+}
+
+// extractJSONLines decodes every non-empty line of data as a JSON value of its own,
+// returning the number of lines skipped as malformed. streamErr is returned when no
+// line is valid, as the input is then more likely a broken document than a log.
+func extractJSONLines(data []byte, wanted map[string]bool, streamErr error) ([]byte, int, error) {
+	var out bytes.Buffer
+	valid, skipped := 0, 0
+
+	for line := range bytes.Lines(data) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		var value any
+		if err := json.Unmarshal(line, &value); err != nil {
+			skipped++
+			continue
+		}
+
+		valid++
+		collectJSONFields(&out, value, "", wanted, false)
+	}
+
+	if valid == 0 {
+		return nil, 0, streamErr
+	}
+	return out.Bytes(), skipped, nil
+}
+
+// collectJSONFields walks value and writes the strings found under wanted fields.
+// Object keys are visited in sorted order so the extracted text is deterministic.
+func collectJSONFields(out *bytes.Buffer, value any, path string, wanted map[string]bool, keep bool) {
+	switch v := value.(type) {
+	case string:
+		if keep {
+			out.WriteString(v)
+			out.WriteByte('\n')
+		}
+
+	case []any:
+		for _, element := range v {
+			collectJSONFields(out, element, path, wanted, keep)
+		}
+
+	case map[string]any:
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			keyPath := key
+			if path != "" {
+				keyPath = path + "." + key
+			}
+
+			// A field matches by its key at any depth or by its full dotted path
+			matched := keep || wanted[key] || wanted[keyPath]
+			collectJSONFields(out, v[key], keyPath, wanted, matched)
+		}
+	}
+}
+
+// DefaultJSONFields are the fields kept by the JSON extractor when none are configured
+var DefaultJSONFields = []string{"message", "msg", "text"}
+
+// ParseJSONFields splits a comma-separated list of JSON fields
+func ParseJSONFields(list string) []string {
+	var fields []string
+	for field := range strings.SplitSeq(list, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
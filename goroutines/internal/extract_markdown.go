@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+)
+
+// Markdown syntax whose words are not part of the prose
+var (
+	// markdownReferenceDefinition matches link definitions such as `[id]: https://example.com "Title"`
+	markdownReferenceDefinition = regexp.MustCompile(`^\s{0,3}\[[^\]]+\]:\s*\S+.*$`)
+	// markdownInlineLink matches links and images, keeping the link text or alt text
+	markdownInlineLink = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+	// markdownReferenceLink matches `[text][id]`, keeping the link text
+	markdownReferenceLink = regexp.MustCompile(`\[([^\]]*)\]\[[^\]]*\]`)
+	// markdownAutolink matches `<https://...>` and `<user@example.com>`
+	markdownAutolink = regexp.MustCompile(`<[a-zA-Z][a-zA-Z0-9+.-]*:[^>\s]*>|<[^>\s@]+@[^>\s]+>`)
+	// markdownHTMLTag matches inline HTML tags
+	markdownHTMLTag = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	// markdownBareURL matches URLs written without any markup
+	markdownBareURL = regexp.MustCompile(`\b(?:https?|ftp)://\S+|\bwww\.\S+`)
+)
+
+// markdownFences open and close fenced code blocks
+var markdownFences = [][]byte{[]byte("```"), []byte("~~~")}
+
+// extractMarkdown strips Markdown syntax that would otherwise be counted as words:
+// fenced code blocks, link targets, reference definitions, autolinks, URLs and
+// inline HTML. Emphasis and heading markers need no stripping, as punctuation
+// is dropped by the preprocessing pipeline anyway.
+func extractMarkdown(data []byte) []byte {
+	var out bytes.Buffer
+	out.Grow(len(data))
+
+	var fence []byte
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		trimmed := bytes.TrimLeft(line, " \t")
+
+		// Code is not prose: skip fenced blocks, keeping the line count intact
+		if fence != nil {
+			if bytes.HasPrefix(trimmed, fence) {
+				fence = nil
+			}
+			out.WriteByte('\n')
+			continue
+		}
+		if opening := markdownFence(trimmed); opening != nil {
+			fence = opening
+			out.WriteByte('\n')
+			continue
+		}
+
+		if markdownReferenceDefinition.Match(line) {
+			out.WriteByte('\n')
+			continue
+		}
+
+		line = markdownInlineLink.ReplaceAll(line, []byte("$1"))
+		line = markdownReferenceLink.ReplaceAll(line, []byte("$1"))
+		line = markdownAutolink.ReplaceAll(line, []byte(" "))
+		line = markdownHTMLTag.ReplaceAll(line, []byte(" "))
+		line = markdownBareURL.ReplaceAll(line, []byte(" "))
+
+		out.Write(line)
+		out.WriteByte('\n')
+	}
+
+	return out.Bytes()
+}
+
+// markdownFence returns the fence a line opens, or nil
+func markdownFence(line []byte) []byte {
+	for _, fence := range markdownFences {
+		if bytes.HasPrefix(line, fence) {
+			return fence
+		}
+	}
+	return nil
+}
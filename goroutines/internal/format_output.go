@@ -1,26 +1,31 @@
 package internal
 
 import (
+	"cmp"
 	"fmt"
-	"sort"
+	"slices"
 	"strings"
 )
 
 // FileWordFrequency represents the result format for word frequency analysis
 type FileWordFrequency struct {
 	FileName string `json:"file_name"`
-	Words    []Word `json:"words"`
+	// Path is the slash-separated path of the file within the analysed file system
+	Path  string `json:"path,omitempty"`
+	Words []Word `json:"words"`
+	// Approximate is set when Words are top-K estimates instead of exact counts
+	Approximate *ApproximateStats `json:"approximate,omitempty"`
+	// Collocations holds the most associated word pairs; only set in collocation mode
+	Collocations *CollocationStats `json:"collocations,omitempty"`
+	// Readability holds sentence and vocabulary metrics; only set when readability is measured
+	Readability *ReadabilityStats `json:"readability,omitempty"`
+	// Redactions holds the number of redacted matches per class; only set when the file had any
+	Redactions map[string]int `json:"redactions,omitempty"`
 }
 
 // ToHumanReadable converts the struct to human-readable format with sorted words
 func (f FileWordFrequency) ToHumanReadable() string {
-	// Sort by frequency (descending), then by word (ascending) for ties
-	sort.Slice(f.Words, func(i, j int) bool {
-		if f.Words[i].Count != f.Words[j].Count {
-			return f.Words[i].Count > f.Words[j].Count // Higher frequency first
-		}
-		return f.Words[i].Word < f.Words[j].Word // Alphabetical order for ties
-	})
+	SortWords(f.Words)
 
 	// Use strings.Builder for efficient string concatenation
 	var builder strings.Builder
@@ -34,13 +39,107 @@ func (f FileWordFrequency) ToHumanReadable() string {
 	builder.WriteString(f.FileName)
 	builder.WriteString(":\n")
 
-	for _, w := range f.Words {
-		builder.WriteString("\t")
-		builder.WriteString(w.Word)
-		builder.WriteString(": ")
-		builder.WriteString(fmt.Sprintf("%d", w.Count))
-		builder.WriteString("\n")
+	// The path tells apart files of the same name in different directories when results are read back
+	if f.Path != "" && f.Path != f.FileName {
+		fmt.Fprintf(&builder, "\t(path: %s)\n", f.Path)
+	}
+
+	if f.Readability != nil {
+		writeReadability(&builder, f.Readability)
+	}
+
+	if len(f.Redactions) > 0 {
+		fmt.Fprintf(&builder, "\t(redactions: %s)\n", RedactionsToHumanReadable(f.Redactions))
+	}
+
+	if f.Approximate != nil {
+		writeApproximateBounds(&builder, f.Approximate)
+	} else {
+		for _, w := range f.Words {
+			builder.WriteString("\t")
+			builder.WriteString(w.Word)
+			builder.WriteString(": ")
+			builder.WriteString(fmt.Sprintf("%d", w.Count))
+			builder.WriteString("\n")
+		}
+	}
+
+	if f.Collocations != nil {
+		writeCollocations(&builder, f.Collocations)
 	}
 
 	return builder.String()
 }
+
+// readabilityCounts is the leading part of the readability annotation, read back by parseReadability
+const readabilityCounts = "%d sentences, %d words, %d syllables, %d distinct words, %d hapax legomena"
+
+// writeReadability writes the readability metrics as an annotation line.
+// The counts come first, as the scores are rounded and are recomputed from them when read back.
+func writeReadability(builder *strings.Builder, stats *ReadabilityStats) {
+	fmt.Fprintf(builder, "\t(readability: "+readabilityCounts+", %.1f words per sentence, %.2f syllables per word, Flesch reading ease %.1f, Flesch-Kincaid grade %.1f, type/token ratio %.3f)\n",
+		stats.Sentences,
+		stats.Words,
+		stats.Syllables,
+		stats.DistinctWords,
+		stats.HapaxLegomena,
+		stats.AverageSentenceLength,
+		stats.SyllablesPerWord,
+		stats.FleschReadingEase,
+		stats.FleschKincaidGrade,
+		stats.TypeTokenRatio,
+	)
+}
+
+// writeCollocations writes the top word pairs, indented one level deeper than the words
+func writeCollocations(builder *strings.Builder, stats *CollocationStats) {
+	fmt.Fprintf(builder, "\t(collocations: window %d, at least %d times, %d pairs in %d distinct",
+		stats.Window, stats.MinCount, stats.Pairs, stats.DistinctPairs)
+	if stats.PrunedPairs > 0 {
+		fmt.Fprintf(builder, ", %d rare pairs pruned, counts low by at most %d", stats.PrunedPairs, stats.MaxUndercount)
+	}
+	builder.WriteString(")\n")
+
+	for _, c := range stats.Top {
+		fmt.Fprintf(builder, "\t\t%s %s: %d (pmi %.2f, llr %.1f)\n", c.A, c.B, c.Count, c.PMI, c.LogLikelihood)
+	}
+}
+
+// writeApproximateBounds writes the error bounds followed by the top-K words with their count ranges
+func writeApproximateBounds(builder *strings.Builder, stats *ApproximateStats) {
+	fmt.Fprintf(builder, "\t(approximate: %d words, ~%d distinct ±%.1f%%, counts overestimated by at most %d with %.1f%% confidence, %d bytes of sketches)\n",
+		stats.TotalWords,
+		stats.DistinctWords,
+		stats.DistinctStdError*100,
+		stats.CountErrorBound,
+		stats.CountConfidence*100,
+		stats.MemoryBytes,
+	)
+
+	for _, w := range stats.TopK {
+		fmt.Fprintf(builder, "\t%s: ~%d (at least %d)\n", w.Word, w.Count, w.MinCount)
+	}
+}
+
+// SortWords sorts by frequency (descending), then by word (ascending) for ties
+// The sort is stable, so equal entries keep their relative order
+func SortWords(words []Word) {
+	slices.SortStableFunc(words, func(a, b Word) int {
+		if a.Count != b.Count {
+			return cmp.Compare(b.Count, a.Count) // Higher frequency first
+		}
+		return strings.Compare(a.Word, b.Word) // Alphabetical order for ties
+	})
+}
+
+// SortFileResults orders results by path, with sorted words inside every result
+// Together with SortWords this makes output independent of worker scheduling
+func SortFileResults(results []FileWordFrequency) {
+	for _, result := range results {
+		SortWords(result.Words)
+	}
+
+	slices.SortStableFunc(results, func(a, b FileWordFrequency) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+}
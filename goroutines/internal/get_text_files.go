@@ -1,31 +1,41 @@
 package internal
 
 import (
-	"os"
-	"path/filepath"
+	"errors"
+	"io/fs"
+	"path"
 	"strings"
 
 	"github.com/mdobak/go-xerrors"
 )
 
-// GetTxtFiles returns a list of all .txt file paths in the given directory
-func GetTxtFiles(directoryPath string) ([]string, error) {
+// GetTxtFiles returns a list of all .txt file paths in fsys
+// Paths are slash-separated and relative to the root of fsys, ready for fsys.Open
+func GetTxtFiles(fsys fs.FS) ([]string, error) {
+	return GetInputFiles(fsys, ExtractOptions{Mode: ExtractPlain})
+}
+
+// GetInputFiles returns the paths of all files in fsys that extract can read:
+// .txt files, and in auto mode HTML, Markdown and JSON files as well
+func GetInputFiles(fsys fs.FS, extract ExtractOptions) ([]string, error) {
 	var txtFiles []string
 
-	// Check if directory exists
-	if _, err := os.Stat(directoryPath); os.IsNotExist(err) {
-		return nil, xerrors.Newf("directory does not exist: %s: %w", directoryPath, err)
+	// Check if the root exists
+	if _, err := fs.Stat(fsys, "."); errors.Is(err, fs.ErrNotExist) {
+		return nil, xerrors.Newf("directory does not exist: %w", err)
+	} else if err != nil {
+		return nil, xerrors.Newf("failed to open directory: %w", err)
 	}
 
-	// Walk through the directory
-	err := filepath.Walk(directoryPath, func(path string, info os.FileInfo, err error) error {
+	// Walk through the file system
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
-		// Check if it's a file and has .txt extension
-		if !info.IsDir() && strings.ToLower(filepath.Ext(path)) == ".txt" {
-			txtFiles = append(txtFiles, path)
+		// Check if it's a file with a supported extension
+		if !entry.IsDir() && extract.IsInputFile(name) {
+			txtFiles = append(txtFiles, name)
 		}
 
 		return nil
@@ -37,3 +47,8 @@ func GetTxtFiles(directoryPath string) ([]string, error) {
 
 	return txtFiles, nil
 }
+
+// IsTxtFile reports whether name is a text file
+func IsTxtFile(name string) bool {
+	return strings.ToLower(path.Ext(name)) == ".txt"
+}
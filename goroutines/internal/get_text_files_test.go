@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+// TestGetTxtFilesMapFS checks discovery without touching the local disk
+func TestGetTxtFilesMapFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.txt":             {Data: []byte("alpha")},
+		"notes.md":          {Data: []byte("skipped")},
+		"logs/B.TXT":        {Data: []byte("beta")},
+		"logs/old.txt.gz":   {Data: []byte{0x1f, 0x8b}},
+		"logs/deep/c.txt":   {Data: []byte("gamma")},
+		"logs/deep/c.txt~":  {Data: []byte("skipped")},
+		"logs/deep/img.png": {Data: []byte{0x89}},
+	}
+
+	got, err := GetTxtFiles(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"a.txt", "logs/B.TXT", "logs/deep/c.txt"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// TestOverlayFSShadowsLowerLayers checks that earlier layers win and directories are merged
+func TestOverlayFSShadowsLowerLayers(t *testing.T) {
+	upper := fstest.MapFS{"docs/a.txt": {Data: []byte("upper")}}
+	lower := fstest.MapFS{
+		"docs/a.txt": {Data: []byte("lower")},
+		"docs/b.txt": {Data: []byte("lower only")},
+	}
+	overlay := OverlayFS{upper, lower}
+
+	content, err := fs.ReadFile(overlay, "docs/a.txt")
+	if err != nil || string(content) != "upper" {
+		t.Errorf("docs/a.txt: got %q (%v), want upper layer content", content, err)
+	}
+
+	files, err := GetTxtFiles(overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"docs/a.txt", "docs/b.txt"}; !slices.Equal(files, want) {
+		t.Errorf("got %v, want %v", files, want)
+	}
+
+	if err := fstest.TestFS(overlay, "docs/a.txt", "docs/b.txt"); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestOpenArchive checks that zip, tar and compressed tar archives expose the same files,
+// and that a name repeated in a tar archive is listed once with its last contents
+func TestOpenArchive(t *testing.T) {
+	files := map[string]string{
+		"top.txt":        "top level",
+		"nested/one.txt": "nested file",
+	}
+	dir := t.TempDir()
+
+	writeArchive := func(name string, write func(io.Writer)) string {
+		path := filepath.Join(dir, name)
+		file, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		write(file)
+		if err := file.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	zipPath := writeArchive("corpus.zip", func(w io.Writer) {
+		archive := zip.NewWriter(w)
+		for name, content := range files {
+			entry, _ := archive.Create(name)
+			entry.Write([]byte(content))
+		}
+		archive.Close()
+	})
+
+	// An outdated copy of top.txt comes first, as when files are appended to an archive
+	writeTar := func(w io.Writer) {
+		archive := tar.NewWriter(w)
+		write := func(name, content string) {
+			archive.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+			archive.Write([]byte(content))
+		}
+		write("top.txt", "outdated top level copy")
+		for name, content := range files {
+			write(name, content)
+		}
+		archive.Close()
+	}
+
+	tarPath := writeArchive("corpus.tar", writeTar)
+	tarGzPath := writeArchive("corpus.tar.gz", func(w io.Writer) {
+		compressed := gzip.NewWriter(w)
+		writeTar(compressed)
+		compressed.Close()
+	})
+
+	for _, path := range []string{zipPath, tarPath, tarGzPath} {
+		fsys, closer, err := OpenArchive(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := fstest.TestFS(fsys, "top.txt", "nested/one.txt"); err != nil {
+			t.Errorf("%s: %v", filepath.Base(path), err)
+		}
+
+		words, err := CountWordFrequency(fsys, "nested/one.txt", CountOptions{Counters: 1})
+		if err != nil || len(words) != 2 {
+			t.Errorf("%s: counted %v (%v), want 2 words", filepath.Base(path), words, err)
+		}
+
+		inputs, err := GetInputFiles(fsys, ExtractOptions{})
+		if err != nil || !slices.Equal(inputs, []string{"nested/one.txt", "top.txt"}) {
+			t.Errorf("%s: got input files %v (%v)", filepath.Base(path), inputs, err)
+		}
+		if content, err := fs.ReadFile(fsys, "top.txt"); err != nil || string(content) != files["top.txt"] {
+			t.Errorf("%s: got top.txt %q (%v), want %q", filepath.Base(path), content, err, files["top.txt"])
+		}
+
+		closer.Close()
+	}
+}
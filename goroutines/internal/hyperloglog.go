@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"math"
+	"math/bits"
+)
+
+// hyperLogLog estimates the number of distinct words in 2^precision bytes.
+// The standard error of the estimate is 1.04/sqrt(2^precision).
+type hyperLogLog struct {
+	precision uint8
+	registers []uint8
+}
+
+// newHyperLogLog picks the largest precision (4..16) whose registers fit into budget bytes
+func newHyperLogLog(budget int64) *hyperLogLog {
+	precision := uint8(4)
+	for precision < 16 && int64(1)<<(precision+1) <= budget {
+		precision++
+	}
+
+	return &hyperLogLog{
+		precision: precision,
+		registers: make([]uint8, 1<<precision),
+	}
+}
+
+// Add records a hashed word
+func (h *hyperLogLog) Add(hash uint64) {
+	// The top bits choose the register, the rest feed the leading-zero count
+	idx := hash >> (64 - h.precision)
+	rest := hash<<h.precision | 1<<(h.precision-1)
+	rank := uint8(bits.LeadingZeros64(rest)) + 1
+
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+// Merge keeps the register-wise maximum of another HyperLogLog with the same precision
+func (h *hyperLogLog) Merge(other *hyperLogLog) {
+	for i, rank := range other.registers {
+		h.registers[i] = max(h.registers[i], rank)
+	}
+}
+
+// Estimate returns the estimated number of distinct words
+func (h *hyperLogLog) Estimate() uint64 {
+	m := float64(len(h.registers))
+
+	sum := 0.0
+	zeros := 0
+	for _, rank := range h.registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+
+	estimate := hllAlpha(len(h.registers)) * m * m / sum
+
+	// Small range correction: linear counting is more accurate while registers are still empty
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+
+	return uint64(estimate + 0.5)
+}
+
+// StandardError is the relative standard error of Estimate
+func (h *hyperLogLog) StandardError() float64 {
+	return 1.04 / math.Sqrt(float64(len(h.registers)))
+}
+
+// Bytes returns the memory used by the registers
+func (h *hyperLogLog) Bytes() int64 {
+	return int64(len(h.registers))
+}
+
+// hllAlpha is the bias correction constant for m registers
+func hllAlpha(m int) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	}
+	return 0.7213 / (1 + 1.079/float64(m))
+}
@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/mdobak/go-xerrors"
+)
+
+// InputDigest identifies the exact content of one input file
+type InputDigest struct {
+	Path string `json:"path"`
+	// Size is the size of the raw (possibly compressed) content
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// InputDigests records the content hash of every file read during a run
+// Like RunStats it is a sink shared by all workers, and a nil value records nothing
+type InputDigests struct {
+	mu      sync.Mutex
+	digests map[string]InputDigest
+}
+
+// record hashes the raw content of a file as it is read
+func (d *InputDigests) record(path string, content []byte) {
+	if d == nil {
+		return
+	}
+
+	sum := sha256.Sum256(content)
+	d.Add(InputDigest{Path: path, Size: int64(len(content)), SHA256: hex.EncodeToString(sum[:])})
+}
+
+// Add records a digest computed elsewhere, e.g. by DigestFile
+func (d *InputDigests) Add(digest InputDigest) {
+	if d == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.digests == nil {
+		d.digests = make(map[string]InputDigest)
+	}
+	d.digests[digest.Path] = digest
+}
+
+// DigestFile hashes the raw content of a file of fsys without loading it whole
+func DigestFile(fsys fs.FS, path string) (InputDigest, error) {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return InputDigest{}, xerrors.Newf("failed to open a file %q: %w", path, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return InputDigest{}, xerrors.Newf("failed to read a file %q: %w", path, err)
+	}
+
+	return InputDigest{Path: path, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// Get returns the digest recorded for path
+func (d *InputDigests) Get(path string) (InputDigest, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	digest, ok := d.digests[path]
+	return digest, ok
+}
+
+// All returns every recorded digest ordered by path
+func (d *InputDigests) All() []InputDigest {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	all := make([]InputDigest, 0, len(d.digests))
+	for _, digest := range d.digests {
+		all = append(all, digest)
+	}
+	slices.SortFunc(all, func(a, b InputDigest) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return all
+}
@@ -0,0 +1,191 @@
+package internal
+
+import (
+	"cmp"
+	"compress/gzip"
+	"encoding/gob"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/DonAlexandro/go_advanced/pkg"
+	"github.com/mdobak/go-xerrors"
+)
+
+// Occurrence is one place where an indexed word occurs
+type Occurrence struct {
+	// File is the position of the file in InvertedIndex.Files
+	File int
+	// Position is the ordinal of the word in the file, counting stopwords too
+	Position int
+	// Line is the 1-based line of the word
+	Line int
+	// Offset is the byte offset of the word in the file
+	Offset int
+}
+
+// IndexedFile is a file of the index together with its text, used for snippets
+type IndexedFile struct {
+	Path string
+	Text string
+}
+
+// InvertedIndex maps every word to the places where it occurs.
+// Workers add files concurrently; Sort must be called once all files are added.
+type InvertedIndex struct {
+	mu sync.Mutex
+
+	Files []IndexedFile
+	// Postings are ordered by file and position once the index is sorted
+	Postings map[string][]Occurrence
+	// Stopwords are the words left out of the index; phrase queries skip them
+	Stopwords []string
+	// Rules normalise words the way the counts were normalised; queries are normalised by the
+	// same rules, so they are saved with the index. MinCount does not apply to the index.
+	Rules *TokenRules
+
+	// stopwords is the set form of Stopwords
+	stopwords pkg.StopwordSet
+}
+
+// NewInvertedIndex creates an empty index that leaves out stopwords and normalises words by rules,
+// which may be nil
+func NewInvertedIndex(stopwords pkg.StopwordSet, rules *TokenRules) *InvertedIndex {
+	index := &InvertedIndex{Postings: make(map[string][]Occurrence), Rules: rules, stopwords: stopwords}
+	for word := range stopwords {
+		index.Stopwords = append(index.Stopwords, word)
+	}
+	slices.Sort(index.Stopwords)
+	return index
+}
+
+// AddFile tokenises text and records the positions of its words; it is safe for concurrent use.
+// A nil index ignores the call, so callers do not need to check whether indexing is enabled.
+func (x *InvertedIndex) AddFile(filePath string, text string) {
+	if x == nil {
+		return
+	}
+
+	// Tokenise outside the lock; file ids are only known once the file is registered
+	tp := TextPreprocessor{Stopwords: x.stopwords, Rules: x.Rules}
+	postings := make(map[string][]Occurrence)
+	for token := range tp.PreprocessTextPositioned(text) {
+		postings[token.Word] = append(postings[token.Word], Occurrence{
+			Position: token.Position,
+			Line:     token.Line,
+			Offset:   token.Offset,
+		})
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	file := len(x.Files)
+	x.Files = append(x.Files, IndexedFile{Path: filePath, Text: text})
+
+	for word, occurrences := range postings {
+		for i := range occurrences {
+			occurrences[i].File = file
+		}
+		x.Postings[word] = append(x.Postings[word], occurrences...)
+	}
+}
+
+// Sort orders files by path and postings by file and position,
+// so the index does not depend on the order workers added the files in
+func (x *InvertedIndex) Sort() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	order := make([]int, len(x.Files))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortFunc(order, func(a, b int) int {
+		return strings.Compare(x.Files[a].Path, x.Files[b].Path)
+	})
+
+	// renumber maps an old file id to its position in the sorted files
+	renumber := make([]int, len(order))
+	sorted := make([]IndexedFile, len(order))
+	for newID, oldID := range order {
+		renumber[oldID] = newID
+		sorted[newID] = x.Files[oldID]
+	}
+	x.Files = sorted
+
+	for _, occurrences := range x.Postings {
+		for i := range occurrences {
+			occurrences[i].File = renumber[occurrences[i].File]
+		}
+		slices.SortFunc(occurrences, func(a, b Occurrence) int {
+			if c := cmp.Compare(a.File, b.File); c != 0 {
+				return c
+			}
+			return cmp.Compare(a.Position, b.Position)
+		})
+	}
+}
+
+// Save writes the index to filename as gzip-compressed gob
+func (x *InvertedIndex) Save(filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return xerrors.Newf("failed to create index file: %w", err)
+	}
+	defer file.Close()
+
+	compressed := gzip.NewWriter(file)
+
+	x.mu.Lock()
+	err = gob.NewEncoder(compressed).Encode(x)
+	x.mu.Unlock()
+	if err != nil {
+		return xerrors.Newf("failed to encode index: %w", err)
+	}
+
+	if err := compressed.Close(); err != nil {
+		return xerrors.Newf("failed to compress index: %w", err)
+	}
+
+	return file.Close()
+}
+
+// LoadInvertedIndex reads an index written by Save
+func LoadInvertedIndex(filename string) (*InvertedIndex, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, xerrors.Newf("failed to open index file: %w", err)
+	}
+	defer file.Close()
+
+	decompressed, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, xerrors.Newf("failed to decompress index: %w", err)
+	}
+
+	index := &InvertedIndex{}
+	if err := gob.NewDecoder(decompressed).Decode(index); err != nil {
+		return nil, xerrors.Newf("failed to decode index: %w", err)
+	}
+
+	if index.Postings == nil {
+		index.Postings = make(map[string][]Occurrence)
+	}
+
+	index.stopwords = make(pkg.StopwordSet, len(index.Stopwords))
+	for _, word := range index.Stopwords {
+		index.stopwords[word] = struct{}{}
+	}
+
+	return index, nil
+}
+
+// term returns the form word is indexed under, and whether it is indexed at all:
+// the rules rewrite aliases and remove words, and stopwords are left out
+func (x *InvertedIndex) term(word string) (string, bool) {
+	var hits tokenRuleHits
+	normalised, keep := x.Rules.apply(word, &hits)
+	return normalised, keep && !x.stopwords.Contains(normalised)
+}
@@ -0,0 +1,206 @@
+package internal
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// logContextKey keys the log attributes carried by a context
+type logContextKey int
+
+const (
+	runIDKey logContextKey = iota
+	logFileKey
+)
+
+// NewRunID returns a random identifier correlating the log lines of one run
+func NewRunID() string {
+	id := make([]byte, 8)
+	// crypto/rand never fails on supported platforms
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// WithRunID returns a context whose log lines carry the run id
+func WithRunID(ctx context.Context, runID string) context.Context {
+	return context.WithValue(ctx, runIDKey, runID)
+}
+
+// RunID returns the run id carried by ctx, or "" if there is none
+func RunID(ctx context.Context) string {
+	runID, _ := ctx.Value(runIDKey).(string)
+	return runID
+}
+
+// WithLogFile returns a context whose log lines carry the path of the file being processed
+func WithLogFile(ctx context.Context, filePath string) context.Context {
+	return context.WithValue(ctx, logFileKey, filePath)
+}
+
+// ContextHandler adds the run id and file path carried by the context to every record.
+// Only the *Context logging functions pass a context, so plain slog.Info lines are unchanged.
+type ContextHandler struct {
+	slog.Handler
+}
+
+// NewContextHandler wraps handler
+func NewContextHandler(handler slog.Handler) *ContextHandler {
+	return &ContextHandler{Handler: handler}
+}
+
+// Handle adds the context attributes and passes the record on
+func (h *ContextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if runID := RunID(ctx); runID != "" {
+		record.AddAttrs(slog.String("run_id", runID))
+	}
+	// Lines about a file may already name it, e.g. the release warning
+	if filePath, ok := ctx.Value(logFileKey).(string); ok && !hasAttr(record, "file") {
+		record.AddAttrs(slog.String("file", filePath))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+// WithAttrs keeps the wrapper around the derived handler
+func (h *ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &ContextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup keeps the wrapper around the derived handler
+func (h *ContextHandler) WithGroup(name string) slog.Handler {
+	return &ContextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// hasAttr reports whether the record has a top-level attribute named key
+func hasAttr(record slog.Record, key string) bool {
+	found := false
+	record.Attrs(func(attr slog.Attr) bool {
+		found = attr.Key == key
+		return !found
+	})
+	return found
+}
+
+// stageTimings measures how long each preprocessing stage of one file takes.
+// It is only created when debug logging or metrics are enabled, and a nil value records nothing,
+// so the timings cost nothing on ordinary runs.
+type stageTimings struct {
+	ctx     context.Context
+	metrics *Metrics
+	// debug is set when the timings are logged
+	debug  bool
+	start  time.Time
+	last   time.Time
+	stages []slog.Attr
+	// busy holds the working time of every text stage, summed over the chunks of the file.
+	// The map is filled up front and only its values change, so stage goroutines share it safely.
+	busy map[string]*atomic.Int64
+}
+
+// textStages are the stages run on every chunk of a file, in the order they run.
+// The stream and batch pipelines run lowercase to filter as goroutines of their own;
+// the fused pipeline cleans the text in one pass and tokenises it in another,
+// and the bytes pipeline tokenises in a single pass. Tokenising includes counting.
+var textStages = []string{"lowercase", "punctuation", "split", "normalise", "filter", "clean", "tokenise"}
+
+// newStageTimings starts timing a file, or returns nil if the timings would go nowhere
+func newStageTimings(opts CountOptions) *stageTimings {
+	ctx := opts.logContext()
+	debug := slog.Default().Enabled(ctx, slog.LevelDebug)
+	if !debug && opts.Metrics == nil {
+		return nil
+	}
+
+	busy := make(map[string]*atomic.Int64, len(textStages))
+	for _, stage := range textStages {
+		busy[stage] = new(atomic.Int64)
+	}
+
+	now := time.Now()
+	return &stageTimings{ctx: ctx, metrics: opts.Metrics, debug: debug, start: now, last: now, busy: busy}
+}
+
+// mark ends a stage that started at the previous mark
+func (t *stageTimings) mark(stage string) {
+	if t == nil {
+		return
+	}
+
+	now := time.Now()
+	t.metrics.observeStage(stage, now.Sub(t.last))
+	if t.debug {
+		t.stages = append(t.stages, slog.Duration(stage, now.Sub(t.last)))
+	}
+	t.last = now
+}
+
+// markCounted ends the count stage, from the first chunk to the last one counted, and records
+// the working time of each text stage that ran. The text stages of different chunks overlap,
+// so their sum may exceed the count stage.
+func (t *stageTimings) markCounted() {
+	if t == nil {
+		return
+	}
+
+	t.mark("count")
+	for _, stage := range textStages {
+		if d := time.Duration(t.busy[stage].Load()); d > 0 {
+			t.metrics.observeStage(stage, d)
+			if t.debug {
+				t.stages = append(t.stages, slog.Duration(stage, d))
+			}
+		}
+	}
+}
+
+// clock starts measuring one text stage goroutine; it returns nil without timings
+func (t *stageTimings) clock(stage string) *stageClock {
+	if t == nil {
+		return nil
+	}
+	return &stageClock{busy: t.busy[stage]}
+}
+
+// stageClock adds up the time a text stage works, leaving out the time it waits on its channels.
+// The stage calls run when it starts working and pause when it hands its output on.
+// A nil clock measures nothing.
+type stageClock struct {
+	busy    *atomic.Int64
+	since   time.Time
+	elapsed time.Duration
+}
+
+// run starts a working period
+func (c *stageClock) run() {
+	if c != nil {
+		c.since = time.Now()
+	}
+}
+
+// pause ends a working period
+func (c *stageClock) pause() {
+	if c != nil {
+		c.elapsed += time.Since(c.since)
+	}
+}
+
+// stop adds the working time to the stage; it must run before the stage closes its output,
+// so all stages are stopped by the time the consumer sees the end of the words
+func (c *stageClock) stop() {
+	if c != nil {
+		c.busy.Add(int64(c.elapsed))
+	}
+}
+
+// log writes one debug line with the duration of every stage and the total
+func (t *stageTimings) log() {
+	if t == nil || !t.debug {
+		return
+	}
+
+	attrs := append(t.stages, slog.Duration("total", time.Since(t.start)))
+	slog.LogAttrs(t.ctx, slog.LevelDebug, "file stage timings", attrs...)
+}
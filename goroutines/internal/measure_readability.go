@@ -0,0 +1,230 @@
+package internal
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ReadabilityStats holds sentence, syllable and vocabulary metrics of a document.
+// Unlike the word counts they cover every word, stopwords included.
+type ReadabilityStats struct {
+	Sentences int `json:"sentences"`
+	Words     int `json:"words"`
+	// Syllables is estimated from vowel groups, so it is only accurate for English
+	Syllables             int     `json:"syllables"`
+	AverageSentenceLength float64 `json:"average_sentence_length"`
+	SyllablesPerWord      float64 `json:"syllables_per_word"`
+	// FleschReadingEase is higher for easier text, roughly 0 to 100
+	FleschReadingEase float64 `json:"flesch_reading_ease"`
+	// FleschKincaidGrade is the US school grade needed to understand the text
+	FleschKincaidGrade float64 `json:"flesch_kincaid_grade"`
+	DistinctWords      int     `json:"distinct_words"`
+	// TypeTokenRatio is the share of distinct words, a measure of lexical variety
+	TypeTokenRatio float64 `json:"type_token_ratio"`
+	// HapaxLegomena is the number of words that occur exactly once
+	HapaxLegomena int `json:"hapax_legomena"`
+}
+
+// sentenceAbbreviations end with a period that does not end a sentence
+var sentenceAbbreviations = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true, "sr": true, "jr": true,
+	"st": true, "vs": true, "eg": true, "ie": true, "inc": true, "ltd": true, "fig": true, "no": true,
+}
+
+// MeasureReadability detects sentences and words in raw text and computes its readability.
+// It has to see the text before RemovePunctuation, as sentence boundaries are punctuation:
+// a sentence ends at '.', '!' or '?' followed by a space, or at a blank line.
+// Periods after abbreviations and initials and inside numbers do not end sentences.
+func MeasureReadability(text string) *ReadabilityStats {
+	stats := &ReadabilityStats{}
+	types := make(map[string]int)
+
+	var word strings.Builder
+	lastWord := ""
+	sentenceWords := 0
+	// pendingEnd is set by a terminator and confirmed by the whitespace after it
+	pendingEnd := false
+	newlines := 0
+
+	endSentence := func() {
+		if sentenceWords > 0 {
+			stats.Sentences++
+			sentenceWords = 0
+		}
+		pendingEnd = false
+	}
+	finishWord := func() {
+		w := strings.Trim(word.String(), "'")
+		word.Reset()
+		if w == "" {
+			return
+		}
+
+		stats.Words++
+		stats.Syllables += estimateSyllables(w)
+		types[w]++
+		sentenceWords++
+		lastWord = w
+	}
+
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+		r = unicode.ToLower(r)
+
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			// A terminator directly followed by a letter, as in "e.g", is not an end
+			pendingEnd = false
+			newlines = 0
+			word.WriteRune(r)
+
+		case r == '\'' || r == '’':
+			// Apostrophes keep contractions and possessives in one word
+			newlines = 0
+			if word.Len() > 0 {
+				word.WriteRune('\'')
+			}
+
+		case r == '.' || r == '!' || r == '?' || r == '…':
+			newlines = 0
+
+			// Decimal points stay inside numbers
+			next, _ := utf8.DecodeRuneInString(text[i:])
+			if r == '.' && word.Len() > 0 && unicode.IsDigit(next) && isDigitWord(word.String()) {
+				word.WriteRune(r)
+				continue
+			}
+
+			finishWord()
+			if sentenceWords > 0 && (r != '.' || !isAbbreviation(lastWord)) {
+				pendingEnd = true
+			}
+
+		case unicode.IsSpace(r):
+			finishWord()
+			if pendingEnd {
+				endSentence()
+			}
+
+			// A blank line ends a sentence, e.g. after a heading without punctuation
+			if r == '\n' {
+				if newlines++; newlines >= 2 {
+					endSentence()
+				}
+			}
+
+		default:
+			finishWord()
+			newlines = 0
+			// Closing quotes and brackets may follow a terminator; separators within a sentence may not
+			if r == ',' || r == ';' || r == ':' {
+				pendingEnd = false
+			}
+		}
+	}
+	finishWord()
+	endSentence()
+
+	stats.DistinctWords = len(types)
+	for _, count := range types {
+		if count == 1 {
+			stats.HapaxLegomena++
+		}
+	}
+
+	stats.derive()
+	return stats
+}
+
+// derive computes the averages and scores from the counts, which is all a written result keeps exactly
+func (s *ReadabilityStats) derive() {
+	if s.Words == 0 || s.Sentences == 0 {
+		return
+	}
+
+	words, sentences := float64(s.Words), float64(s.Sentences)
+	s.AverageSentenceLength = words / sentences
+	s.SyllablesPerWord = float64(s.Syllables) / words
+	s.FleschReadingEase = 206.835 - 1.015*s.AverageSentenceLength - 84.6*s.SyllablesPerWord
+	s.FleschKincaidGrade = 0.39*s.AverageSentenceLength + 11.8*s.SyllablesPerWord - 15.59
+	s.TypeTokenRatio = float64(s.DistinctWords) / words
+}
+
+// isAbbreviation reports whether a period after word is part of an abbreviation or initial.
+// "I" is a word of its own, so "so did I." still ends a sentence.
+func isAbbreviation(word string) bool {
+	return sentenceAbbreviations[word] || (utf8.RuneCountInString(word) == 1 && word != "i" && !isDigitWord(word))
+}
+
+// isDigitWord reports whether word only holds digits and decimal points
+func isDigitWord(word string) bool {
+	for _, r := range word {
+		if !unicode.IsDigit(r) && r != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// estimateSyllables counts the vowel groups of a lowercase word, not counting a silent final e.
+// Numbers and words without vowels count as one syllable.
+func estimateSyllables(word string) int {
+	count := 0
+	previousVowel := false
+	for _, r := range word {
+		vowel := strings.ContainsRune("aeiouy", r)
+		if vowel && !previousVowel {
+			count++
+		}
+		previousVowel = vowel
+	}
+
+	// "make" has one syllable, but "table" keeps its final "le"
+	if count > 1 && strings.HasSuffix(word, "e") && !strings.HasSuffix(word, "le") {
+		count--
+	}
+
+	return max(count, 1)
+}
+
+// ReadabilityCollector keeps the readability of every file read, keyed by path.
+// Each file is measured by the worker that read it, before punctuation is removed;
+// a nil collector skips the measurement altogether.
+type ReadabilityCollector struct {
+	mu    sync.Mutex
+	stats map[string]*ReadabilityStats
+}
+
+// NewReadabilityCollector creates an empty collector
+func NewReadabilityCollector() *ReadabilityCollector {
+	return &ReadabilityCollector{stats: make(map[string]*ReadabilityStats)}
+}
+
+// AddFile measures the readability of one file
+func (c *ReadabilityCollector) AddFile(filePath, text string) {
+	if c == nil {
+		return
+	}
+
+	stats := MeasureReadability(text)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats[filePath] = stats
+}
+
+// File returns the readability of one file, or nil if it was not measured
+func (c *ReadabilityCollector) File(filePath string) *ReadabilityStats {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats[filePath]
+}
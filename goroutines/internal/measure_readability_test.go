@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestMeasureReadability checks sentence boundaries, syllables and the vocabulary metrics
+func TestMeasureReadability(t *testing.T) {
+	text := "Mr. Smith paid 3.50 dollars. Did he pay? Yes, he did!\n\nA heading\n\nThe table, e.g. this one, is made of oak."
+
+	stats := MeasureReadability(text)
+
+	want := ReadabilityStats{Sentences: 5, Words: 23, Syllables: 26, DistinctWords: 21, HapaxLegomena: 19}
+	if stats.Sentences != want.Sentences || stats.Words != want.Words || stats.Syllables != want.Syllables ||
+		stats.DistinctWords != want.DistinctWords || stats.HapaxLegomena != want.HapaxLegomena {
+		t.Errorf("got %+v, want %+v", *stats, want)
+	}
+
+	if stats.AverageSentenceLength != 23.0/5 || stats.TypeTokenRatio != 21.0/23 {
+		t.Errorf("got %.2f words per sentence and type/token ratio %.3f", stats.AverageSentenceLength, stats.TypeTokenRatio)
+	}
+	if ease := 206.835 - 1.015*(23.0/5) - 84.6*(26.0/23); stats.FleschReadingEase != ease {
+		t.Errorf("got Flesch reading ease %.2f, want %.2f", stats.FleschReadingEase, ease)
+	}
+}
+
+// TestEstimateSyllables checks vowel groups and the silent final e
+func TestEstimateSyllables(t *testing.T) {
+	for word, want := range map[string]int{"make": 1, "table": 2, "the": 1, "concurrency": 4, "rhythm": 1, "42": 1, "goroutine": 3} {
+		if got := estimateSyllables(word); got != want {
+			t.Errorf("%s: got %d syllables, want %d", word, got, want)
+		}
+	}
+}
+
+// TestReadabilityReadBack checks that the readability annotation survives a markdown round trip
+func TestReadabilityReadBack(t *testing.T) {
+	stats := MeasureReadability("The cat sat. It purred loudly on the mat!")
+	written := FileWordFrequency{FileName: "cat.txt", Path: "cat.txt", Words: []Word{{"cat", 1}}, Readability: stats}
+
+	results, err := ParseHumanReadable(strings.NewReader(written.ToHumanReadable()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Readability == nil {
+		t.Fatalf("got %+v, want one file with readability", results)
+	}
+	if got := *results[0].Readability; got != *stats {
+		t.Errorf("got %+v, want %+v", got, *stats)
+	}
+	if !slices.Equal(results[0].Words, written.Words) {
+		t.Errorf("got words %v, want %v", results[0].Words, written.Words)
+	}
+}
@@ -0,0 +1,193 @@
+package internal
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/mdobak/go-xerrors"
+)
+
+// ConflictMode selects what happens when the same file appears in more than one shard
+type ConflictMode int
+
+const (
+	// ConflictError fails the merge, listing every conflicting file
+	ConflictError ConflictMode = iota
+	// ConflictFirst keeps the counts of the first shard containing the file
+	ConflictFirst
+	// ConflictSum adds the counts of all shards containing the file
+	ConflictSum
+)
+
+// String returns the command line name of the mode
+func (m ConflictMode) String() string {
+	switch m {
+	case ConflictFirst:
+		return "first"
+	case ConflictSum:
+		return "sum"
+	}
+	return "error"
+}
+
+// ParseConflictMode converts a command line name into a ConflictMode
+func ParseConflictMode(name string) (ConflictMode, error) {
+	switch name {
+	case "error":
+		return ConflictError, nil
+	case "first":
+		return ConflictFirst, nil
+	case "sum":
+		return ConflictSum, nil
+	}
+	return 0, xerrors.Newf("unknown conflict mode %q (expected error, first or sum)", name)
+}
+
+// MergeConflict is a file found in more than one shard
+type MergeConflict struct {
+	File string `json:"file"`
+	// Shards lists the shards containing the file, in the order they were added
+	Shards []string `json:"shards"`
+}
+
+// mergedFile is the combined result of one file, with the shards it came from
+type mergedFile struct {
+	result FileWordFrequency
+	shards []string
+}
+
+// ResultMerger combines result files of separate runs, one shard at a time.
+// Every word count also goes to a fan-in goroutine building the aggregate
+// frequency, so shards are merged while the next one is being read.
+type ResultMerger struct {
+	mode  ConflictMode
+	files map[string]*mergedFile
+	// aggregate feeds the fan-in merge; done receives its result
+	aggregate chan ChunkResult
+	done      chan Frequency
+	chunks    int
+}
+
+// NewResultMerger starts a merge with the given conflict handling
+func NewResultMerger(mode ConflictMode) *ResultMerger {
+	m := &ResultMerger{
+		mode:      mode,
+		files:     make(map[string]*mergedFile),
+		aggregate: make(chan ChunkResult, 16),
+		done:      make(chan Frequency, 1),
+	}
+
+	// Fan-In: the same merge the counters of one file use for their chunks
+	go func() {
+		m.done <- mergeChunkFrequenciesIntoSingleFrequency(m.aggregate)
+	}()
+
+	return m
+}
+
+// Add merges the results of one shard
+func (m *ResultMerger) Add(shard string, results []FileWordFrequency) {
+	for _, result := range results {
+		m.AddFile(shard, result)
+	}
+}
+
+// AddFile merges the result of one file of a shard, so a shard can be merged as it is read.
+// Files are identified by their path, which results read back from markdown take from
+// their path annotation, or by their file name at the top level.
+// Approximate estimates are merged as plain counts and lose their error bounds.
+func (m *ResultMerger) AddFile(shard string, result FileWordFrequency) {
+	key := mergedFileKey(result)
+	existing, ok := m.files[key]
+	if !ok {
+		m.files[key] = &mergedFile{
+			result: FileWordFrequency{FileName: result.FileName, Path: key, Words: result.Words},
+			shards: []string{shard},
+		}
+		m.addToAggregate(result.Words)
+		return
+	}
+
+	existing.shards = append(existing.shards, shard)
+	if m.mode != ConflictSum {
+		// The first shard wins; with ConflictError the merge fails in Finish
+		return
+	}
+
+	existing.result.Words = sumWords(existing.result.Words, result.Words)
+	m.addToAggregate(result.Words)
+}
+
+// addToAggregate sends the counts of one file to the fan-in goroutine
+func (m *ResultMerger) addToAggregate(words []Word) {
+	frequency := make(Frequency, len(words))
+	for _, w := range words {
+		frequency[w.Word] += w.Count
+	}
+
+	m.aggregate <- ChunkResult{frequency: frequency, id: m.chunks}
+	m.chunks++
+}
+
+// sumWords adds up the counts of two word lists
+func sumWords(a, b []Word) []Word {
+	frequency := make(Frequency, len(a)+len(b))
+	for _, w := range a {
+		frequency[w.Word] += w.Count
+	}
+	for _, w := range b {
+		frequency[w.Word] += w.Count
+	}
+	return convertFrequencyToWord(frequency)
+}
+
+// MergedResults is the unified result of all shards
+type MergedResults struct {
+	// Files holds one result per file, ordered by path (or file name)
+	Files []FileWordFrequency
+	// Aggregate holds the corpus-wide counts, most frequent first
+	Aggregate []Word
+	// Conflicts lists the files found in more than one shard
+	Conflicts []MergeConflict
+}
+
+// Finish waits for the aggregate merge and returns the unified result
+// With ConflictError an error is returned alongside the result when any file conflicts.
+// The merger cannot be used afterwards.
+func (m *ResultMerger) Finish() (MergedResults, error) {
+	close(m.aggregate)
+	aggregate := <-m.done
+
+	merged := MergedResults{Aggregate: convertFrequencyToWord(aggregate)}
+	SortWords(merged.Aggregate)
+
+	for _, file := range m.files {
+		SortWords(file.result.Words)
+		merged.Files = append(merged.Files, file.result)
+		if len(file.shards) > 1 {
+			merged.Conflicts = append(merged.Conflicts, MergeConflict{File: mergedFileKey(file.result), Shards: file.shards})
+		}
+	}
+
+	slices.SortFunc(merged.Files, func(a, b FileWordFrequency) int {
+		return strings.Compare(mergedFileKey(a), mergedFileKey(b))
+	})
+	slices.SortFunc(merged.Conflicts, func(a, b MergeConflict) int {
+		return strings.Compare(a.File, b.File)
+	})
+
+	if m.mode == ConflictError && len(merged.Conflicts) > 0 {
+		return merged, xerrors.Newf("%d files appear in more than one shard (first: %s in %s)",
+			len(merged.Conflicts), merged.Conflicts[0].File, strings.Join(merged.Conflicts[0].Shards, ", "))
+	}
+
+	return merged, nil
+}
+
+// mergedFileKey returns the key a result was merged under
+func mergedFileKey(result FileWordFrequency) string {
+	if result.Path != "" {
+		return result.Path
+	}
+	return result.FileName
+}
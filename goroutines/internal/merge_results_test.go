@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestResultMergerConflicts checks the aggregate counts and every conflict mode
+func TestResultMergerConflicts(t *testing.T) {
+	shardA := []FileWordFrequency{
+		{FileName: "a.txt", Path: "a.txt", Words: []Word{{"go", 2}}},
+		{FileName: "b.txt", Path: "b.txt", Words: []Word{{"go", 1}, {"zig", 1}}},
+	}
+	shardB := []FileWordFrequency{
+		{FileName: "b.txt", Path: "b.txt", Words: []Word{{"go", 5}}},
+		{FileName: "c.txt", Path: "c.txt", Words: []Word{{"rust", 3}}},
+	}
+
+	tests := []struct {
+		mode      ConflictMode
+		wantB     []Word
+		wantTotal []Word
+		wantErr   bool
+	}{
+		{ConflictError, []Word{{"go", 1}, {"zig", 1}}, []Word{{"go", 3}, {"rust", 3}, {"zig", 1}}, true},
+		{ConflictFirst, []Word{{"go", 1}, {"zig", 1}}, []Word{{"go", 3}, {"rust", 3}, {"zig", 1}}, false},
+		{ConflictSum, []Word{{"go", 6}, {"zig", 1}}, []Word{{"go", 8}, {"rust", 3}, {"zig", 1}}, false},
+	}
+
+	for _, tt := range tests {
+		merger := NewResultMerger(tt.mode)
+		merger.Add("a", slices.Clone(shardA))
+		merger.Add("b", slices.Clone(shardB))
+
+		merged, err := merger.Finish()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error %v", tt.mode, err, tt.wantErr)
+		}
+
+		if len(merged.Files) != 3 || merged.Files[1].Path != "b.txt" {
+			t.Fatalf("%s: got files %+v", tt.mode, merged.Files)
+		}
+		if !slices.Equal(merged.Files[1].Words, tt.wantB) {
+			t.Errorf("%s: b.txt got %v, want %v", tt.mode, merged.Files[1].Words, tt.wantB)
+		}
+		if !slices.Equal(merged.Aggregate, tt.wantTotal) {
+			t.Errorf("%s: aggregate got %v, want %v", tt.mode, merged.Aggregate, tt.wantTotal)
+		}
+		if len(merged.Conflicts) != 1 || !slices.Equal(merged.Conflicts[0].Shards, []string{"a", "b"}) {
+			t.Errorf("%s: got conflicts %+v", tt.mode, merged.Conflicts)
+		}
+	}
+}
+
+// TestMergeReadBackShardsByPath checks that files of the same name in different directories
+// stay apart when shards are read back from markdown and JSON one file at a time
+func TestMergeReadBackShardsByPath(t *testing.T) {
+	written := []FileWordFrequency{
+		{FileName: "a.txt", Path: "a.txt", Words: []Word{{"go", 2}}},
+		{FileName: "a.txt", Path: "logs/a.txt", Words: []Word{{"zig", 1}}},
+	}
+
+	var markdown strings.Builder
+	for _, result := range written {
+		markdown.WriteString(result.ToHumanReadable())
+	}
+	encoded, err := json.Marshal(ResultFile{Files: written, Aggregate: []Word{{"go", 2}, {"zig", 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merger := NewResultMerger(ConflictError)
+	for result, err := range ScanHumanReadable(strings.NewReader(markdown.String())) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		merger.AddFile("md", result)
+	}
+
+	merged, err := merger.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merged.Files) != 2 || merged.Files[0].Path != "a.txt" || merged.Files[1].Path != "logs/a.txt" {
+		t.Errorf("markdown: got files %+v", merged.Files)
+	}
+
+	var paths []string
+	for result, err := range ScanJSONResults(bytes.NewReader(encoded)) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, result.Path)
+	}
+	if want := []string{"a.txt", "logs/a.txt"}; !slices.Equal(paths, want) {
+		t.Errorf("JSON: got paths %v, want %v", paths, want)
+	}
+}
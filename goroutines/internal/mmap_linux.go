@@ -0,0 +1,18 @@
+//go:build linux
+
+package internal
+
+import (
+	"syscall"
+)
+
+// mmapFile maps size bytes of the file descriptor fd read-only into memory
+// The mapping stays valid after the file is closed, until munmapFile is called
+func mmapFile(fd uintptr, size int64) ([]byte, error) {
+	return syscall.Mmap(int(fd), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// munmapFile releases a mapping created by mmapFile
+func munmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package internal
+
+import (
+	"errors"
+)
+
+// errMmapUnsupported makes readInput fall back to os.ReadFile on other platforms
+var errMmapUnsupported = errors.New("mmap input is only supported on linux")
+
+// mmapFile is not implemented outside linux
+func mmapFile(fd uintptr, size int64) ([]byte, error) {
+	return nil, errMmapUnsupported
+}
+
+// munmapFile is not implemented outside linux
+func munmapFile(data []byte) error {
+	return errMmapUnsupported
+}
@@ -0,0 +1,374 @@
+package internal
+
+import (
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// DuplicateOptions configures near-duplicate detection
+type DuplicateOptions struct {
+	// Threshold is the smallest estimated Jaccard similarity of the shingles of two files that makes them duplicates
+	Threshold float64 `json:"threshold"`
+	// Shingle is the number of consecutive words hashed together
+	Shingle int `json:"shingle"`
+	// Bands and Rows split the MinHash signature for LSH: files agreeing on every row of
+	// any band are compared. Their product is the signature length.
+	Bands int `json:"bands"`
+	Rows  int `json:"rows"`
+	// Representatives counts only the first file by path of each cluster; the others
+	// are left out of the file results and of the corpus-wide sketches and collocations
+	Representatives bool `json:"representatives"`
+}
+
+// DefaultDuplicateOptions returns settings that find files sharing about 80% of their 3-word shingles.
+// With 20 bands of 5 rows a pair at that similarity becomes a candidate with a probability above 99.9%.
+func DefaultDuplicateOptions() DuplicateOptions {
+	return DuplicateOptions{Threshold: 0.8, Shingle: 3, Bands: 20, Rows: 5}
+}
+
+// DuplicateFile is a member of a near-duplicate cluster
+type DuplicateFile struct {
+	Path string `json:"path"`
+	// Similarity is the estimated Jaccard similarity to the representative
+	Similarity float64 `json:"similarity"`
+}
+
+// DuplicateCluster is a group of near-identical files
+type DuplicateCluster struct {
+	// Representative is the first file of the cluster by path
+	Representative string          `json:"representative"`
+	Duplicates     []DuplicateFile `json:"duplicates"`
+}
+
+// MinHashSignature holds the smallest hash of a file's shingles under each hash function
+type MinHashSignature []uint64
+
+// Similarity estimates the Jaccard similarity of two signatures as the share of equal minimums
+func (s MinHashSignature) Similarity(other MinHashSignature) float64 {
+	if len(s) == 0 || len(s) != len(other) {
+		return 0
+	}
+
+	equal := 0
+	for i := range s {
+		if s[i] == other[i] {
+			equal++
+		}
+	}
+	return float64(equal) / float64(len(s))
+}
+
+// splitMix64 scrambles x; seeded with the index of a hash function it gives an independent hash
+func splitMix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// fnv64a hashes a word with FNV-1a; unlike maphash it is the same in every run
+func fnv64a[T string | []byte](s T) uint64 {
+	hash := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		hash ^= uint64(s[i])
+		hash *= 1099511628211
+	}
+	return hash
+}
+
+// union merges two signatures into the signature of the union of their shingles
+func (s MinHashSignature) union(other MinHashSignature) MinHashSignature {
+	if s == nil {
+		return other
+	}
+	for i := range s {
+		s[i] = min(s[i], other[i])
+	}
+	return s
+}
+
+// Signature computes the MinHash signature of the shingles of a word stream.
+// Streams shorter than a shingle are one shingle; an empty stream has no signature.
+func (o DuplicateOptions) Signature(words iter.Seq[string]) MinHashSignature {
+	hasher := o.newMinHasher()
+	for word := range words {
+		hasher.Add(word)
+	}
+	return hasher.Signature()
+}
+
+// MinHasher computes the MinHash signature of a word stream one word at a time.
+// A nil hasher ignores every word.
+type MinHasher struct {
+	seeds []uint64
+	size  int
+	// recent holds the hashes of the last size words in a ring
+	recent []uint64
+	next   int
+	// signature covers the complete shingles seen so far; it is nil until the first one
+	signature MinHashSignature
+}
+
+// newMinHasher creates a hasher for the shingle size and signature length of o
+func (o DuplicateOptions) newMinHasher() *MinHasher {
+	seeds := make([]uint64, o.Bands*o.Rows)
+	for i := range seeds {
+		seeds[i] = splitMix64(uint64(i))
+	}
+	size := max(o.Shingle, 1)
+	return &MinHasher{seeds: seeds, size: size, recent: make([]uint64, 0, size)}
+}
+
+// Add hashes the next word of the stream
+func (h *MinHasher) Add(word string) {
+	if h == nil {
+		return
+	}
+	h.addHash(fnv64a(word))
+}
+
+// addBytes is Add for a word held in a byte slice that is only valid during the call
+func (h *MinHasher) addBytes(word []byte) {
+	if h == nil {
+		return
+	}
+	h.addHash(fnv64a(word))
+}
+
+// addHash moves the ring on by one word and hashes the shingle it completes
+func (h *MinHasher) addHash(hash uint64) {
+	if len(h.recent) < h.size {
+		h.recent = append(h.recent, hash)
+	} else {
+		h.recent[h.next] = hash
+		h.next = (h.next + 1) % h.size
+	}
+
+	if len(h.recent) == h.size {
+		if h.signature == nil {
+			h.signature = h.emptySignature()
+		}
+		h.hashInto(h.signature, h.shingle())
+	}
+}
+
+// shingle hashes the words in the ring, oldest first
+func (h *MinHasher) shingle() uint64 {
+	hash := uint64(0)
+	for i := range h.recent {
+		hash = hash*31 + h.recent[(h.next+i)%len(h.recent)]
+	}
+	return hash
+}
+
+// emptySignature returns a signature that any shingle lowers
+func (h *MinHasher) emptySignature() MinHashSignature {
+	signature := make(MinHashSignature, len(h.seeds))
+	for i := range signature {
+		signature[i] = ^uint64(0)
+	}
+	return signature
+}
+
+// hashInto lowers signature by the hashes of one shingle
+func (h *MinHasher) hashInto(signature MinHashSignature, shingle uint64) {
+	for i, seed := range h.seeds {
+		signature[i] = min(signature[i], splitMix64(shingle^seed))
+	}
+}
+
+// Signature returns the signature of the words added so far. A stream shorter than a shingle
+// is one shingle; an empty stream has no signature.
+func (h *MinHasher) Signature() MinHashSignature {
+	if h.signature != nil || len(h.recent) == 0 {
+		return h.signature
+	}
+
+	signature := h.emptySignature()
+	h.hashInto(signature, h.shingle())
+	return signature
+}
+
+// fileShingles gathers the hashers the counting stages fill for the chunks of one file.
+// Shingles across two chunks are not hashed, which misses at most Shingle-1 shingles at
+// every chunk boundary. A nil value gathers nothing.
+type fileShingles struct {
+	options DuplicateOptions
+
+	mu     sync.Mutex
+	chunks []*MinHasher
+}
+
+// chunk returns a hasher for the words of one more chunk, or nil if nothing is gathered
+func (f *fileShingles) chunk() *MinHasher {
+	if f == nil {
+		return nil
+	}
+
+	hasher := f.options.newMinHasher()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.chunks = append(f.chunks, hasher)
+	return hasher
+}
+
+// signature merges the chunk signatures into the signature of the file. Chunks shorter
+// than a shingle only count when no chunk has a complete one, as for a single stream.
+func (f *fileShingles) signature() MinHashSignature {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var complete, short MinHashSignature
+	for _, chunk := range f.chunks {
+		if chunk.signature != nil {
+			complete = complete.union(chunk.signature)
+		} else {
+			short = short.union(chunk.Signature())
+		}
+	}
+	f.chunks = nil
+
+	if complete != nil {
+		return complete
+	}
+	return short
+}
+
+// DuplicateDetector receives the MinHash signature of every file as it is counted and groups
+// near-duplicates once all files are in. Only the signatures are kept, never the text; a nil
+// detector computes none.
+type DuplicateDetector struct {
+	options DuplicateOptions
+
+	mu         sync.Mutex
+	signatures map[string]MinHashSignature
+}
+
+// NewDuplicateDetector creates an empty detector
+func NewDuplicateDetector(options DuplicateOptions) *DuplicateDetector {
+	return &DuplicateDetector{options: options, signatures: make(map[string]MinHashSignature)}
+}
+
+// newFile starts gathering the shingles of one file, or returns nil for a nil detector
+func (d *DuplicateDetector) newFile() *fileShingles {
+	if d == nil {
+		return nil
+	}
+	return &fileShingles{options: d.options}
+}
+
+// addFile takes the signature hashed while a file was counted. Shingles are made of the
+// counted words, so stopwords and the words removed by the rules are left out of them.
+func (d *DuplicateDetector) addFile(filePath string, file *fileShingles) {
+	if d == nil || file == nil {
+		return
+	}
+
+	signature := file.signature()
+	if signature == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.signatures[filePath] = signature
+}
+
+// Clusters groups the files added so far, ordered by representative.
+// Files sharing a band bucket are compared with every other file of the bucket and
+// joined when similar enough; clusters are the connected groups of joined files.
+func (d *DuplicateDetector) Clusters() []DuplicateCluster {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	paths := slices.Sorted(maps.Keys(d.signatures))
+
+	// Union-find over path indexes; the root is always the smallest index, i.e. the first path
+	parent := make([]int, len(paths))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for band := range d.options.Bands {
+		buckets := make(map[uint64][]int)
+		for i, path := range paths {
+			rows := d.signatures[path][band*d.options.Rows : (band+1)*d.options.Rows]
+			key := uint64(0)
+			for _, row := range rows {
+				key = splitMix64(key ^ row)
+			}
+
+			// A file dissimilar to one member of the bucket may still be similar to another
+			for _, other := range buckets[key] {
+				a, b := find(other), find(i)
+				if a == b || d.signatures[paths[other]].Similarity(d.signatures[path]) < d.options.Threshold {
+					continue
+				}
+				parent[max(a, b)] = min(a, b)
+			}
+			buckets[key] = append(buckets[key], i)
+		}
+	}
+
+	members := make(map[int][]int)
+	for i := range paths {
+		if root := find(i); root != i {
+			members[root] = append(members[root], i)
+		}
+	}
+
+	clusters := make([]DuplicateCluster, 0, len(members))
+	for _, root := range slices.Sorted(maps.Keys(members)) {
+		cluster := DuplicateCluster{Representative: paths[root]}
+		for _, i := range members[root] {
+			similarity := d.signatures[paths[root]].Similarity(d.signatures[paths[i]])
+			cluster.Duplicates = append(cluster.Duplicates, DuplicateFile{Path: paths[i], Similarity: similarity})
+		}
+		clusters = append(clusters, cluster)
+	}
+
+	return clusters
+}
+
+// DuplicatePaths returns the paths of every file in clusters that is not a representative
+func DuplicatePaths(clusters []DuplicateCluster) map[string]bool {
+	duplicates := make(map[string]bool)
+	for _, cluster := range clusters {
+		for _, file := range cluster.Duplicates {
+			duplicates[file.Path] = true
+		}
+	}
+	return duplicates
+}
+
+// DuplicatesToHumanReadable writes the clusters as a section of the markdown result
+func DuplicatesToHumanReadable(clusters []DuplicateCluster) string {
+	var builder strings.Builder
+
+	builder.WriteString(DuplicatesSectionName)
+	builder.WriteString(":\n")
+	fmt.Fprintf(&builder, "\t(%d clusters of near-identical files, representative first)\n", len(clusters))
+
+	for _, cluster := range clusters {
+		fmt.Fprintf(&builder, "\t%s\n", cluster.Representative)
+		for _, file := range cluster.Duplicates {
+			fmt.Fprintf(&builder, "\t\t%s (similarity %.2f)\n", file.Path, file.Similarity)
+		}
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// TestDuplicateDetectorClusters checks that copies and small edits are grouped, and unrelated files are not
+func TestDuplicateDetectorClusters(t *testing.T) {
+	base := strings.Repeat("the worker pool drains the job queue before shutting down cleanly. ", 3) +
+		"retries back off exponentially while the dispatcher keeps accepting new jobs from clients"
+
+	fsys := fstest.MapFS{
+		"logs/b.txt": {Data: []byte(base)},
+		"logs/a.txt": {Data: []byte(base + " today")},
+		"logs/c.txt": {Data: []byte(base)},
+		"notes.txt":  {Data: []byte("channels synchronise goroutines without sharing memory by communicating")},
+		"empty.txt":  {},
+	}
+
+	// The signatures are hashed from the words the counting stages keep
+	detector := NewDuplicateDetector(DefaultDuplicateOptions())
+	for _, name := range []string{"logs/b.txt", "logs/a.txt", "logs/c.txt", "notes.txt", "empty.txt"} {
+		if _, err := CountWordFrequency(fsys, name, CountOptions{Pipeline: PipelineBytes, Duplicates: detector}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clusters := detector.Clusters()
+	if len(clusters) != 1 {
+		t.Fatalf("got %d clusters, want 1: %+v", len(clusters), clusters)
+	}
+
+	cluster := clusters[0]
+	if cluster.Representative != "logs/a.txt" || len(cluster.Duplicates) != 2 ||
+		cluster.Duplicates[0].Path != "logs/b.txt" || cluster.Duplicates[1].Path != "logs/c.txt" {
+		t.Errorf("got %+v, want logs/a.txt representing logs/b.txt and logs/c.txt", cluster)
+	}
+	for _, file := range cluster.Duplicates {
+		if file.Similarity < 0.8 {
+			t.Errorf("got similarity %.2f for %s, want at least 0.8", file.Similarity, file.Path)
+		}
+	}
+
+	if skip := DuplicatePaths(clusters); !skip["logs/b.txt"] || skip["logs/a.txt"] || skip["notes.txt"] {
+		t.Errorf("got duplicate paths %v", skip)
+	}
+}
+
+// TestDuplicateDetectorComparesWholeBucket checks that two similar files are joined even when
+// the first file of the band bucket they share is dissimilar to both
+func TestDuplicateDetectorComparesWholeBucket(t *testing.T) {
+	detector := NewDuplicateDetector(DuplicateOptions{Threshold: 0.7, Shingle: 1, Bands: 2, Rows: 2})
+
+	// All three agree on the first band; b and c also agree on half of the second one
+	detector.signatures = map[string]MinHashSignature{
+		"a.txt": {1, 2, 7, 8},
+		"b.txt": {1, 2, 3, 4},
+		"c.txt": {1, 2, 3, 5},
+	}
+
+	clusters := detector.Clusters()
+	if len(clusters) != 1 || clusters[0].Representative != "b.txt" ||
+		len(clusters[0].Duplicates) != 1 || clusters[0].Duplicates[0].Path != "c.txt" {
+		t.Errorf("got %+v, want b.txt representing c.txt", clusters)
+	}
+}
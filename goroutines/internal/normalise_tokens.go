@@ -0,0 +1,362 @@
+package internal
+
+import (
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/mdobak/go-xerrors"
+)
+
+// TokenRule identifies one of the normalisation rules, e.g. to read its counter in RunStats
+type TokenRule int
+
+const (
+	// RuleSynonym rewrites an alias to its canonical word
+	RuleSynonym TokenRule = iota
+	// RuleNotAllowed removes words missing from the allowlist in allowlist-only mode
+	RuleNotAllowed
+	// RuleMinLength and RuleMaxLength remove words outside the length limits
+	RuleMinLength
+	RuleMaxLength
+	// RuleNumeric removes words made only of digits
+	RuleNumeric
+	// RuleHex removes hexadecimal numbers such as hashes and ids
+	RuleHex
+	// RuleMinCount removes words occurring less often than the threshold in a file
+	RuleMinCount
+
+	tokenRuleCount
+)
+
+// tokenRuleNames are the names used in logs, metrics and reports
+var tokenRuleNames = [tokenRuleCount]string{"synonym", "not_allowed", "min_length", "max_length", "numeric", "hex", "min_count"}
+
+// String returns the name of the rule
+func (r TokenRule) String() string {
+	if r < 0 || r >= tokenRuleCount {
+		return "unknown"
+	}
+	return tokenRuleNames[r]
+}
+
+// hexMinLength is the shortest run of hex digits taken for a hash or id; shorter ones
+// such as "3d" or "b2" are more likely words
+const hexMinLength = 6
+
+// TokenRules normalise the tokens coming out of the split stage before stopwords are filtered:
+// aliases are rewritten to their canonical word first, and every other rule sees the canonical word.
+// Allowed words are kept whatever the length, numeric and hex rules say.
+// The rules must not be modified once counting starts; they are safe for concurrent use.
+type TokenRules struct {
+	// Synonyms maps every alias to its canonical word, e.g. "k8s" to "kubernetes"
+	Synonyms map[string]string `json:"synonyms,omitempty"`
+	// MinLength and MaxLength limit the number of letters and digits of a word; 0 disables a limit
+	MinLength int `json:"min_length,omitempty"`
+	MaxLength int `json:"max_length,omitempty"`
+	// DropNumeric removes words made only of ASCII digits
+	DropNumeric bool `json:"drop_numeric,omitempty"`
+	// DropHex removes 0x numbers and runs of at least 6 hex digits mixing digits and letters
+	DropHex bool `json:"drop_hex,omitempty"`
+	// Allow lists words kept by every rule; with AllowOnly set, only these words are counted
+	Allow     []string `json:"allow,omitempty"`
+	AllowOnly bool     `json:"allow_only,omitempty"`
+	// MinCount drops the words counted less often in a file (exact counting only); 0 and 1 keep all
+	MinCount int `json:"min_count,omitempty"`
+
+	// The lookups are built on first use, so rules can also be written as literals
+	once         sync.Once
+	allow        map[string]struct{}
+	synonymBytes map[string][]byte
+}
+
+// tokenRuleHits counts how often each rule applied within one stage, before it is added to RunStats
+type tokenRuleHits [tokenRuleCount]int64
+
+// LoadTokenRules reads a rules file written in the TOML subset of ParseConfig
+func LoadTokenRules(path string) (*TokenRules, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, xerrors.Newf("failed to open rules %q: %w", path, err)
+	}
+	defer file.Close()
+
+	rules, err := ParseTokenRules(file)
+	if err != nil {
+		return nil, xerrors.Newf("failed to parse rules %q: %w", path, err)
+	}
+	return rules, nil
+}
+
+// ParseTokenRules reads rules such as
+//
+//	min_length = 2
+//	drop_numeric = true
+//	allow = ["go", "c"]
+//
+//	[synonyms]
+//	kubernetes = ["k8s", "kube"]
+//
+// Unknown keys and sections are errors, so a misspelt rule does not go unnoticed.
+func ParseTokenRules(r io.Reader) (*TokenRules, error) {
+	config, err := ParseConfig(r)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := &TokenRules{}
+	for key, value := range config[""] {
+		var err error
+		switch key {
+		case "min_length":
+			rules.MinLength, err = ruleInt(key, value)
+		case "max_length":
+			rules.MaxLength, err = ruleInt(key, value)
+		case "min_count":
+			rules.MinCount, err = ruleInt(key, value)
+		case "drop_numeric":
+			rules.DropNumeric, err = ruleBool(key, value)
+		case "drop_hex":
+			rules.DropHex, err = ruleBool(key, value)
+		case "allow_only":
+			rules.AllowOnly, err = ruleBool(key, value)
+		case "allow":
+			rules.Allow, err = ruleWords(key, value)
+		default:
+			err = xerrors.Newf("unknown rule %q", key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	slices.Sort(rules.Allow)
+
+	for name, section := range config {
+		switch name {
+		case "":
+		case "synonyms":
+			rules.Synonyms = make(map[string]string)
+			for canonical, value := range section {
+				aliases, err := ruleWords(canonical, value)
+				if err != nil {
+					return nil, err
+				}
+				canonical = strings.ToLower(canonical)
+				for _, alias := range aliases {
+					if other, ok := rules.Synonyms[alias]; ok && other != canonical {
+						return nil, xerrors.Newf("alias %q is listed for both %q and %q", alias, other, canonical)
+					}
+					if alias != canonical {
+						rules.Synonyms[alias] = canonical
+					}
+				}
+			}
+		default:
+			return nil, xerrors.Newf("unknown rules section %q", name)
+		}
+	}
+
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// ruleInt converts a non-negative integer rule value
+func ruleInt(key string, value any) (int, error) {
+	number, ok := value.(int64)
+	if !ok || number < 0 {
+		return 0, xerrors.Newf("rule %q must be a non-negative integer, got: %v", key, value)
+	}
+	return int(number), nil
+}
+
+// ruleBool converts a boolean rule value
+func ruleBool(key string, value any) (bool, error) {
+	flag, ok := value.(bool)
+	if !ok {
+		return false, xerrors.Newf("rule %q must be true or false, got: %v", key, value)
+	}
+	return flag, nil
+}
+
+// ruleWords converts a word or an array of words, lowercased like the tokens they are matched against
+func ruleWords(key string, value any) ([]string, error) {
+	values, ok := value.([]any)
+	if !ok {
+		values = []any{value}
+	}
+
+	words := make([]string, 0, len(values))
+	for _, value := range values {
+		word, ok := value.(string)
+		if !ok || strings.TrimSpace(word) == "" {
+			return nil, xerrors.Newf("rule %q must list words, got: %v", key, value)
+		}
+		words = append(words, strings.ToLower(strings.TrimSpace(word)))
+	}
+	return words, nil
+}
+
+// Validate checks that the rules are consistent; nil rules are valid
+func (r *TokenRules) Validate() error {
+	if r == nil {
+		return nil
+	}
+	if r.MinLength < 0 || r.MaxLength < 0 || r.MinCount < 0 {
+		return xerrors.Newf("token rules need non-negative limits, got: min length %d, max length %d, min count %d", r.MinLength, r.MaxLength, r.MinCount)
+	}
+	if r.MaxLength > 0 && r.MinLength > r.MaxLength {
+		return xerrors.Newf("minimum token length %d exceeds the maximum %d", r.MinLength, r.MaxLength)
+	}
+	if r.AllowOnly && len(r.Allow) == 0 {
+		return xerrors.New("allowlist-only mode needs an allowlist")
+	}
+
+	// Aliases are rewritten once, so a canonical word that is itself an alias would
+	// be counted differently depending on where it came from
+	for alias, canonical := range r.Synonyms {
+		if _, ok := r.Synonyms[canonical]; ok {
+			return xerrors.Newf("canonical word %q of alias %q is an alias itself", canonical, alias)
+		}
+	}
+	return nil
+}
+
+// prepare builds the lookups used while counting
+func (r *TokenRules) prepare() {
+	r.once.Do(func() {
+		r.allow = make(map[string]struct{}, len(r.Allow))
+		for _, word := range r.Allow {
+			r.allow[word] = struct{}{}
+		}
+
+		// The bytes pipelines get the canonical words as bytes, so rewriting does not allocate
+		r.synonymBytes = make(map[string][]byte, len(r.Synonyms))
+		for alias, canonical := range r.Synonyms {
+			r.synonymBytes[alias] = []byte(canonical)
+		}
+	})
+}
+
+// apply runs the rules over one word and returns the word to count, or false if a rule removed it.
+// Every rule that applies is counted in hits. Nil rules keep every word.
+func (r *TokenRules) apply(word string, hits *tokenRuleHits) (string, bool) {
+	if r == nil {
+		return word, true
+	}
+	r.prepare()
+
+	if canonical, ok := r.Synonyms[word]; ok {
+		hits[RuleSynonym]++
+		word = canonical
+	}
+	return word, keepToken(r, word, hits)
+}
+
+// applyBytes is apply for a word held in a byte slice
+func (r *TokenRules) applyBytes(word []byte, hits *tokenRuleHits) ([]byte, bool) {
+	if r == nil {
+		return word, true
+	}
+	r.prepare()
+
+	// Lookups keyed by string(word) do not allocate
+	if canonical, ok := r.synonymBytes[string(word)]; ok {
+		hits[RuleSynonym]++
+		word = canonical
+	}
+	return word, keepToken(r, word, hits)
+}
+
+// keepToken runs the removing rules over a canonical word, counting the first one that applies
+func keepToken[T string | []byte](r *TokenRules, word T, hits *tokenRuleHits) bool {
+	if _, ok := r.allow[string(word)]; ok {
+		return true
+	}
+
+	rule := tokenRuleCount
+	switch length := tokenLength(word); {
+	case r.AllowOnly:
+		rule = RuleNotAllowed
+	case length < r.MinLength:
+		rule = RuleMinLength
+	case r.MaxLength > 0 && length > r.MaxLength:
+		rule = RuleMaxLength
+	case r.DropNumeric && isNumericToken(word):
+		rule = RuleNumeric
+	case r.DropHex && isHexToken(word):
+		rule = RuleHex
+	}
+
+	if rule == tokenRuleCount {
+		return true
+	}
+	hits[rule]++
+	return false
+}
+
+// tokenLength counts the runes of a UTF-8 word without decoding them
+func tokenLength[T string | []byte](word T) int {
+	length := 0
+	for i := 0; i < len(word); i++ {
+		// Every rune has exactly one byte that is not a continuation byte
+		if word[i]&0xC0 != 0x80 {
+			length++
+		}
+	}
+	return length
+}
+
+// isNumericToken reports whether word is made only of ASCII digits
+func isNumericToken[T string | []byte](word T) bool {
+	for i := 0; i < len(word); i++ {
+		if word[i] < '0' || word[i] > '9' {
+			return false
+		}
+	}
+	return len(word) > 0
+}
+
+// isHexToken reports whether word is a 0x number, or at least hexMinLength hex digits
+// mixing decimal digits and the letters a to f, like hashes and ids do
+func isHexToken[T string | []byte](word T) bool {
+	digits := word
+	prefixed := len(word) > 2 && word[0] == '0' && word[1] == 'x'
+	if prefixed {
+		digits = word[2:]
+	}
+
+	var decimal, letters bool
+	for i := 0; i < len(digits); i++ {
+		switch c := digits[i]; {
+		case '0' <= c && c <= '9':
+			decimal = true
+		case 'a' <= c && c <= 'f':
+			letters = true
+		default:
+			return false
+		}
+	}
+	return prefixed || (decimal && letters && len(digits) >= hexMinLength)
+}
+
+// dropRare removes the words of a file counted less often than MinCount, counting the removed occurrences
+func (r *TokenRules) dropRare(words []Word, stats *RunStats) []Word {
+	if r == nil || r.MinCount <= 1 {
+		return words
+	}
+
+	var hits tokenRuleHits
+	words = slices.DeleteFunc(words, func(word Word) bool {
+		if word.Count >= r.MinCount {
+			return false
+		}
+		hits[RuleMinCount] += int64(word.Count)
+		return true
+	})
+	stats.addTokenRuleHits(&hits)
+	return words
+}
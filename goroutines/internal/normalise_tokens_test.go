@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"maps"
+	"strings"
+	"testing"
+)
+
+// testRules are the rules of the shipped example, with a minimum count
+const testRules = `
+min_length = 2
+max_length = 12
+drop_numeric = true
+drop_hex = true
+allow = ["c"]
+min_count = 2
+
+[synonyms]
+kubernetes = ["k8s", "kube"]
+`
+
+// TestTokenRulesPipelinesAgree checks that every pipeline applies the rules alike and counts what each rule did
+func TestTokenRulesPipelinesAgree(t *testing.T) {
+	rules, err := ParseTokenRules(strings.NewReader(testRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := strings.Repeat("K8s and kube run on kubernetes in C x 2024 0x1f deadbeef42 extraordinarily-verbose-words ", 2) + "rare"
+	want := Frequency{"kubernetes": 6, "and": 2, "run": 2, "on": 2, "in": 2, "c": 2, "verbose": 2, "words": 2}
+	wantHits := tokenRuleHits{RuleSynonym: 4, RuleMinLength: 2, RuleMaxLength: 2, RuleNumeric: 2, RuleHex: 4, RuleMinCount: 1}
+
+	for _, mode := range []PipelineMode{PipelineStream, PipelineBatch, PipelineFused, PipelineBytes} {
+		stats := &RunStats{}
+		opts := CountOptions{Counters: 1, Pipeline: mode, Rules: rules, Stats: stats}
+
+		got := make(Frequency)
+		for _, word := range CountWordFrequencyInBytes([]byte(text), opts) {
+			got[word.Word] = word.Count
+		}
+		if !maps.Equal(got, want) {
+			t.Errorf("%s pipeline: got %v, want %v", mode, got, want)
+		}
+
+		var hits tokenRuleHits
+		for rule := range tokenRuleCount {
+			hits[rule] = stats.TokenRuleHits[rule].Load()
+		}
+		if hits != wantHits {
+			t.Errorf("%s pipeline: got rule hits %v, want %v", mode, hits, wantHits)
+		}
+	}
+}
+
+// TestParseTokenRulesErrors checks that misspelt and inconsistent rules are rejected
+func TestParseTokenRulesErrors(t *testing.T) {
+	for _, rules := range []string{
+		"min_lenght = 2",
+		"min_length = -1",
+		"drop_hex = 1",
+		"min_length = 5\nmax_length = 3",
+		"allow_only = true",
+		"[synonym]\nk8s = \"kubernetes\"",
+		"[synonyms]\nkubernetes = [\"k8s\"]\nk8s = [\"kube\"]",
+		"[synonyms]\nkubernetes = [\"kube\"]\ncube = [\"kube\"]",
+	} {
+		if _, err := ParseTokenRules(strings.NewReader(rules)); err == nil {
+			t.Errorf("got no error for %q", rules)
+		}
+	}
+
+	rules, err := ParseTokenRules(strings.NewReader("allow = [\"go\"]\nallow_only = true"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := CountWordFrequencyInBytes([]byte("Go is not rust, go"), CountOptions{Counters: 1, Rules: rules}); len(got) != 1 || got[0] != (Word{"go", 2}) {
+		t.Errorf("allowlist-only: got %v", got)
+	}
+}
@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/mdobak/go-xerrors"
+)
+
+// OpenPath opens a directory on local disk as an fs.FS. A regular file is opened as
+// its directory with only the file in it, so a single file is analysed like a directory.
+func OpenPath(p string) (fs.FS, error) {
+	info, err := os.Stat(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, xerrors.Newf("directory does not exist: %w", err)
+	}
+	if err != nil {
+		return nil, xerrors.Newf("failed to open %q: %w", p, err)
+	}
+
+	if info.IsDir() {
+		return os.DirFS(p), nil
+	}
+
+	return &singleFileFS{dir: os.DirFS(filepath.Dir(p)), entry: fs.FileInfoToDirEntry(info)}, nil
+}
+
+// singleFileFS shows one file of a directory at its root and hides the rest.
+// Files are still opened from the directory, so they can be memory mapped.
+type singleFileFS struct {
+	dir   fs.FS
+	entry fs.DirEntry
+}
+
+// Open implements fs.FS
+func (s *singleFileFS) Open(name string) (fs.File, error) {
+	switch name {
+	case s.entry.Name():
+		return s.dir.Open(name)
+	case ".":
+		info, err := fs.Stat(s.dir, ".")
+		if err != nil {
+			return nil, err
+		}
+		return &dirFile{name: name, info: info, entries: []fs.DirEntry{s.entry}}, nil
+	}
+
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// ReadDir implements fs.ReadDirFS; the root lists just the file
+func (s *singleFileFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name != "." {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	return []fs.DirEntry{s.entry}, nil
+}
@@ -0,0 +1,41 @@
+package internal
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// TestOpenPathSingleFile checks that a file argument is discovered alone, without its neighbours
+func TestOpenPathSingleFile(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("go gophers"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fsys, err := OpenPath(filepath.Join(dir, "b.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := GetTxtFiles(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"b.txt"}; !slices.Equal(files, want) {
+		t.Errorf("files: got %v, want %v", files, want)
+	}
+
+	if _, err := fs.ReadFile(fsys, "a.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("neighbouring file: got %v, want fs.ErrNotExist", err)
+	}
+
+	if _, err := OpenPath(filepath.Join(dir, "missing")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing path: got %v, want fs.ErrNotExist", err)
+	}
+}
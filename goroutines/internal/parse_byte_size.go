@@ -0,0 +1,41 @@
+package internal
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mdobak/go-xerrors"
+)
+
+// byteSizeUnits maps size suffixes to their multipliers, longest suffix first
+var byteSizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// ParseByteSize parses sizes such as "512KB", "100MB" or "1GB" (as used in config.toml)
+// A plain number is interpreted as bytes
+func ParseByteSize(size string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(size))
+	multiplier := int64(1)
+
+	for _, unit := range byteSizeUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number < 0 {
+		return 0, xerrors.Newf("invalid byte size %q", size)
+	}
+
+	return int64(number * float64(multiplier)), nil
+}
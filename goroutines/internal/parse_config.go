@@ -0,0 +1,197 @@
+package internal
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mdobak/go-xerrors"
+)
+
+// Config is a parsed TOML file: sections by name, the keys before any section under ""
+type Config map[string]ConfigSection
+
+// ConfigSection maps the keys of one section to string, int64, float64, bool or []any values
+type ConfigSection map[string]any
+
+// String returns the string value of key, or fallback if it is missing or not a string
+func (s ConfigSection) String(key, fallback string) string {
+	if value, ok := s[key].(string); ok {
+		return value
+	}
+	return fallback
+}
+
+// Int returns the integer value of key, or fallback if it is missing or not an integer
+func (s ConfigSection) Int(key string, fallback int) int {
+	if value, ok := s[key].(int64); ok {
+		return int(value)
+	}
+	return fallback
+}
+
+// LoadConfig reads the TOML file at path. A missing file is an error that matches fs.ErrNotExist,
+// so callers reading an implicit default can fall back to an empty config.
+func LoadConfig(path string) (Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, xerrors.Newf("failed to open config %q: %w", path, err)
+	}
+	defer file.Close()
+
+	config, err := ParseConfig(file)
+	if err != nil {
+		return nil, xerrors.Newf("failed to parse config %q: %w", path, err)
+	}
+	return config, nil
+}
+
+// ParseConfig reads the subset of TOML used by config.toml: [section] headers and
+// key = value lines with strings, integers, floats, booleans and single-line arrays.
+// Comments start with # outside strings. Nested tables and multi-line values are not supported.
+func ParseConfig(r io.Reader) (Config, error) {
+	config := Config{"": ConfigSection{}}
+	section := config[""]
+
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(stripConfigComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		if name, ok := strings.CutPrefix(line, "["); ok {
+			name, ok = strings.CutSuffix(name, "]")
+			if !ok || strings.TrimSpace(name) == "" {
+				return nil, xerrors.Newf("line %d: invalid section header %q", lineNumber, line)
+			}
+			name = strings.TrimSpace(name)
+			if config[name] == nil {
+				config[name] = ConfigSection{}
+			}
+			section = config[name]
+			continue
+		}
+
+		key, raw, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, xerrors.Newf("line %d: expected key = value, got %q", lineNumber, line)
+		}
+
+		value, err := parseConfigValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, xerrors.Newf("line %d: key %q: %w", lineNumber, key, err)
+		}
+		section[key] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, xerrors.Newf("failed to read config: %w", err)
+	}
+	return config, nil
+}
+
+// stripConfigComment drops a # comment, unless the # is inside a string
+func stripConfigComment(line string) string {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case '#':
+			if !quoted {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
+
+// parseConfigValue converts one TOML value
+func parseConfigValue(raw string) (any, error) {
+	switch {
+	case raw == "":
+		return nil, xerrors.New("missing value")
+	case raw == "true" || raw == "false":
+		return raw == "true", nil
+	case strings.HasPrefix(raw, `"`):
+		value, err := strconv.Unquote(raw)
+		if err != nil {
+			return nil, xerrors.Newf("invalid string %s", raw)
+		}
+		return value, nil
+	case strings.HasPrefix(raw, "'"):
+		value, ok := strings.CutSuffix(raw[1:], "'")
+		if !ok || strings.Contains(value, "'") {
+			return nil, xerrors.Newf("invalid literal string %s", raw)
+		}
+		return value, nil
+	case strings.HasPrefix(raw, "["):
+		return parseConfigArray(raw)
+	}
+
+	// TOML allows underscores between digits, e.g. 1_000
+	number := strings.ReplaceAll(raw, "_", "")
+	if value, err := strconv.ParseInt(number, 10, 64); err == nil {
+		return value, nil
+	}
+	if value, err := strconv.ParseFloat(number, 64); err == nil {
+		return value, nil
+	}
+	return nil, xerrors.Newf("unsupported value %s", raw)
+}
+
+// parseConfigArray converts a single-line array of scalar values
+func parseConfigArray(raw string) ([]any, error) {
+	inner, ok := strings.CutSuffix(raw[1:], "]")
+	if !ok {
+		return nil, xerrors.Newf("unterminated array %s", raw)
+	}
+
+	values := []any{}
+	for len(strings.TrimSpace(inner)) > 0 {
+		element, rest := splitConfigArray(inner)
+		if element = strings.TrimSpace(element); element == "" {
+			// A trailing comma is allowed
+			if strings.TrimSpace(rest) == "" {
+				break
+			}
+			return nil, xerrors.Newf("empty array element in %s", raw)
+		}
+
+		value, err := parseConfigValue(element)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		inner = rest
+	}
+	return values, nil
+}
+
+// splitConfigArray returns the first element of an array body and the rest after its comma
+func splitConfigArray(inner string) (string, string) {
+	quote := byte(0)
+	for i := 0; i < len(inner); i++ {
+		switch c := inner[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			return inner[:i], inner[i+1:]
+		}
+	}
+	return inner, ""
+}
@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseConfig checks sections, value types and comments
+func TestParseConfig(t *testing.T) {
+	text := `# top-level keys
+name = "wf # not a comment"
+workers = 1_000
+
+[logging]
+level = "debug"   # trailing comment
+verbose = true
+ratio = 0.5
+patterns = ["*.tmp", '.*', ]
+`
+
+	config, err := ParseConfig(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := config[""].String("name", ""); got != "wf # not a comment" {
+		t.Errorf("got name %q", got)
+	}
+	if got := config[""].Int("workers", 0); got != 1000 {
+		t.Errorf("got %d workers, want 1000", got)
+	}
+
+	want := ConfigSection{"level": "debug", "verbose": true, "ratio": 0.5, "patterns": []any{"*.tmp", ".*"}}
+	if !reflect.DeepEqual(config["logging"], want) {
+		t.Errorf("got logging %v, want %v", config["logging"], want)
+	}
+
+	// Missing sections and keys give the fallback
+	if got := config["output"].String("format", "json"); got != "json" {
+		t.Errorf("got format %q, want the fallback", got)
+	}
+}
+
+// TestParseConfigErrors checks that malformed lines are rejected with their line number
+func TestParseConfigErrors(t *testing.T) {
+	for _, text := range []string{"[logging", "level", `level = "debug`, "level = debug", "patterns = [1, 2"} {
+		if _, err := ParseConfig(strings.NewReader("\n" + text)); err == nil || !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("%s: got error %v", text, err)
+		}
+	}
+}
+
+// TestLoadConfigMissing checks that a missing file is an error callers can recognise
+func TestLoadConfigMissing(t *testing.T) {
+	_, err := LoadConfig(filepath.Join(t.TempDir(), "missing.toml"))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got error %v, want one matching fs.ErrNotExist", err)
+	}
+}
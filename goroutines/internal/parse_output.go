@@ -0,0 +1,240 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"strconv"
+	"strings"
+
+	"github.com/mdobak/go-xerrors"
+)
+
+// CorpusSectionName is the name of the corpus-wide section of approximate and merged results
+const CorpusSectionName = "corpus"
+
+// DuplicatesSectionName is the name of the section listing near-duplicate clusters
+const DuplicatesSectionName = "duplicates"
+
+// ResultFile is the JSON form of a written result
+type ResultFile struct {
+	Files []FileWordFrequency `json:"files"`
+	// Corpus holds corpus-wide estimates; only set in approximate mode
+	Corpus *ApproximateStats `json:"corpus,omitempty"`
+	// Aggregate holds exact corpus-wide counts; only set for merged results
+	Aggregate []Word `json:"aggregate,omitempty"`
+	// Collocations holds the corpus-wide word pairs; only set in collocation mode
+	Collocations *CollocationStats `json:"collocations,omitempty"`
+	// Duplicates holds the clusters of near-identical files; only set in duplicate detection mode
+	Duplicates []DuplicateCluster `json:"duplicates,omitempty"`
+}
+
+// ParseJSONResults reads a result written in JSON form
+func ParseJSONResults(r io.Reader) ([]FileWordFrequency, error) {
+	var result ResultFile
+	if err := json.NewDecoder(r).Decode(&result); err != nil {
+		return nil, xerrors.Newf("failed to decode JSON result: %w", err)
+	}
+
+	return result.Files, nil
+}
+
+// ScanJSONResults yields the files of a result written in JSON form one at a time,
+// so only one file result is decoded at once. The corpus-wide sections are skipped.
+// Iteration stops after the first error.
+func ScanJSONResults(r io.Reader) iter.Seq2[FileWordFrequency, error] {
+	return func(yield func(FileWordFrequency, error) bool) {
+		decoder := json.NewDecoder(r)
+		fail := func(err error) {
+			yield(FileWordFrequency{}, xerrors.Newf("failed to decode JSON result: %w", err))
+		}
+
+		if err := expectDelim(decoder, '{'); err != nil {
+			fail(err)
+			return
+		}
+
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				fail(err)
+				return
+			}
+
+			if key != "files" {
+				var skipped json.RawMessage
+				if err := decoder.Decode(&skipped); err != nil {
+					fail(err)
+					return
+				}
+				continue
+			}
+
+			if err := expectDelim(decoder, '['); err != nil {
+				fail(err)
+				return
+			}
+			for decoder.More() {
+				var result FileWordFrequency
+				if err := decoder.Decode(&result); err != nil {
+					fail(err)
+					return
+				}
+				if !yield(result, nil) {
+					return
+				}
+			}
+			if err := expectDelim(decoder, ']'); err != nil {
+				fail(err)
+				return
+			}
+		}
+	}
+}
+
+// expectDelim reads the next JSON token and checks that it is delim
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return xerrors.Newf("expected %q, got %v", delim, token)
+	}
+	return nil
+}
+
+// ParseHumanReadable reads results back from the format written by ToHumanReadable
+func ParseHumanReadable(r io.Reader) ([]FileWordFrequency, error) {
+	var results []FileWordFrequency
+	for result, err := range ScanHumanReadable(r) {
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// ScanHumanReadable yields the files of a result written by ToHumanReadable one at a time.
+// A file takes its Path from its path annotation. Path is left empty without one: the file is
+// then either at the top level or from a result written before paths were annotated.
+// Approximate sections keep their estimated counts; the corpus and duplicates sections are skipped.
+// Iteration stops after the first error.
+func ScanHumanReadable(r io.Reader) iter.Seq2[FileWordFrequency, error] {
+	return func(yield func(FileWordFrequency, error) bool) {
+		var current *FileWordFrequency
+		skipping := false
+
+		scanner := bufio.NewScanner(r)
+		for lineNumber := 1; scanner.Scan(); lineNumber++ {
+			line := scanner.Text()
+			if line == "" {
+				continue
+			}
+
+			// Section headers are the only unindented lines: "<file name>:"
+			if !strings.HasPrefix(line, "\t") {
+				name, ok := strings.CutSuffix(line, ":")
+				if !ok {
+					yield(FileWordFrequency{}, xerrors.Newf("line %d: expected a file name header, got %q", lineNumber, line))
+					return
+				}
+
+				// The previous file is complete once the next header starts
+				if current != nil && !yield(*current, nil) {
+					return
+				}
+				current = nil
+
+				skipping = name == CorpusSectionName || name == DuplicatesSectionName
+				if !skipping {
+					current = &FileWordFrequency{FileName: name}
+				}
+				continue
+			}
+
+			if skipping {
+				continue
+			}
+			if current == nil {
+				yield(FileWordFrequency{}, xerrors.Newf("line %d: word entry before any file name header", lineNumber))
+				return
+			}
+
+			entry := strings.TrimPrefix(line, "\t")
+
+			if path, ok := strings.CutPrefix(entry, "(path: "); ok {
+				current.Path = strings.TrimSuffix(path, ")")
+				continue
+			}
+
+			if annotation, ok := strings.CutPrefix(entry, "(readability: "); ok {
+				stats, err := parseReadability(annotation)
+				if err != nil {
+					yield(FileWordFrequency{}, xerrors.Newf("line %d: %w", lineNumber, err))
+					return
+				}
+				current.Readability = stats
+				continue
+			}
+
+			// Other annotations such as the approximate error bounds and nested
+			// entries such as collocations carry no word counts
+			if strings.HasPrefix(entry, "(") || strings.HasPrefix(entry, "\t") {
+				continue
+			}
+
+			word, count, err := parseWordEntry(entry)
+			if err != nil {
+				yield(FileWordFrequency{}, xerrors.Newf("line %d: %w", lineNumber, err))
+				return
+			}
+
+			current.Words = append(current.Words, Word{Word: word, Count: count})
+		}
+
+		if err := scanner.Err(); err != nil {
+			yield(FileWordFrequency{}, xerrors.Newf("failed to read result: %w", err))
+			return
+		}
+
+		if current != nil {
+			yield(*current, nil)
+		}
+	}
+}
+
+// parseReadability reads the counts of a readability annotation and recomputes its scores
+func parseReadability(annotation string) (*ReadabilityStats, error) {
+	var stats ReadabilityStats
+	_, err := fmt.Sscanf(annotation, readabilityCounts,
+		&stats.Sentences, &stats.Words, &stats.Syllables, &stats.DistinctWords, &stats.HapaxLegomena)
+	if err != nil {
+		return nil, xerrors.Newf("invalid readability annotation %q: %w", annotation, err)
+	}
+
+	stats.derive()
+	return &stats, nil
+}
+
+// parseWordEntry parses "word: 12" or the approximate form "word: ~12 (at least 9)"
+func parseWordEntry(entry string) (string, int, error) {
+	separator := strings.LastIndex(entry, ": ")
+	if separator <= 0 {
+		return "", 0, xerrors.Newf("invalid word entry %q", entry)
+	}
+
+	word := entry[:separator]
+	value := strings.TrimPrefix(entry[separator+2:], "~")
+	value, _, _ = strings.Cut(value, " ")
+
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		return "", 0, xerrors.Newf("invalid count in word entry %q", entry)
+	}
+
+	return word, count, nil
+}
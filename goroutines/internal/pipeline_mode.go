@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"github.com/mdobak/go-xerrors"
+)
+
+// PipelineMode selects how a text chunk is driven through the preprocessing stages.
+// The zero value is PipelineBatch, the mode the command line tool uses by default.
+type PipelineMode int
+
+const (
+	// PipelineBatch sends pooled word batches between stages (PreprocessTextBatched)
+	PipelineBatch PipelineMode = iota
+	// PipelineStream sends every single word over an unbuffered channel (PreprocessText)
+	PipelineStream
+	// PipelineFused runs all stages in one pass without goroutines (PreprocessTextFused)
+	PipelineFused
+	// PipelineBytes tokenises and counts directly over the file bytes (byteCounter)
+	PipelineBytes
+)
+
+// pipelineModeNames maps every mode to its command line name
+var pipelineModeNames = map[PipelineMode]string{
+	PipelineStream: "stream",
+	PipelineBatch:  "batch",
+	PipelineFused:  "fused",
+	PipelineBytes:  "bytes",
+}
+
+// String returns the command line name of the mode
+func (m PipelineMode) String() string {
+	if name, ok := pipelineModeNames[m]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParsePipelineMode converts a command line name into a PipelineMode
+func ParsePipelineMode(name string) (PipelineMode, error) {
+	for mode, modeName := range pipelineModeNames {
+		if modeName == name {
+			return mode, nil
+		}
+	}
+	return 0, xerrors.Newf("unknown pipeline mode %q (expected stream, batch, fused or bytes)", name)
+}
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"iter"
 	"strings"
 	"sync"
 	"unicode"
@@ -21,7 +22,23 @@ var builderPool = sync.Pool{
 }
 
 // TextPreprocessor handles text preprocessing using a pipeline pattern
-type TextPreprocessor struct{}
+type TextPreprocessor struct {
+	// Stopwords are dropped by the filter stage; nil disables filtering
+	Stopwords pkg.StopwordSet
+	// Rules normalise words ahead of the filter stage; nil keeps every word as it is
+	Rules *TokenRules
+	// Stats receives the number of words each rule rewrote or removed; it may be nil
+	Stats *RunStats
+	// Cooccurrences receives every word counted from the filter stage's output, so
+	// collocations are counted without tokenising the text again; it may be nil
+	Cooccurrences *CooccurrenceCounter
+	// MinHasher receives the same words as Cooccurrences, for the near-duplicate
+	// signature of the file; it may be nil
+	MinHasher *MinHasher
+
+	// timings receives the working time of every stage; nil leaves the stages untimed
+	timings *stageTimings
+}
 
 // ToLower creates a pipeline stage that converts text to lowercase
 func (tp *TextPreprocessor) ToLower(in <-chan string) <-chan string {
@@ -33,8 +50,13 @@ func (tp *TextPreprocessor) ToLower(in <-chan string) <-chan string {
 		// defer ensures output channel is properly closed
 		defer close(out)
 
+		clock := tp.timings.clock("lowercase")
+		defer clock.stop()
+
 		// Process each string from input channel until it's closed
 		for text := range in {
+			clock.run()
+
 			// Get builder from package-level pool to reduce allocations
 			builderIface := builderPool.Get()
 			builder := builderIface.(*strings.Builder)
@@ -52,6 +74,7 @@ func (tp *TextPreprocessor) ToLower(in <-chan string) <-chan string {
 			lowered := builder.String()
 			builder.Reset()
 			builderPool.Put(builder)
+			clock.pause()
 
 			// Send lowercased text to output
 			out <- lowered
@@ -73,8 +96,13 @@ func (tp *TextPreprocessor) RemovePunctuation(in <-chan string) <-chan string {
 		// defer ensures output channel is properly closed
 		defer close(out)
 
+		clock := tp.timings.clock("punctuation")
+		defer clock.stop()
+
 		// Process each string from input channel until it's closed
 		for text := range in {
+			clock.run()
+
 			// Get builder from package-level pool to reduce allocations
 			// Avoids allocating new builder for every punctuation removal
 			builderIface := builderPool.Get()
@@ -102,6 +130,7 @@ func (tp *TextPreprocessor) RemovePunctuation(in <-chan string) <-chan string {
 			// Reset again to ensure clean state for next user
 			builder.Reset()
 			builderPool.Put(builder)
+			clock.pause()
 
 			// Send cleaned text to output
 			out <- cleaned
@@ -123,17 +152,25 @@ func (tp *TextPreprocessor) SplitIntoWords(in <-chan string) <-chan string {
 		// defer ensures output channel is properly closed
 		defer close(out)
 
+		clock := tp.timings.clock("split")
+		defer clock.stop()
+
 		// Process each string from input channel until it's closed
 		for text := range in {
+			clock.run()
+
 			// Split text by whitespace into individual words
 			words := strings.FieldsSeq(text)
 
 			// Emit each non-empty word to output channel
 			for word := range words {
 				if len(word) > 0 { // Filter out empty strings
+					clock.pause()
 					out <- word
+					clock.run()
 				}
 			}
+			clock.pause()
 		}
 		// When input channel closes and all words emitted,
 		// defer close(out) signals consumer that no more words coming
@@ -153,11 +190,17 @@ func (tp *TextPreprocessor) FilterStopwords(in <-chan string) <-chan string {
 		// defer ensures output channel is properly closed
 		defer close(out)
 
+		clock := tp.timings.clock("filter")
+		defer clock.stop()
+
 		// Process each word from input channel until it's closed
 		for word := range in {
-			// Check if word is a stopword using lazy-initialized set
-			// sync.Once ensures stopwords load exactly once across all goroutines
-			if !pkg.IsStopword(word) {
+			// Check if word is a stopword - the set is read-only, safe to share across goroutines
+			clock.run()
+			stopword := tp.Stopwords.Contains(word)
+			clock.pause()
+
+			if !stopword {
 				// Emit non-stopword to output channel
 				out <- word
 			}
@@ -171,7 +214,35 @@ func (tp *TextPreprocessor) FilterStopwords(in <-chan string) <-chan string {
 	return out
 }
 
-// PreprocessText orchestrates the 4-stage pipeline for text preprocessing
+// NormaliseTokens creates a pipeline stage that rewrites aliases and drops the words removed by tp.Rules
+// The rule counters are added to tp.Stats once the input is drained
+func (tp *TextPreprocessor) NormaliseTokens(in <-chan string) <-chan string {
+	out := make(chan string)
+
+	go func() {
+		defer close(out)
+
+		clock := tp.timings.clock("normalise")
+		defer clock.stop()
+
+		var hits tokenRuleHits
+		for word := range in {
+			clock.run()
+			word, keep := tp.Rules.apply(word, &hits)
+			clock.pause()
+
+			if keep {
+				out <- word
+			}
+		}
+		tp.Stats.addTokenRuleHits(&hits)
+	}()
+
+	return out
+}
+
+// PreprocessText orchestrates the 4-stage pipeline for text preprocessing,
+// with a normalisation stage ahead of the stopword filter when tp.Rules is set
 func (tp *TextPreprocessor) PreprocessText(text string) <-chan string {
 	// Create unbuffered initial channel to feed raw text
 	input := make(chan string)
@@ -197,10 +268,296 @@ func (tp *TextPreprocessor) PreprocessText(text string) <-chan string {
 	// Stage 3: Split cleaned text into individual words
 	words := tp.SplitIntoWords(cleaned)
 
-	// Stage 4: Filter out stopwords using lazy-initialized set
+	// Stage 3b: Normalise words by the rules, if any
+	if tp.Rules != nil {
+		words = tp.NormaliseTokens(words)
+	}
+
+	// Stage 4: Filter out stopwords
 	filtered := tp.FilterStopwords(words)
 
 	// Return final word stream channel
 	// Consumer will receive individual cleaned, non-stopword words one by one
 	return filtered
 }
+
+// wordBatchSize is the number of words collected before a batch is sent downstream
+// Large enough to amortise channel synchronisation, small enough to stay cache friendly
+const wordBatchSize = 512
+
+// wordBatchPool is a package-level sync.Pool for reusing word batch slices
+// Batches travel between stages by pointer so the backing array can be recycled
+var wordBatchPool = sync.Pool{
+	New: func() any {
+		batch := make([]string, 0, wordBatchSize)
+		return &batch
+	},
+}
+
+// getWordBatch takes an empty batch from the pool
+func getWordBatch() *[]string {
+	batch := wordBatchPool.Get().(*[]string)
+	*batch = (*batch)[:0]
+	return batch
+}
+
+// putWordBatch clears a batch and returns it to the pool
+// Clearing drops references to the words so the chunk text can be collected
+func putWordBatch(batch *[]string) {
+	clear(*batch)
+	*batch = (*batch)[:0]
+	wordBatchPool.Put(batch)
+}
+
+// SplitIntoWordBatches creates a pipeline stage that splits text into batches of words
+// Unlike SplitIntoWords it sends one value per wordBatchSize words instead of one per word
+func (tp *TextPreprocessor) SplitIntoWordBatches(in <-chan string) <-chan *[]string {
+	out := make(chan *[]string)
+
+	go func() {
+		defer close(out)
+
+		clock := tp.timings.clock("split")
+		defer clock.stop()
+
+		for text := range in {
+			clock.run()
+			batch := getWordBatch()
+
+			for word := range strings.FieldsSeq(text) {
+				*batch = append(*batch, word)
+
+				// Hand over a full batch and start filling a fresh one
+				if len(*batch) == wordBatchSize {
+					clock.pause()
+					out <- batch
+					clock.run()
+					batch = getWordBatch()
+				}
+			}
+			clock.pause()
+
+			// Flush the remainder, recycling the batch if nothing was collected
+			if len(*batch) > 0 {
+				out <- batch
+			} else {
+				putWordBatch(batch)
+			}
+		}
+	}()
+
+	return out
+}
+
+// FilterStopwordBatches creates a pipeline stage that filters stopwords out of word batches
+// Filtering compacts each batch in place, so no new slices are allocated
+func (tp *TextPreprocessor) FilterStopwordBatches(in <-chan *[]string) <-chan *[]string {
+	out := make(chan *[]string)
+
+	go func() {
+		defer close(out)
+
+		clock := tp.timings.clock("filter")
+		defer clock.stop()
+
+		for batch := range in {
+			clock.run()
+			kept := (*batch)[:0]
+			for _, word := range *batch {
+				if !tp.Stopwords.Contains(word) {
+					kept = append(kept, word)
+				}
+			}
+
+			// Clear the tail so dropped words are not kept alive by the pool
+			clear((*batch)[len(kept):])
+			*batch = kept
+			clock.pause()
+
+			if len(kept) == 0 {
+				putWordBatch(batch)
+				continue
+			}
+
+			out <- batch
+		}
+	}()
+
+	return out
+}
+
+// NormaliseTokenBatches creates a pipeline stage that normalises word batches by tp.Rules
+// Like FilterStopwordBatches it compacts each batch in place
+func (tp *TextPreprocessor) NormaliseTokenBatches(in <-chan *[]string) <-chan *[]string {
+	out := make(chan *[]string)
+
+	go func() {
+		defer close(out)
+
+		clock := tp.timings.clock("normalise")
+		defer clock.stop()
+
+		var hits tokenRuleHits
+		for batch := range in {
+			clock.run()
+			kept := (*batch)[:0]
+			for _, word := range *batch {
+				if word, keep := tp.Rules.apply(word, &hits); keep {
+					kept = append(kept, word)
+				}
+			}
+
+			clear((*batch)[len(kept):])
+			*batch = kept
+			clock.pause()
+
+			if len(kept) == 0 {
+				putWordBatch(batch)
+				continue
+			}
+
+			out <- batch
+		}
+		tp.Stats.addTokenRuleHits(&hits)
+	}()
+
+	return out
+}
+
+// PreprocessTextBatched orchestrates the same 4 stages as PreprocessText,
+// but the word-level stages exchange pooled batches instead of single words.
+// Consumers must return every received batch with putWordBatch once done with it.
+func (tp *TextPreprocessor) PreprocessTextBatched(text string) <-chan *[]string {
+	input := make(chan string, 1)
+	input <- text
+	close(input)
+
+	lowercased := tp.ToLower(input)
+	cleaned := tp.RemovePunctuation(lowercased)
+	batches := tp.SplitIntoWordBatches(cleaned)
+	if tp.Rules != nil {
+		batches = tp.NormaliseTokenBatches(batches)
+	}
+
+	return tp.FilterStopwordBatches(batches)
+}
+
+// PreprocessTextFused runs all 4 stages in a single pass on the calling goroutine.
+// Lowercasing and punctuation removal share one pooled builder, and words are
+// yielded straight from the cleaned text without any channel or goroutine.
+func (tp *TextPreprocessor) PreprocessTextFused(text string) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		clean := tp.timings.clock("clean")
+		clean.run()
+
+		builder := builderPool.Get().(*strings.Builder)
+		builder.Reset()
+		builder.Grow(len(text))
+
+		// Stages 1 and 2: lowercase letters and digits, turn everything else into spaces
+		for _, r := range text {
+			r = unicode.ToLower(r)
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) {
+				builder.WriteRune(r)
+			} else {
+				builder.WriteRune(' ')
+			}
+		}
+
+		cleaned := builder.String()
+		builder.Reset()
+		builderPool.Put(builder)
+
+		clean.pause()
+		clean.stop()
+
+		// Stages 3 and 4 are timed together with the counting of the words they yield
+		tokenise := tp.timings.clock("tokenise")
+		tokenise.run()
+		defer func() {
+			tokenise.pause()
+			tokenise.stop()
+		}()
+
+		// Stages 3 and 4: split into words, normalise them and drop stopwords
+		var hits tokenRuleHits
+		defer tp.Stats.addTokenRuleHits(&hits)
+
+		for word := range strings.FieldsSeq(cleaned) {
+			word, keep := tp.Rules.apply(word, &hits)
+			if !keep || tp.Stopwords.Contains(word) {
+				continue
+			}
+			if !yield(word) {
+				return
+			}
+		}
+	}
+}
+
+// Token is a preprocessed word together with where it occurs in the text
+type Token struct {
+	Word string
+	// Position is the ordinal of the word in the text, counting stopwords too,
+	// so adjacent words always have consecutive positions
+	Position int
+	// Line is the 1-based line of the word
+	Line int
+	// Offset is the byte offset of the first byte of the word in the text
+	Offset int
+}
+
+// PreprocessTextPositioned runs the same stages as PreprocessTextFused, but keeps
+// track of where every word starts so the words can be indexed. Stopwords and the
+// words removed by tp.Rules are dropped from the output, but still advance Position.
+func (tp *TextPreprocessor) PreprocessTextPositioned(text string) iter.Seq[Token] {
+	return func(yield func(Token) bool) {
+		// Every word gets its own small buffer, as the words outlive the call
+		var builder strings.Builder
+
+		var hits tokenRuleHits
+		defer tp.Stats.addTokenRuleHits(&hits)
+
+		position, line := 0, 1
+		start := -1
+
+		// emit finishes the word being built; it returns false when the consumer stopped
+		emit := func() bool {
+			word, keep := tp.Rules.apply(builder.String(), &hits)
+			builder.Reset()
+
+			token := Token{Word: word, Position: position, Line: line, Offset: start}
+			position++
+			start = -1
+
+			if !keep || tp.Stopwords.Contains(word) {
+				return true
+			}
+			return yield(token)
+		}
+
+		for i, r := range text {
+			// Stages 1 and 2: letters and digits form words, everything else separates them
+			r = unicode.ToLower(r)
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				if start < 0 {
+					start = i
+				}
+				builder.WriteRune(r)
+				continue
+			}
+
+			// Stages 3 and 4: a separator ends the current word, which is normalised and dropped if it is a stopword
+			if start >= 0 && !emit() {
+				return
+			}
+			if r == '\n' {
+				line++
+			}
+		}
+
+		if start >= 0 {
+			emit()
+		}
+	}
+}
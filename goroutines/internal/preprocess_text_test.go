@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"maps"
+	"os"
+	"testing"
+
+	"github.com/DonAlexandro/go_advanced/pkg"
+)
+
+// loadBenchmarkText reads the largest sample file shipped with the project
+func loadBenchmarkText(tb testing.TB) string {
+	tb.Helper()
+
+	content, err := os.ReadFile("../assets/large.txt")
+	if err != nil {
+		tb.Fatalf("failed to read benchmark text: %v", err)
+	}
+	return string(content)
+}
+
+// loadTestStopwords reads the stopwords shipped with the project
+func loadTestStopwords(tb testing.TB) pkg.StopwordSet {
+	tb.Helper()
+
+	stopwords, err := pkg.LoadStopwordsFile("../stopwords.txt")
+	if err != nil {
+		tb.Fatalf("failed to read stopwords: %v", err)
+	}
+	return stopwords
+}
+
+// TestPipelineModesAgree verifies that every pipeline mode produces the same frequencies
+func TestPipelineModesAgree(t *testing.T) {
+	text := loadBenchmarkText(t)
+	stopwords := loadTestStopwords(t)
+	want := countWordFrequencyInChunk(text, PipelineStream, TextPreprocessor{Stopwords: stopwords})
+
+	for _, mode := range []PipelineMode{PipelineBatch, PipelineFused, PipelineBytes} {
+		got := countWordFrequencyInChunk(text, mode, TextPreprocessor{Stopwords: stopwords})
+		if !maps.Equal(got, want) {
+			t.Errorf("%s pipeline: got %d distinct words, want %d", mode, len(got), len(want))
+		}
+	}
+}
+
+// benchmarkPipeline measures counting a whole file through the given pipeline mode
+func benchmarkPipeline(b *testing.B, mode PipelineMode) {
+	text := loadBenchmarkText(b)
+	stopwords := loadTestStopwords(b)
+	b.SetBytes(int64(len(text)))
+	b.ReportAllocs()
+
+	for b.Loop() {
+		countWordFrequencyInChunk(text, mode, TextPreprocessor{Stopwords: stopwords})
+	}
+}
+
+// BenchmarkPipelineStream measures the original one-send-per-word pipeline
+func BenchmarkPipelineStream(b *testing.B) {
+	benchmarkPipeline(b, PipelineStream)
+}
+
+// BenchmarkPipelineBatch measures the pipeline exchanging pooled word batches
+func BenchmarkPipelineBatch(b *testing.B) {
+	benchmarkPipeline(b, PipelineBatch)
+}
+
+// BenchmarkPipelineBytes measures the zero-copy byte tokenizer on a string chunk
+func BenchmarkPipelineBytes(b *testing.B) {
+	benchmarkPipeline(b, PipelineBytes)
+}
+
+// BenchmarkPipelineFused measures the single-pass pipeline without goroutines
+func BenchmarkPipelineFused(b *testing.B) {
+	benchmarkPipeline(b, PipelineFused)
+}
@@ -0,0 +1,199 @@
+package internal
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mdobak/go-xerrors"
+)
+
+// QuerySort selects the order of query rows
+type QuerySort int
+
+const (
+	// QuerySortDefault orders by file for per-file queries and by count otherwise
+	QuerySortDefault QuerySort = iota
+	// QuerySortCount orders by count (descending), then word, then file
+	QuerySortCount
+	// QuerySortWord orders by word, then count (descending), then file
+	QuerySortWord
+	// QuerySortFile orders by file, then count (descending), then word
+	QuerySortFile
+)
+
+// ParseQuerySort converts a command line name into a QuerySort
+func ParseQuerySort(name string) (QuerySort, error) {
+	switch name {
+	case "":
+		return QuerySortDefault, nil
+	case "count":
+		return QuerySortCount, nil
+	case "word":
+		return QuerySortWord, nil
+	case "file":
+		return QuerySortFile, nil
+	}
+	return 0, xerrors.Newf("unknown sort %q (expected count, word or file)", name)
+}
+
+// Query selects words from stored results
+type Query struct {
+	// Word looks up one word across files instead of listing top words
+	Word string
+	// PerFile lists the top words of every file instead of the corpus-wide top words
+	PerFile bool
+	// Top limits the rows (per file with PerFile); 0 keeps all
+	Top int
+	// MinCount drops words counted fewer times
+	MinCount int
+	// FileGlob keeps only matching files (path.Match syntax); patterns without
+	// a slash are also matched against the file name
+	FileGlob string
+	Sort     QuerySort
+	// Reverse inverts the order chosen by Sort
+	Reverse bool
+}
+
+// QueryRow is one word of a query result; File is empty for corpus-wide rows
+type QueryRow struct {
+	File  string `json:"file,omitempty"`
+	Word  string `json:"word"`
+	Count int    `json:"count"`
+}
+
+// RunQuery answers q over results
+func RunQuery(results []FileWordFrequency, q Query) ([]QueryRow, error) {
+	files, err := FilterResults(results, q.FileGlob)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []QueryRow
+	switch {
+	case q.Word != "":
+		word := strings.ToLower(q.Word)
+		for _, file := range files {
+			for _, w := range file.Words {
+				if w.Word == word && w.Count >= q.MinCount {
+					rows = append(rows, QueryRow{File: mergedFileKey(file), Word: w.Word, Count: w.Count})
+				}
+			}
+		}
+
+	case q.PerFile:
+		for _, file := range files {
+			words := slices.Clone(file.Words)
+			SortWords(words)
+
+			var fileRows []QueryRow
+			for _, w := range words {
+				if w.Count >= q.MinCount {
+					fileRows = append(fileRows, QueryRow{File: mergedFileKey(file), Word: w.Word, Count: w.Count})
+				}
+			}
+			rows = append(rows, truncate(fileRows, q.Top)...)
+		}
+
+	default:
+		for _, w := range convertFrequencyToWord(corpusFrequency(files)) {
+			if w.Count >= q.MinCount {
+				rows = append(rows, QueryRow{Word: w.Word, Count: w.Count})
+			}
+		}
+	}
+
+	sortQueryRows(rows, q)
+
+	// Per-file queries are already limited per file
+	if !q.PerFile || q.Word != "" {
+		rows = truncate(rows, q.Top)
+	}
+
+	return rows, nil
+}
+
+// FilterResults keeps the results whose path (or file name) matches glob; an empty glob keeps all
+func FilterResults(results []FileWordFrequency, glob string) ([]FileWordFrequency, error) {
+	if glob == "" {
+		return results, nil
+	}
+
+	if _, err := path.Match(glob, ""); err != nil {
+		return nil, xerrors.Newf("invalid file glob %q: %w", glob, err)
+	}
+
+	var filtered []FileWordFrequency
+	for _, result := range results {
+		matched, _ := path.Match(glob, mergedFileKey(result))
+		if !matched && !strings.Contains(glob, "/") {
+			matched, _ = path.Match(glob, result.FileName)
+		}
+		if matched {
+			filtered = append(filtered, result)
+		}
+	}
+
+	return filtered, nil
+}
+
+// sortQueryRows orders rows by the sort of q
+func sortQueryRows(rows []QueryRow, q Query) {
+	order := q.Sort
+	if order == QuerySortDefault {
+		order = QuerySortCount
+		if q.PerFile && q.Word == "" {
+			order = QuerySortFile
+		}
+	}
+
+	byCount := func(a, b QueryRow) int { return cmp.Compare(b.Count, a.Count) }
+	byWord := func(a, b QueryRow) int { return strings.Compare(a.Word, b.Word) }
+	byFile := func(a, b QueryRow) int { return strings.Compare(a.File, b.File) }
+
+	keys := []func(a, b QueryRow) int{byCount, byWord, byFile}
+	switch order {
+	case QuerySortWord:
+		keys = []func(a, b QueryRow) int{byWord, byCount, byFile}
+	case QuerySortFile:
+		keys = []func(a, b QueryRow) int{byFile, byCount, byWord}
+	}
+
+	slices.SortStableFunc(rows, func(a, b QueryRow) int {
+		for _, key := range keys {
+			if c := key(a, b); c != 0 {
+				if q.Reverse {
+					return -c
+				}
+				return c
+			}
+		}
+		return 0
+	})
+}
+
+// WriteQueryTable writes query rows as an aligned plain-text table
+func WriteQueryTable(w io.Writer, rows []QueryRow) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	withFiles := slices.ContainsFunc(rows, func(row QueryRow) bool { return row.File != "" })
+	if withFiles {
+		fmt.Fprintln(tw, "file\tword\tcount\t")
+	} else {
+		fmt.Fprintln(tw, "word\tcount\t")
+	}
+
+	for _, row := range rows {
+		if withFiles {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t\n", row.File, row.Word, row.Count)
+		} else {
+			fmt.Fprintf(tw, "%s\t%d\t\n", row.Word, row.Count)
+		}
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestRunQuery checks word lookup, per-file top words, corpus-wide top words and filters
+func TestRunQuery(t *testing.T) {
+	results := []FileWordFrequency{
+		{FileName: "a.txt", Path: "logs/a.txt", Words: []Word{{"timeout", 3}, {"retry", 1}}},
+		{FileName: "b.txt", Path: "logs/b.txt", Words: []Word{{"timeout", 7}, {"ok", 2}}},
+		{FileName: "c.txt", Path: "docs/c.txt", Words: []Word{{"ok", 9}}},
+	}
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []QueryRow
+	}{
+		{"lookup", Query{Word: "Timeout"}, []QueryRow{{"logs/b.txt", "timeout", 7}, {"logs/a.txt", "timeout", 3}}},
+		{"corpus top", Query{Top: 2}, []QueryRow{{"", "ok", 11}, {"", "timeout", 10}}},
+		{"min count", Query{MinCount: 3, Sort: QuerySortWord}, []QueryRow{{"", "ok", 11}, {"", "timeout", 10}}},
+		{"glob", Query{FileGlob: "logs/*", Top: 1}, []QueryRow{{"", "timeout", 10}}},
+		{"file name glob", Query{FileGlob: "c.*"}, []QueryRow{{"", "ok", 9}}},
+		{"per file", Query{PerFile: true, Top: 1, FileGlob: "logs/*"}, []QueryRow{{"logs/a.txt", "timeout", 3}, {"logs/b.txt", "timeout", 7}}},
+		{"reverse", Query{Word: "timeout", Reverse: true}, []QueryRow{{"logs/a.txt", "timeout", 3}, {"logs/b.txt", "timeout", 7}}},
+	}
+
+	for _, tt := range tests {
+		got, err := RunQuery(results, tt.query)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := RunQuery(results, Query{FileGlob: "["}); err == nil {
+		t.Error("expected an error for an invalid glob")
+	}
+}
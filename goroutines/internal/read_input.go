@@ -0,0 +1,207 @@
+package internal
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"log/slog"
+	"path"
+	"strings"
+
+	"github.com/mdobak/go-xerrors"
+)
+
+// InputMode selects how CountWordFrequency loads a file
+type InputMode int
+
+const (
+	// InputReadFile reads the whole file into memory
+	InputReadFile InputMode = iota
+	// InputMmap maps large regular files on disk into memory, falling back to reading otherwise
+	InputMmap
+)
+
+// String returns the command line name of the mode
+func (m InputMode) String() string {
+	if m == InputMmap {
+		return "mmap"
+	}
+	return "read"
+}
+
+// ParseInputMode converts a command line name into an InputMode
+func ParseInputMode(name string) (InputMode, error) {
+	switch name {
+	case "read":
+		return InputReadFile, nil
+	case "mmap":
+		return InputMmap, nil
+	}
+	return 0, xerrors.Newf("unknown input mode %q (expected read or mmap)", name)
+}
+
+// mmapMinSize is the smallest file that is worth mapping
+// Below this size the mmap/munmap syscalls cost more than simply copying the file
+const mmapMinSize = 64 * 1024
+
+// compressedExtensions name compressed files, which are not worth mapping:
+// their bytes would have to be decompressed into memory anyway.
+// Nothing is decompressed and discovery does not list such files, so this only
+// applies to a compressed file passed to CountWordFrequency by name, which reads its raw bytes.
+var compressedExtensions = map[string]struct{}{".gz": {}, ".bz2": {}, ".xz": {}, ".zst": {}}
+
+// inputMethod records how a file was actually read
+type inputMethod int
+
+const (
+	inputMethodReadFile inputMethod = iota
+	inputMethodMmap
+)
+
+// mmapFallbackReason records why InputMmap fell back to reading the file
+type mmapFallbackReason int
+
+const (
+	mmapFallbackSmall mmapFallbackReason = iota
+	mmapFallbackSpecial
+	mmapFallbackCompressed
+	mmapFallbackError
+	mmapFallbackVirtual
+)
+
+// fileInput is the content of a file together with how it may be used
+type fileInput struct {
+	data []byte
+	// writable is false for mappings, which must not be modified
+	writable bool
+	method   inputMethod
+	// release unmaps the file; it is a no-op for heap buffers
+	release func() error
+}
+
+// readInput loads name from fsys and blanks out the text opts.Redactor finds,
+// so that no later stage, collectors included, sees it
+func readInput(fsys fs.FS, name string, opts CountOptions) (fileInput, error) {
+	input, err := readExtractedInput(fsys, name, opts)
+	if err != nil || opts.Redactor == nil {
+		return input, err
+	}
+
+	redacted := opts.Redactor.Redact(name, input.data, input.writable)
+	if input.writable || opts.Redactor.File(name) == nil {
+		input.data = redacted
+		return input, nil
+	}
+
+	// A mapping with matches was copied, so it is released now and the copy counted instead
+	if err := input.release(); err != nil {
+		return fileInput{}, xerrors.Newf("failed to release a file %q: %w", name, err)
+	}
+	return fileInput{
+		data:     redacted,
+		writable: true,
+		method:   input.method,
+		release:  func() error { return nil },
+	}, nil
+}
+
+// readExtractedInput loads name from fsys using the requested input mode and extracts its text
+// The choice is recorded in opts.Stats and the raw content hashed into opts.Digests
+func readExtractedInput(fsys fs.FS, name string, opts CountOptions) (fileInput, error) {
+	stats := opts.Stats
+
+	file, err := fsys.Open(name)
+	if err != nil {
+		return fileInput{}, xerrors.Newf("failed to open a file %q: %w", name, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fileInput{}, xerrors.Newf("failed to stat a file %q: %w", name, err)
+	}
+	SpanFromContext(opts.Context).SetAttributes(slog.Int64("file.size", info.Size()))
+
+	if opts.Input == InputMmap {
+		input, reason := mmapInput(name, file, info)
+		if input.data != nil {
+			opts.Digests.record(name, input.data)
+			stats.addInput(input.method, len(input.data))
+			return extractInput(name, input, opts)
+		}
+
+		stats.addMmapFallback(reason)
+	}
+
+	content, err := readAll(file, info.Size())
+	if err != nil {
+		return fileInput{}, xerrors.Newf("failed to read a file %q: %w", name, err)
+	}
+
+	opts.Digests.record(name, content)
+
+	input := fileInput{
+		data:     content,
+		writable: true,
+		method:   inputMethodReadFile,
+		release:  func() error { return nil },
+	}
+	stats.addInput(input.method, len(input.data))
+
+	// Markup is reduced to its text before it reaches the preprocessing pipeline
+	return extractInput(name, input, opts)
+}
+
+// mappableFile is implemented by *os.File, which is what os.DirFS hands out.
+// Files of archives and in-memory file systems do not have a descriptor to map.
+type mappableFile interface {
+	io.ReaderAt
+	Fd() uintptr
+}
+
+// mmapInput maps file when it is a large, uncompressed regular file on disk.
+// A zero fileInput with a reason is returned when the caller should fall back to reading.
+func mmapInput(name string, file fs.File, info fs.FileInfo) (fileInput, mmapFallbackReason) {
+	mappable, ok := file.(mappableFile)
+	if !ok {
+		return fileInput{}, mmapFallbackVirtual
+	}
+
+	// Pipes, devices and procfs entries cannot be mapped reliably
+	if !info.Mode().IsRegular() {
+		return fileInput{}, mmapFallbackSpecial
+	}
+
+	if info.Size() < mmapMinSize {
+		return fileInput{}, mmapFallbackSmall
+	}
+
+	// Compressed files are recognised by name, so no input pays for sniffing its first bytes
+	if _, ok := compressedExtensions[path.Ext(strings.ToLower(name))]; ok {
+		return fileInput{}, mmapFallbackCompressed
+	}
+
+	data, err := mmapFile(mappable.Fd(), info.Size())
+	if err != nil {
+		return fileInput{}, mmapFallbackError
+	}
+
+	return fileInput{
+		data:     data,
+		writable: false,
+		method:   inputMethodMmap,
+		release:  func() error { return munmapFile(data) },
+	}, 0
+}
+
+// readAll reads the whole file, allocating once when the size is known up front
+func readAll(file fs.File, size int64) ([]byte, error) {
+	var buffer bytes.Buffer
+	if size > 0 {
+		// One extra byte lets ReadFrom hit EOF without growing the buffer
+		buffer.Grow(int(size) + 1)
+	}
+
+	_, err := buffer.ReadFrom(file)
+	return buffer.Bytes(), err
+}
@@ -0,0 +1,308 @@
+package internal
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/mdobak/go-xerrors"
+)
+
+// RedactMode selects what happens to redacted text
+type RedactMode int
+
+const (
+	// RedactReplace counts every match as its class token, e.g. <EMAIL>
+	RedactReplace RedactMode = iota
+	// RedactDrop leaves matches out of the counts
+	RedactDrop
+)
+
+// String returns the command line name of the mode
+func (m RedactMode) String() string {
+	if m == RedactDrop {
+		return "drop"
+	}
+	return "replace"
+}
+
+// MarshalText encodes the mode by name, e.g. in the run manifest
+func (m RedactMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// ParseRedactMode converts a command line name into a RedactMode
+func ParseRedactMode(name string) (RedactMode, error) {
+	switch name {
+	case "replace":
+		return RedactReplace, nil
+	case "drop":
+		return RedactDrop, nil
+	}
+	return 0, xerrors.Newf("unknown redaction mode %q (expected replace or drop)", name)
+}
+
+// RedactionClass is a named pattern of sensitive text
+type RedactionClass struct {
+	// Name is lowercase; the class token is the uppercased name in angle brackets
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+}
+
+// BuiltinRedactionClasses are the predefined classes, in the order they are tried.
+// Text is scanned left to right, and where several classes match at the same position
+// the earlier one wins, so e.g. a card number is not taken for a phone number.
+var BuiltinRedactionClasses = []RedactionClass{
+	{"email", `[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`},
+	{"uuid", `\b[0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{12}\b`},
+	{"ipv6", `(?:[0-9A-Fa-f]{1,4}:){7}[0-9A-Fa-f]{1,4}|(?:[0-9A-Fa-f]{1,4}:){1,6}:(?:[0-9A-Fa-f]{1,4}(?::[0-9A-Fa-f]{1,4}){0,5})?\b`},
+	{"ipv4", `\b(?:(?:25[0-5]|2[0-4][0-9]|1[0-9][0-9]|[1-9]?[0-9])\.){3}(?:25[0-5]|2[0-4][0-9]|1[0-9][0-9]|[1-9]?[0-9])\b`},
+	{"card", cardPattern},
+	{"phone", `(?:\+[0-9]{1,3}[ .-]?)?(?:\([0-9]{2,4}\)|\b[0-9]{2,4})[ .-][0-9]{3,4}[ .-][0-9]{3,4}\b`},
+}
+
+// cardPattern matches 13 to 19 digits, optionally grouped by spaces or dashes.
+// Matches must also pass the Luhn checksum, which the pattern cannot check.
+const cardPattern = `\b(?:[0-9][ -]?){12,18}[0-9]\b`
+
+// redactionValidators check the matches of built-in classes beyond what their pattern can.
+// They are keyed by the whole class, so a custom class that reuses a name is not validated.
+var redactionValidators = map[RedactionClass]func([]byte) bool{
+	{"card", cardPattern}: luhnValid,
+}
+
+// luhnValid reports whether the digits of number pass the Luhn checksum; separators are skipped.
+// Every second digit from the right is doubled, and the digit sum must be a multiple of 10.
+func luhnValid(number []byte) bool {
+	sum, double := 0, false
+	for i := len(number) - 1; i >= 0; i-- {
+		if number[i] < '0' || number[i] > '9' {
+			continue
+		}
+
+		digit := int(number[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// RedactionOptions configures the redaction stage
+type RedactionOptions struct {
+	Mode RedactMode `json:"mode"`
+	// Classes are matched in order; the names must be unique
+	Classes []RedactionClass `json:"classes"`
+}
+
+// ParseRedactionClasses looks up comma-separated built-in class names; "all" selects every one
+func ParseRedactionClasses(names string) ([]RedactionClass, error) {
+	if strings.TrimSpace(names) == "all" {
+		return slices.Clone(BuiltinRedactionClasses), nil
+	}
+
+	var classes []RedactionClass
+	for name := range strings.SplitSeq(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		index := slices.IndexFunc(BuiltinRedactionClasses, func(class RedactionClass) bool { return class.Name == name })
+		if index < 0 {
+			return nil, xerrors.Newf("unknown redaction class %q (expected email, uuid, ipv6, ipv4, card, phone or all)", name)
+		}
+		classes = append(classes, BuiltinRedactionClasses[index])
+	}
+	return classes, nil
+}
+
+// ParseRedactionClass parses a custom class written as name=regexp
+func ParseRedactionClass(definition string) (RedactionClass, error) {
+	name, pattern, ok := strings.Cut(definition, "=")
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !ok || name == "" || pattern == "" {
+		return RedactionClass{}, xerrors.Newf("invalid redaction class %q (expected name=regexp)", definition)
+	}
+	return RedactionClass{Name: name, Pattern: pattern}, nil
+}
+
+// classToken is the word a class is counted as in replace mode
+func classToken(name string) string {
+	return "<" + strings.ToUpper(name) + ">"
+}
+
+// Redactor finds the classes of sensitive text in every file read and blanks them out before
+// any other stage sees the content, counting the matches per class and file.
+// When redaction is off it is nil and content is passed through untouched.
+type Redactor struct {
+	mode RedactMode
+	// re is one alternation of all classes, so the text is scanned once; group i+1 is class i
+	re    *regexp.Regexp
+	names []string
+	// validators[i] checks the matches of class i, if its pattern alone is not enough
+	validators []func([]byte) bool
+	// rest[i] is the alternation of the classes after a validated class i. A match rejected
+	// by its validator is searched again for them, so a number that is no card may be a phone.
+	rest []*regexp.Regexp
+
+	mu    sync.Mutex
+	files map[string]map[string]int
+}
+
+// NewRedactor compiles the classes of opts
+func NewRedactor(opts RedactionOptions) (*Redactor, error) {
+	if len(opts.Classes) == 0 {
+		return nil, xerrors.New("redaction needs at least one class")
+	}
+
+	groups := make([]string, 0, len(opts.Classes))
+	names := make([]string, 0, len(opts.Classes))
+	for _, class := range opts.Classes {
+		if slices.Contains(names, class.Name) {
+			return nil, xerrors.Newf("duplicate redaction class %q", class.Name)
+		}
+		// Each class is compiled on its own first, so an error names the class
+		if _, err := regexp.Compile(class.Pattern); err != nil {
+			return nil, xerrors.Newf("invalid pattern of redaction class %q: %w", class.Name, err)
+		}
+
+		groups = append(groups, "("+class.Pattern+")")
+		names = append(names, class.Name)
+	}
+
+	re, err := regexp.Compile(strings.Join(groups, "|"))
+	if err != nil {
+		return nil, xerrors.Newf("invalid redaction patterns: %w", err)
+	}
+
+	// Every pattern compiled on its own and together with all of them, so the rest compile too
+	validators := make([]func([]byte) bool, len(opts.Classes))
+	rest := make([]*regexp.Regexp, len(opts.Classes))
+	for i, class := range opts.Classes {
+		validators[i] = redactionValidators[class]
+		if validators[i] != nil && i+1 < len(groups) {
+			rest[i] = regexp.MustCompile(strings.Join(groups[i+1:], "|"))
+		}
+	}
+
+	return &Redactor{mode: opts.Mode, re: re, names: names, validators: validators, rest: rest, files: make(map[string]map[string]int)}, nil
+}
+
+// Redact blanks every match in content with spaces and records the matches of the file.
+// Blanking keeps every byte offset, so index positions still point into the original file.
+// content is changed in place when writable, and copied otherwise.
+func (r *Redactor) Redact(filePath string, content []byte, writable bool) []byte {
+	if r == nil {
+		return content
+	}
+
+	counts := make(map[string]int)
+	matches := r.re.FindAllSubmatchIndex(content, -1)
+	if len(matches) > 0 && !writable {
+		content = slices.Clone(content)
+	}
+
+	for _, match := range matches {
+		r.redact(content, match, 0, 0, counts)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.files[filePath] = counts
+	return content
+}
+
+// redact blanks one match of the alternation of the classes from first on, found offset bytes
+// into content, and counts it. A match its class rejects is searched again for the classes after it.
+func (r *Redactor) redact(content []byte, match []int, offset, first int, counts map[string]int) {
+	start, end := offset+match[0], offset+match[1]
+	// Custom patterns may match the empty string, which there is nothing to redact of
+	if start == end {
+		return
+	}
+
+	class := first
+	for class < len(r.names)-1 && match[2+2*(class-first)] < 0 {
+		class++
+	}
+
+	if validate := r.validators[class]; validate != nil && !validate(content[start:end]) {
+		if r.rest[class] != nil {
+			for _, inner := range r.rest[class].FindAllSubmatchIndex(content[start:end], -1) {
+				r.redact(content, inner, start, class+1, counts)
+			}
+		}
+		return
+	}
+
+	counts[r.names[class]]++
+	for i := start; i < end; i++ {
+		content[i] = ' '
+	}
+}
+
+// File returns the number of matches per class in one file, or nil if it had none
+func (r *Redactor) File(filePath string) map[string]int {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.files[filePath]) == 0 {
+		return nil
+	}
+	return maps.Clone(r.files[filePath])
+}
+
+// tokens returns the class tokens a file is counted with in replace mode
+func (r *Redactor) tokens(filePath string) Frequency {
+	if r == nil || r.mode != RedactReplace {
+		return nil
+	}
+
+	tokens := make(Frequency)
+	for class, count := range r.File(filePath) {
+		tokens[classToken(class)] = count
+	}
+	return tokens
+}
+
+// addTokens adds the class tokens of a file to its counted words
+func (r *Redactor) addTokens(filePath string, words []Word) []Word {
+	tokens := r.tokens(filePath)
+	if len(tokens) == 0 {
+		return words
+	}
+
+	for i, word := range words {
+		if count, ok := tokens[word.Word]; ok {
+			words[i].Count += count
+			delete(tokens, word.Word)
+		}
+	}
+	for _, class := range slices.Sorted(maps.Keys(tokens)) {
+		words = append(words, Word{Word: class, Count: tokens[class]})
+	}
+	return words
+}
+
+// RedactionsToHumanReadable formats counts per class as "email 2, ipv4 1", ordered by class
+func RedactionsToHumanReadable(counts map[string]int) string {
+	parts := make([]string, 0, len(counts))
+	for _, class := range slices.Sorted(maps.Keys(counts)) {
+		parts = append(parts, fmt.Sprintf("%s %d", class, counts[class]))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestRedactorClasses checks that every built-in class is found and blanked without moving the text around it
+func TestRedactorClasses(t *testing.T) {
+	redactor, err := NewRedactor(RedactionOptions{Classes: BuiltinRedactionClasses})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := "mail jane.doe@example.com from 192.168.1.20 or fe80::1ff:fe23:4567:890a, " +
+		"request 123e4567-e89b-12d3-a456-426614174000 paid with 4111 1111 1111 1111, call +1 555-123-4567 at 12:30"
+	redacted := string(redactor.Redact("log.txt", []byte(content), false))
+
+	if len(redacted) != len(content) {
+		t.Fatalf("got %d bytes, want the %d of the content", len(redacted), len(content))
+	}
+	if got := strings.Fields(redacted); !slices.Equal(got, []string{"mail", "from", "or", ",", "request", "paid", "with", ",", "call", "at", "12:30"}) {
+		t.Errorf("got words %q", got)
+	}
+
+	want := map[string]int{"email": 1, "ipv4": 1, "ipv6": 1, "uuid": 1, "card": 1, "phone": 1}
+	if got := redactor.File("log.txt"); !maps.Equal(got, want) {
+		t.Errorf("got counts %v, want %v", got, want)
+	}
+}
+
+// TestRedactorModes checks that replace counts matches as class tokens, custom classes included, and drop does not
+func TestRedactorModes(t *testing.T) {
+	ticket, err := ParseRedactionClass(`ticket=\bTCK-[0-9]+\b`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range []RedactMode{RedactReplace, RedactDrop} {
+		redactor, err := NewRedactor(RedactionOptions{Mode: mode, Classes: []RedactionClass{BuiltinRedactionClasses[0], ticket}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		opts := CountOptions{Counters: 1, Pipeline: PipelineBatch, Redactor: redactor}
+		content := redactor.Redact("", []byte("TCK-12 and TCK-13 from bob@example.org"), true)
+		got := CountWordFrequencyInBytes(content, opts)
+		SortWords(got)
+
+		want := []Word{{"and", 1}, {"from", 1}}
+		if mode == RedactReplace {
+			want = []Word{{"<TICKET>", 2}, {"<EMAIL>", 1}, {"and", 1}, {"from", 1}}
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: got %v, want %v", mode, got, want)
+		}
+	}
+
+	if _, err := NewRedactor(RedactionOptions{Classes: []RedactionClass{ticket, ticket}}); err == nil {
+		t.Errorf("got no error for a duplicate class")
+	}
+	if _, err := NewRedactor(RedactionOptions{Classes: []RedactionClass{{Name: "bad", Pattern: "("}}}); err == nil {
+		t.Errorf("got no error for an invalid pattern")
+	}
+}
+
+// TestRedactorCardChecksum checks that digit runs failing the Luhn checksum are no cards,
+// while the classes after card still get a chance at them
+func TestRedactorCardChecksum(t *testing.T) {
+	redactor, err := NewRedactor(RedactionOptions{Classes: BuiltinRedactionClasses})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := "order 12345678901234 paid with 4111-1111-1111-1111, call 555 123 4567 890"
+	redacted := string(redactor.Redact("log.txt", []byte(content), false))
+
+	if got := strings.Fields(redacted); !slices.Equal(got, []string{"order", "12345678901234", "paid", "with", ",", "call", "890"}) {
+		t.Errorf("got words %q", got)
+	}
+	want := map[string]int{"card": 1, "phone": 1}
+	if got := redactor.File("log.txt"); !maps.Equal(got, want) {
+		t.Errorf("got counts %v, want %v", got, want)
+	}
+}
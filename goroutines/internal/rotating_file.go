@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/mdobak/go-xerrors"
+)
+
+// RotatingFile is an append-only log file that is rotated once it reaches a size limit.
+// The current file keeps its name; older ones are renamed to name.1 (newest) up to name.N.
+// It is safe for concurrent use.
+type RotatingFile struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	// onStderr is set while the file cannot be opened again after a rotation: file is os.Stderr
+	// meanwhile, so no line is lost, and every write tries to open the log file again
+	onStderr bool
+}
+
+// OpenRotatingFile opens path for appending; maxSize <= 0 disables rotation and
+// maxFiles is the number of rotated files kept next to the current one
+func OpenRotatingFile(path string, maxSize int64, maxFiles int) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, maxSize: maxSize, maxFiles: max(maxFiles, 1)}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the current file and picks up its size; f.file is only replaced on success
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return xerrors.Newf("failed to open log file %q: %w", f.path, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return xerrors.Newf("failed to stat log file %q: %w", f.path, err)
+	}
+
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// Write appends p, rotating first if p would take the file past its limit.
+// A single write is never split, so one log line stays in one file.
+// If the rotation fails, p still goes to the current file and the rotation error is returned;
+// the next write that goes past the limit tries to rotate again. If not even the current file
+// can be opened again, p goes to os.Stderr until it can.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// The error was returned by the write that fell back, so a failed retry is not reported again
+	if f.onStderr && f.open() == nil {
+		f.onStderr = false
+	}
+
+	var rotateErr error
+	if !f.onStderr && f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		rotateErr = f.rotate()
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, errors.Join(rotateErr, err)
+}
+
+// rotate shifts name.1 ... name.N-1 up by one, dropping name.N, and starts a new current file.
+// On failure the current file is reopened where it is, so logging goes on in the file it was in.
+// If no file can be opened, logging falls back to os.Stderr.
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return f.reopen(xerrors.Newf("failed to close log file %q: %w", f.path, err))
+	}
+
+	for i := f.maxFiles - 1; i >= 1; i-- {
+		err := os.Rename(f.path+"."+strconv.Itoa(i), f.path+"."+strconv.Itoa(i+1))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return f.reopen(xerrors.Newf("failed to rotate log file %q: %w", f.path, err))
+		}
+	}
+	if err := os.Rename(f.path, f.path+".1"); err != nil {
+		return f.reopen(xerrors.Newf("failed to rotate log file %q: %w", f.path, err))
+	}
+
+	if err := f.open(); err != nil {
+		return f.fallBack(err)
+	}
+	return nil
+}
+
+// reopen opens the current file again after a failed rotation and returns the rotation error,
+// together with the open error if the file could not be reopened either
+func (f *RotatingFile) reopen(rotateErr error) error {
+	if err := f.open(); err != nil {
+		return f.fallBack(errors.Join(rotateErr, err))
+	}
+	return rotateErr
+}
+
+// fallBack replaces the closed file by os.Stderr and returns err
+func (f *RotatingFile) fallBack(err error) error {
+	f.file, f.size, f.onStderr = os.Stderr, 0, true
+	return err
+}
+
+// Close closes the current file; os.Stderr is left open
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.onStderr {
+		return nil
+	}
+	return f.file.Close()
+}
@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestRotatingFile checks that full files are renamed and that only maxFiles copies are kept
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.log")
+
+	file, err := OpenRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every line fills a file on its own, so the first one has been dropped
+	for name, want := range map[string]string{path: "fourth\n", path + ".1": "third\n", path + ".2": "second\n"} {
+		content, err := os.ReadFile(name)
+		if err != nil || string(content) != want {
+			t.Errorf("%s: got %q (%v), want %q", filepath.Base(name), content, err, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Errorf("got more than 2 rotated files")
+	}
+}
+
+// TestRotatingFileFailedRotation checks that logging goes on in the current file when it cannot be rotated
+func TestRotatingFileFailedRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.log")
+
+	// A directory in the way of the first rotated file makes the rename fail
+	if err := os.MkdirAll(filepath.Join(path+".1", "busy"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := OpenRotatingFile(path, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write([]byte("first\n")); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := file.Write([]byte("second\n")); err == nil || n != len("second\n") {
+		t.Errorf("got %d bytes and error %v, want the whole line written and a rotation error", n, err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if content, err := os.ReadFile(path); err != nil || string(content) != "first\nsecond\n" {
+		t.Errorf("got %q (%v), want both lines in the current file", content, err)
+	}
+}
+
+// TestRotatingFileUnwritableDirectory checks that lines go to stderr while the log directory cannot
+// be written, and to the log file again once it can. The directory is removed rather than made
+// read-only, which root would still be allowed to write to.
+func TestRotatingFileUnwritableDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "run.log")
+
+	stderr, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(original *os.File) { os.Stderr = original }(os.Stderr)
+	os.Stderr = stderr
+
+	file, err := OpenRotatingFile(path, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write([]byte("first\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := file.Write([]byte("second\n")); err == nil || n != len("second\n") {
+		t.Errorf("got %d bytes and error %v, want the whole line written and an error", n, err)
+	}
+	if _, err := file.Write([]byte("third\n")); err != nil {
+		t.Errorf("got error %v, want the fallback to stderr reported once", err)
+	}
+
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write([]byte("fourth\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if content, err := os.ReadFile(stderr.Name()); err != nil || string(content) != "second\nthird\n" {
+		t.Errorf("stderr: got %q (%v), want the lines written while the directory was gone", content, err)
+	}
+	if content, err := os.ReadFile(path); err != nil || string(content) != "fourth\n" {
+		t.Errorf("log file: got %q (%v), want the line written once the directory was back", content, err)
+	}
+}
@@ -0,0 +1,213 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+
+	"github.com/mdobak/go-xerrors"
+)
+
+// journalVersion is increased when the journal format changes incompatibly
+const journalVersion = 1
+
+// JournalHeader is the first line of a journal: the parameters of the run it belongs to
+type JournalHeader struct {
+	JournalVersion int    `json:"journal_version"`
+	ToolVersion    string `json:"tool_version"`
+	// ConfigHash identifies the options of the run; a journal only resumes runs with the same hash
+	ConfigHash string          `json:"config_hash"`
+	Config     json.RawMessage `json:"config"`
+}
+
+// JournalEntry is a completed file: the digest of the content it was counted from and its result
+type JournalEntry struct {
+	Input  InputDigest       `json:"input"`
+	Result FileWordFrequency `json:"result"`
+}
+
+// Journal is an append-only file of per-file results, one JSON line each, written as files complete.
+// If a run dies, the files already in the journal do not have to be counted again.
+// Workers append to it under a lock as they finish; when journaling is off it is nil
+// and every file is counted. On linux the file is locked while the journal is open,
+// so a second run on the same journal fails instead of overwriting it.
+type Journal struct {
+	mu        sync.Mutex
+	file      *os.File
+	completed map[string]JournalEntry
+}
+
+// errFileLocked is returned by lockFile when another process holds the lock
+var errFileLocked = errors.New("in use by another run")
+
+// CreateJournal starts a new journal at path, replacing any previous one.
+// The journal is locked before it is emptied, so a run cannot clobber the journal of a run in progress.
+func CreateJournal(path string, header JournalHeader) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, xerrors.Newf("failed to create journal %q: %w", path, err)
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, xerrors.Newf("failed to lock journal %q: %w", path, err)
+	}
+	if err := file.Truncate(0); err != nil {
+		file.Close()
+		return nil, xerrors.Newf("failed to create journal %q: %w", path, err)
+	}
+
+	journal := &Journal{file: file, completed: make(map[string]JournalEntry)}
+	header.JournalVersion = journalVersion
+	if err := journal.writeLine(header); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return journal, nil
+}
+
+// ResumeJournal opens the journal at path to continue the run it records, or starts a new one
+// if there is none. It fails if the journal was written by a run with a different configuration.
+// A line cut short by a crash is dropped, so the file stays valid for further appends.
+func ResumeJournal(path string, header JournalHeader) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if errors.Is(err, fs.ErrNotExist) {
+		return CreateJournal(path, header)
+	}
+	if err != nil {
+		return nil, xerrors.Newf("failed to open journal %q: %w", path, err)
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, xerrors.Newf("failed to lock journal %q: %w", path, err)
+	}
+
+	journal := &Journal{file: file, completed: make(map[string]JournalEntry)}
+	if err := journal.load(header); err != nil {
+		file.Close()
+		return nil, xerrors.Newf("failed to resume journal %q: %w", path, err)
+	}
+	return journal, nil
+}
+
+// load reads the header and entries, and positions the file after the last complete line
+func (j *Journal) load(want JournalHeader) error {
+	reader := bufio.NewReader(j.file)
+	valid := int64(0)
+
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return xerrors.Newf("failed to read line %d: %w", lineNumber, err)
+		}
+		// A line without its newline was being written when the run died
+		if !bytes.HasSuffix(line, []byte("\n")) {
+			break
+		}
+
+		if lineNumber == 1 {
+			var header JournalHeader
+			if err := json.Unmarshal(line, &header); err != nil {
+				return xerrors.Newf("invalid header: %w", err)
+			}
+			if header.JournalVersion != journalVersion {
+				return xerrors.Newf("journal version %d is not supported", header.JournalVersion)
+			}
+			if header.ConfigHash != want.ConfigHash {
+				return xerrors.Newf("it was written with a different configuration (hash %s, now %s)", header.ConfigHash, want.ConfigHash)
+			}
+		} else {
+			var entry JournalEntry
+			if err := json.Unmarshal(line, &entry); err != nil {
+				return xerrors.Newf("invalid entry on line %d: %w", lineNumber, err)
+			}
+			j.completed[entry.Input.Path] = entry
+		}
+		valid += int64(len(line))
+	}
+
+	if err := j.file.Truncate(valid); err != nil {
+		return xerrors.Newf("failed to drop incomplete line: %w", err)
+	}
+	if _, err := j.file.Seek(valid, io.SeekStart); err != nil {
+		return xerrors.Newf("failed to seek to the end: %w", err)
+	}
+
+	// A run that died before its header was written starts over
+	if valid == 0 {
+		want.JournalVersion = journalVersion
+		return j.writeLine(want)
+	}
+	return nil
+}
+
+// Completed returns the entry of a file finished by an earlier run
+func (j *Journal) Completed(filePath string) (JournalEntry, bool) {
+	if j == nil {
+		return JournalEntry{}, false
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry, ok := j.completed[filePath]
+	return entry, ok
+}
+
+// Len returns the number of completed files in the journal
+func (j *Journal) Len() int {
+	if j == nil {
+		return 0
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return len(j.completed)
+}
+
+// Append records a completed file. Each entry is written with a single write,
+// so it reaches the file even if the process dies right after.
+func (j *Journal) Append(entry JournalEntry) error {
+	if j == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err := j.writeLine(entry); err != nil {
+		return err
+	}
+	j.completed[entry.Input.Path] = entry
+	return nil
+}
+
+// writeLine appends value as one JSON line
+func (j *Journal) writeLine(value any) error {
+	line, err := json.Marshal(value)
+	if err != nil {
+		return xerrors.Newf("failed to encode journal line: %w", err)
+	}
+
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return xerrors.Newf("failed to write journal: %w", err)
+	}
+	return nil
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.file.Close()
+}
@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// TestResumeJournal checks that completed entries survive, a torn last line is dropped
+// and a journal of another configuration is refused
+func TestResumeJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	header := JournalHeader{ConfigHash: "abc"}
+
+	journal, err := CreateJournal(path, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "b.txt"} {
+		entry := JournalEntry{Input: InputDigest{Path: name, SHA256: "sum-" + name}, Result: FileWordFrequency{FileName: name, Path: name, Words: []Word{{"go", 2}}}}
+		if err := journal.Append(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	journal.Close()
+
+	// The run dies while writing the third entry
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	file.WriteString(`{"input":{"path":"c.t`)
+	file.Close()
+
+	if _, err := ResumeJournal(path, JournalHeader{ConfigHash: "other"}); err == nil || !strings.Contains(err.Error(), "different configuration") {
+		t.Errorf("got error %v, want a configuration mismatch", err)
+	}
+
+	journal, err = ResumeJournal(path, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, ok := journal.Completed("b.txt"); journal.Len() != 2 || !ok || entry.Result.Words[0].Count != 2 {
+		t.Errorf("got %d entries, b.txt %+v", journal.Len(), entry)
+	}
+	if err := journal.Append(JournalEntry{Input: InputDigest{Path: "c.txt"}}); err != nil {
+		t.Fatal(err)
+	}
+	journal.Close()
+
+	// The appended entry follows the last complete line
+	journal, err = ResumeJournal(path, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	if _, ok := journal.Completed("c.txt"); journal.Len() != 3 || !ok {
+		t.Errorf("got %d entries after resuming twice, want 3", journal.Len())
+	}
+}
+
+// TestJournalLocked checks that a journal in use is neither replaced nor resumed by another run
+func TestJournalLocked(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("journals are only locked on linux")
+	}
+
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	header := JournalHeader{ConfigHash: "abc"}
+
+	journal, err := CreateJournal(path, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.Append(JournalEntry{Input: InputDigest{Path: "a.txt"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := CreateJournal(path, header); !errors.Is(err, errFileLocked) {
+		t.Errorf("create: got error %v, want the journal to be locked", err)
+	}
+	if _, err := ResumeJournal(path, header); !errors.Is(err, errFileLocked) {
+		t.Errorf("resume: got error %v, want the journal to be locked", err)
+	}
+	journal.Close()
+
+	// The entry survived the refused create, and the lock went with the closed journal
+	journal, err = ResumeJournal(path, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if journal.Len() != 1 {
+		t.Errorf("got %d entries, want 1", journal.Len())
+	}
+	journal.Close()
+}
@@ -0,0 +1,144 @@
+package internal
+
+import (
+	"log/slog"
+	"sync/atomic"
+)
+
+// RunStats collects counters for a whole processing run
+// All fields are atomics, so workers and counter goroutines can update them concurrently
+type RunStats struct {
+	// FilesProcessed and FilesFailed count finished file jobs
+	FilesProcessed atomic.Int64
+	FilesFailed    atomic.Int64
+	// FilesResumed counts the processed files whose result was taken from a journal
+	FilesResumed atomic.Int64
+
+	// BytesRead counts the raw input bytes read
+	BytesRead atomic.Int64
+
+	// Input methods chosen by readInput
+	MmapFiles     atomic.Int64
+	ReadFileFiles atomic.Int64
+
+	// Reasons why an mmap read fell back to reading the file into memory
+	MmapFallbackSmall      atomic.Int64
+	MmapFallbackSpecial    atomic.Int64
+	MmapFallbackCompressed atomic.Int64
+	MmapFallbackError      atomic.Int64
+	MmapFallbackVirtual    atomic.Int64
+
+	// JSONLinesSkipped counts the malformed NDJSON lines the JSON extractor skipped
+	JSONLinesSkipped atomic.Int64
+
+	// FilesSplit counts huge files whose parts were counted by several workers
+	FilesSplit atomic.Int64
+	// WorkerBusy is the time workers spent on jobs, and WorkerCapacity the number of
+	// workers times the duration of the pool, both in nanoseconds
+	WorkerBusy     atomic.Int64
+	WorkerCapacity atomic.Int64
+
+	// TokenRuleHits counts the words each normalisation rule rewrote or removed, indexed by TokenRule
+	TokenRuleHits [tokenRuleCount]atomic.Int64
+}
+
+// WorkerUtilisation returns the share of the pool's worker time spent on jobs, from 0 to 1
+func (s *RunStats) WorkerUtilisation() float64 {
+	capacity := s.WorkerCapacity.Load()
+	if capacity == 0 {
+		return 0
+	}
+	return float64(s.WorkerBusy.Load()) / float64(capacity)
+}
+
+// LogValue implements slog.LogValuer so stats can be logged with slog.Any
+func (s *RunStats) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int64("files_processed", s.FilesProcessed.Load()),
+		slog.Int64("files_failed", s.FilesFailed.Load()),
+		slog.Int64("files_resumed", s.FilesResumed.Load()),
+		slog.Int64("bytes_read", s.BytesRead.Load()),
+		slog.Group("input",
+			slog.Int64("mmap", s.MmapFiles.Load()),
+			slog.Int64("readfile", s.ReadFileFiles.Load()),
+		),
+		slog.Group("mmap_fallback",
+			slog.Int64("small", s.MmapFallbackSmall.Load()),
+			slog.Int64("special", s.MmapFallbackSpecial.Load()),
+			slog.Int64("compressed", s.MmapFallbackCompressed.Load()),
+			slog.Int64("error", s.MmapFallbackError.Load()),
+			slog.Int64("virtual", s.MmapFallbackVirtual.Load()),
+		),
+		slog.Int64("json_lines_skipped", s.JSONLinesSkipped.Load()),
+		slog.Int64("files_split", s.FilesSplit.Load()),
+		slog.Float64("worker_utilisation", s.WorkerUtilisation()),
+		slog.Group("token_rules", s.tokenRuleAttrs()...),
+	)
+}
+
+// tokenRuleAttrs returns the counter of every normalisation rule
+func (s *RunStats) tokenRuleAttrs() []any {
+	attrs := make([]any, 0, tokenRuleCount)
+	for rule := range tokenRuleCount {
+		attrs = append(attrs, slog.Int64(rule.String(), s.TokenRuleHits[rule].Load()))
+	}
+	return attrs
+}
+
+// addTokenRuleHits adds the rule counts of one stage
+func (s *RunStats) addTokenRuleHits(hits *tokenRuleHits) {
+	if s == nil {
+		return
+	}
+
+	for rule, count := range hits {
+		if count > 0 {
+			s.TokenRuleHits[rule].Add(count)
+		}
+	}
+}
+
+// addSkippedJSONLines records malformed NDJSON lines skipped in one file
+func (s *RunStats) addSkippedJSONLines(lines int) {
+	if s == nil {
+		return
+	}
+	s.JSONLinesSkipped.Add(int64(lines))
+}
+
+// addInput records which method was used to read a file and how many bytes it yielded
+// Safe to call on a nil receiver so stats stay optional for callers
+func (s *RunStats) addInput(method inputMethod, size int) {
+	if s == nil {
+		return
+	}
+
+	s.BytesRead.Add(int64(size))
+
+	switch method {
+	case inputMethodMmap:
+		s.MmapFiles.Add(1)
+	default:
+		s.ReadFileFiles.Add(1)
+	}
+}
+
+// addMmapFallback records why a requested mmap read was not used
+func (s *RunStats) addMmapFallback(reason mmapFallbackReason) {
+	if s == nil {
+		return
+	}
+
+	switch reason {
+	case mmapFallbackSmall:
+		s.MmapFallbackSmall.Add(1)
+	case mmapFallbackSpecial:
+		s.MmapFallbackSpecial.Add(1)
+	case mmapFallbackCompressed:
+		s.MmapFallbackCompressed.Add(1)
+	case mmapFallbackError:
+		s.MmapFallbackError.Add(1)
+	case mmapFallbackVirtual:
+		s.MmapFallbackVirtual.Add(1)
+	}
+}
@@ -0,0 +1,383 @@
+package internal
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mdobak/go-xerrors"
+)
+
+// SearchQuery is a parsed query: an OR of groups whose clauses must all match one file
+type SearchQuery struct {
+	groups [][]searchClause
+}
+
+// searchClause is a single term or a phrase
+type searchClause struct {
+	// terms are normalised by the rules of the index
+	terms []string
+	// indexed reports which terms have postings; stopwords and words removed by the rules have none
+	indexed []bool
+	// anchor is the first indexed term; its postings drive the search
+	anchor int
+}
+
+// ParseSearchQuery parses queries such as `timeout`, `timeout AND retry`,
+// `"worker pool" OR goroutine` or `"end of file"`. Adjacent clauses without an
+// operator are combined with AND, and AND binds tighter than OR.
+func (x *InvertedIndex) ParseSearchQuery(query string) (SearchQuery, error) {
+	items, err := splitSearchQuery(query)
+	if err != nil {
+		return SearchQuery{}, err
+	}
+
+	var parsed SearchQuery
+	var group []searchClause
+	expectClause := true
+
+	for _, item := range items {
+		switch {
+		case !item.quoted && item.text == "OR":
+			if expectClause {
+				return SearchQuery{}, xerrors.Newf("misplaced OR in query %q", query)
+			}
+			parsed.groups = append(parsed.groups, group)
+			group = nil
+			expectClause = true
+
+		case !item.quoted && item.text == "AND":
+			if expectClause {
+				return SearchQuery{}, xerrors.Newf("misplaced AND in query %q", query)
+			}
+			expectClause = true
+
+		default:
+			clause, err := x.parseClause(item.text)
+			if err != nil {
+				return SearchQuery{}, err
+			}
+			group = append(group, clause)
+			expectClause = false
+		}
+	}
+
+	if expectClause {
+		return SearchQuery{}, xerrors.Newf("incomplete query %q", query)
+	}
+
+	parsed.groups = append(parsed.groups, group)
+	return parsed, nil
+}
+
+// searchItem is a bare word, an operator or a quoted phrase of a query
+type searchItem struct {
+	text   string
+	quoted bool
+}
+
+// splitSearchQuery splits a query at whitespace, keeping quoted phrases together
+func splitSearchQuery(query string) ([]searchItem, error) {
+	var items []searchItem
+
+	for rest := strings.TrimSpace(query); rest != ""; rest = strings.TrimSpace(rest) {
+		if phrase, ok := strings.CutPrefix(rest, `"`); ok {
+			end := strings.IndexByte(phrase, '"')
+			if end < 0 {
+				return nil, xerrors.Newf("unterminated phrase in query %q", query)
+			}
+			items = append(items, searchItem{text: phrase[:end], quoted: true})
+			rest = phrase[end+1:]
+			continue
+		}
+
+		end := strings.IndexFunc(rest, unicode.IsSpace)
+		if end < 0 {
+			end = len(rest)
+		}
+		items = append(items, searchItem{text: rest[:end]})
+		rest = rest[end:]
+	}
+
+	return items, nil
+}
+
+// parseClause normalises a word or phrase the way indexed text was normalised
+// A word such as "e-mail" splits into two terms and becomes a phrase.
+func (x *InvertedIndex) parseClause(text string) (searchClause, error) {
+	clause := searchClause{anchor: -1}
+
+	// Tokenise without filtering; the words that are not indexed are checked against the text instead
+	tp := TextPreprocessor{}
+	for token := range tp.PreprocessTextPositioned(text) {
+		term, indexed := x.term(token.Word)
+		if clause.anchor < 0 && indexed {
+			clause.anchor = len(clause.terms)
+		}
+		clause.terms = append(clause.terms, term)
+		clause.indexed = append(clause.indexed, indexed)
+	}
+
+	if clause.anchor < 0 {
+		return searchClause{}, xerrors.Newf("%q has no indexed words (stopwords and words removed by rules are not indexed)", text)
+	}
+
+	return clause, nil
+}
+
+// searchMatch is a clause match: the byte range from its first to its last word
+type searchMatch struct {
+	file  int
+	start int
+	end   int
+	line  int
+}
+
+// clauseMatches finds every match of a clause, grouped by file
+func (x *InvertedIndex) clauseMatches(clause searchClause) map[int][]searchMatch {
+	matches := make(map[int][]searchMatch)
+
+	for _, anchor := range x.Postings[clause.terms[clause.anchor]] {
+		// Every other indexed word must occur at the same distance as in the phrase
+		first := anchor.Position - clause.anchor
+		found := first >= 0
+		for k := clause.anchor + 1; k < len(clause.terms) && found; k++ {
+			if clause.indexed[k] {
+				_, found = x.occurrenceAt(clause.terms[k], anchor.File, first+k)
+			}
+		}
+
+		if !found {
+			continue
+		}
+
+		// The text gives the extent of the phrase and checks the words that are not indexed
+		text := x.Files[anchor.File].Text
+		start, end, ok := x.matchPhrase(text, anchor.Offset, clause)
+		if !ok {
+			continue
+		}
+
+		matches[anchor.File] = append(matches[anchor.File], searchMatch{
+			file:  anchor.File,
+			start: start,
+			end:   end,
+			line:  anchor.Line - strings.Count(text[start:anchor.Offset], "\n"),
+		})
+	}
+
+	return matches
+}
+
+// matchPhrase compares the words around the anchor word at offset with the clause terms
+// and returns the byte range of the whole phrase
+func (x *InvertedIndex) matchPhrase(text string, offset int, clause searchClause) (int, int, bool) {
+	start := offset
+	if clause.anchor > 0 {
+		var before []string
+		before, start = wordsBefore(text, offset, clause.anchor)
+		if !slices.EqualFunc(before, clause.terms[:clause.anchor], x.sameTerm) {
+			return 0, 0, false
+		}
+	}
+
+	// Read exactly as many words as the rest of the phrase has
+	tp := TextPreprocessor{}
+	rest := clause.terms[clause.anchor:]
+	matched, end := 0, offset
+	for token := range tp.PreprocessTextPositioned(text[offset:]) {
+		if !x.sameTerm(token.Word, rest[matched]) {
+			return 0, 0, false
+		}
+		end = wordEnd(text, offset+token.Offset)
+		if matched++; matched == len(rest) {
+			return start, end, true
+		}
+	}
+
+	return 0, 0, false
+}
+
+// sameTerm reports whether a word of the text normalises to a term of a clause
+func (x *InvertedIndex) sameTerm(word, term string) bool {
+	normalised, _ := x.term(word)
+	return normalised == term
+}
+
+// wordsBefore returns the n lowercased words right before offset and where the first of them starts
+func wordsBefore(text string, offset, n int) ([]string, int) {
+	words := make([]string, n)
+	end := offset
+
+	for i := n - 1; i >= 0; i-- {
+		// Skip the separators, then walk back over the word
+		for end > 0 {
+			r, size := utf8.DecodeLastRuneInString(text[:end])
+			if isTokenRune(unicode.ToLower(r)) {
+				break
+			}
+			end -= size
+		}
+
+		start := end
+		for start > 0 {
+			r, size := utf8.DecodeLastRuneInString(text[:start])
+			if !isTokenRune(unicode.ToLower(r)) {
+				break
+			}
+			start -= size
+		}
+
+		if start == end {
+			return nil, 0
+		}
+
+		words[i] = strings.Map(unicode.ToLower, text[start:end])
+		end = start
+	}
+
+	return words, end
+}
+
+// occurrenceAt looks up the occurrence of word at a position of a file
+func (x *InvertedIndex) occurrenceAt(word string, file, position int) (Occurrence, bool) {
+	postings := x.Postings[word]
+	i, found := slices.BinarySearchFunc(postings, Occurrence{File: file, Position: position}, func(a, b Occurrence) int {
+		if c := cmp.Compare(a.File, b.File); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Position, b.Position)
+	})
+	if !found {
+		return Occurrence{}, false
+	}
+	return postings[i], true
+}
+
+// wordEnd returns the offset just past the word starting at offset
+func wordEnd(text string, offset int) int {
+	end := strings.IndexFunc(text[offset:], func(r rune) bool {
+		return !isTokenRune(unicode.ToLower(r))
+	})
+	if end < 0 {
+		return len(text)
+	}
+	return offset + end
+}
+
+// KWICHit is a search hit shown as a keyword-in-context snippet
+type KWICHit struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	// Column is the 1-based rune column of the match in its line
+	Column int    `json:"column"`
+	Left   string `json:"left"`
+	Match  string `json:"match"`
+	Right  string `json:"right"`
+}
+
+// Search returns the hits of query ordered by file and offset, with up to
+// context runes of the surrounding line on each side; limit 0 returns all hits
+func (x *InvertedIndex) Search(query SearchQuery, context, limit int) []KWICHit {
+	var matches []searchMatch
+	seen := make(map[[2]int]bool)
+
+	for _, group := range query.groups {
+		// A file matches the group when every clause matches it
+		var perClause []map[int][]searchMatch
+		for _, clause := range group {
+			perClause = append(perClause, x.clauseMatches(clause))
+		}
+
+		for file := range perClause[0] {
+			if !slices.ContainsFunc(perClause, func(m map[int][]searchMatch) bool { return len(m[file]) == 0 }) {
+				for _, clauseMatches := range perClause {
+					for _, match := range clauseMatches[file] {
+						if key := [2]int{match.file, match.start}; !seen[key] {
+							seen[key] = true
+							matches = append(matches, match)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	slices.SortFunc(matches, func(a, b searchMatch) int {
+		if c := cmp.Compare(a.file, b.file); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.start, b.start)
+	})
+
+	matches = truncate(matches, limit)
+	hits := make([]KWICHit, 0, len(matches))
+	for _, match := range matches {
+		hits = append(hits, x.kwic(match, context))
+	}
+	return hits
+}
+
+// kwic cuts the snippet of a match out of its line
+func (x *InvertedIndex) kwic(match searchMatch, context int) KWICHit {
+	text := x.Files[match.file].Text
+
+	lineStart := strings.LastIndexByte(text[:match.start], '\n') + 1
+	lineEnd := strings.IndexByte(text[match.end:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(text)
+	} else {
+		lineEnd += match.end
+	}
+
+	left := []rune(text[lineStart:match.start])
+	right := []rune(text[match.end:lineEnd])
+	if len(left) > context {
+		left = left[len(left)-context:]
+	}
+	if len(right) > context {
+		right = right[:context]
+	}
+
+	return KWICHit{
+		File:   x.Files[match.file].Path,
+		Line:   match.line,
+		Column: utf8.RuneCountInString(text[lineStart:match.start]) + 1,
+		Left:   flattenWhitespace(string(left)),
+		Match:  flattenWhitespace(text[match.start:match.end]),
+		Right:  flattenWhitespace(string(right)),
+	}
+}
+
+// flattenWhitespace turns tabs and line breaks into spaces so a snippet stays on one line
+func flattenWhitespace(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// WriteKWIC writes hits with their keywords aligned in one column
+func WriteKWIC(w io.Writer, hits []KWICHit) error {
+	locationWidth, leftWidth := 0, 0
+	for _, hit := range hits {
+		locationWidth = max(locationWidth, len(fmt.Sprintf("%s:%d:%d", hit.File, hit.Line, hit.Column)))
+		leftWidth = max(leftWidth, utf8.RuneCountInString(hit.Left))
+	}
+
+	for _, hit := range hits {
+		location := fmt.Sprintf("%s:%d:%d", hit.File, hit.Line, hit.Column)
+		padding := strings.Repeat(" ", leftWidth-utf8.RuneCountInString(hit.Left))
+		if _, err := fmt.Fprintf(w, "%-*s  %s%s[%s]%s\n", locationWidth, location, padding, hit.Left, hit.Match, hit.Right); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/DonAlexandro/go_advanced/pkg"
+)
+
+// TestPreprocessTextPositioned checks positions, lines and offsets, with stopwords skipped but counted
+func TestPreprocessTextPositioned(t *testing.T) {
+	tp := TextPreprocessor{Stopwords: pkg.StopwordSet{"the": {}}}
+
+	var got []Token
+	for token := range tp.PreprocessTextPositioned("The Worker,\nthe pool!") {
+		got = append(got, token)
+	}
+
+	want := []Token{
+		{Word: "worker", Position: 1, Line: 1, Offset: 4},
+		{Word: "pool", Position: 3, Line: 2, Offset: 16},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+// TestInvertedIndexSearch checks term, AND, OR and phrase queries, before and after a save
+func TestInvertedIndexSearch(t *testing.T) {
+	index := NewInvertedIndex(pkg.StopwordSet{"of": {}, "the": {}}, nil)
+	index.AddFile("b.txt", "A worker pool.\nThe end of the pool")
+	index.AddFile("a.txt", "Pool of workers; worker timeout")
+	index.Sort()
+
+	filename := filepath.Join(t.TempDir(), "index.gob.gz")
+	if err := index.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadInvertedIndex(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"worker", []string{"a.txt:1:18:worker", "b.txt:1:3:worker"}},
+		{"worker AND timeout", []string{"a.txt:1:18:worker", "a.txt:1:25:timeout"}},
+		{"timeout OR end", []string{"a.txt:1:25:timeout", "b.txt:2:5:end"}},
+		{`"end of the pool"`, []string{"b.txt:2:5:end of the pool"}},
+		{`"pool of workers"`, []string{"a.txt:1:1:Pool of workers"}},
+		{`"of the pool"`, []string{"b.txt:2:9:of the pool"}},
+		{`"worker pool" timeout`, nil},
+	}
+
+	for _, x := range []*InvertedIndex{index, loaded} {
+		for _, tt := range tests {
+			query, err := x.ParseSearchQuery(tt.query)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.query, err)
+			}
+
+			var got []string
+			for _, hit := range x.Search(query, 10, 0) {
+				got = append(got, hit.File+":"+strconv.Itoa(hit.Line)+":"+strconv.Itoa(hit.Column)+":"+hit.Match)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("%s: got %q, want %q", tt.query, got, tt.want)
+			}
+		}
+	}
+
+	for _, invalid := range []string{"", "the", "OR worker", "worker AND", `"worker`} {
+		if _, err := index.ParseSearchQuery(invalid); err == nil {
+			t.Errorf("%q: expected an error", invalid)
+		}
+	}
+}
+
+// TestInvertedIndexRules checks that the index and its queries are normalised by the rules
+// the counts use, and that the rules are saved with the index
+func TestInvertedIndexRules(t *testing.T) {
+	rules := &TokenRules{Synonyms: map[string]string{"k8s": "kubernetes"}, DropNumeric: true}
+	index := NewInvertedIndex(nil, rules)
+	index.AddFile("a.txt", "Deploy k8s on 42 nodes")
+	index.Sort()
+
+	if _, ok := index.Postings["k8s"]; ok {
+		t.Error("the alias k8s was indexed")
+	}
+	if _, ok := index.Postings["42"]; ok {
+		t.Error("the numeric word 42 was indexed")
+	}
+
+	filename := filepath.Join(t.TempDir(), "index.gob.gz")
+	if err := index.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadInvertedIndex(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"kubernetes", "k8s"},
+		{"K8S", "k8s"},
+		{`"deploy kubernetes"`, "Deploy k8s"},
+		{`"on 42 nodes"`, "on 42 nodes"},
+	}
+
+	for _, x := range []*InvertedIndex{index, loaded} {
+		for _, tt := range tests {
+			query, err := x.ParseSearchQuery(tt.query)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.query, err)
+			}
+			if hits := x.Search(query, 10, 0); len(hits) != 1 || hits[0].Match != tt.want {
+				t.Errorf("%s: got %+v, want one hit of %q", tt.query, hits, tt.want)
+			}
+		}
+
+		if _, err := x.ParseSearchQuery("42"); err == nil {
+			t.Error("42: expected an error, numbers are not indexed")
+		}
+	}
+}
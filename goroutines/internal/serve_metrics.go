@@ -0,0 +1,234 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// metricStages are the preprocessing stages timed for every file, in the order they run.
+// The text stages run within the count stage.
+var metricStages = slices.Concat([]string{"read", "record", "count"}, textStages, []string{"merge"})
+
+// stageBuckets are the upper bounds in seconds of the stage latency histograms
+var stageBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// histogram is a Prometheus histogram updated without locks
+type histogram struct {
+	// counts holds one counter per bucket plus one for +Inf; they are not cumulative
+	counts []atomic.Int64
+	// sum is in nanoseconds, so it can be added atomically
+	sum atomic.Int64
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]atomic.Int64, len(stageBuckets)+1)}
+}
+
+// observe records one duration
+func (h *histogram) observe(d time.Duration) {
+	bucket := len(stageBuckets)
+	for i, bound := range stageBuckets {
+		if d.Seconds() <= bound {
+			bucket = i
+			break
+		}
+	}
+	h.counts[bucket].Add(1)
+	h.sum.Add(int64(d))
+}
+
+// poolGauges reads the current state of a running worker pool
+type poolGauges func() (jobs, results, activeWorkers int)
+
+// Metrics collects counters, stage latencies and pool gauges over every run it is passed to,
+// and serves them in the Prometheus text format. A nil Metrics records nothing.
+type Metrics struct {
+	stages map[string]*histogram
+
+	mu sync.Mutex
+	// runs holds the stats and pool gauges of the runs in progress, which are read live.
+	// Finished runs are folded into finished, so a long-lived process keeps no stats per run.
+	runs     []trackedRun
+	finished runTotals
+}
+
+// trackedRun is a run in progress; pool is nil for runs without a worker pool
+type trackedRun struct {
+	stats *RunStats
+	pool  poolGauges
+}
+
+// NewMetrics creates empty metrics
+func NewMetrics() *Metrics {
+	m := &Metrics{stages: make(map[string]*histogram, len(metricStages))}
+	for _, stage := range metricStages {
+		m.stages[stage] = newHistogram()
+	}
+	return m
+}
+
+// runTotals are the counters exported from the stats of runs
+type runTotals struct {
+	processed, failed, bytesRead int64
+	ruleHits                     [tokenRuleCount]int64
+}
+
+// add adds the current counters of stats
+func (t *runTotals) add(stats *RunStats) {
+	t.processed += stats.FilesProcessed.Load()
+	t.failed += stats.FilesFailed.Load()
+	t.bytesRead += stats.BytesRead.Load()
+	for rule := range tokenRuleCount {
+		t.ruleHits[rule] += stats.TokenRuleHits[rule].Load()
+	}
+}
+
+// TrackRun adds the counters of a run to the totals while it runs, and the queue depths and
+// active workers its pool reports to the gauges; pool may be nil. FinishRun must follow.
+func (m *Metrics) TrackRun(stats *RunStats, pool func() (jobs, results, activeWorkers int)) {
+	if m == nil || stats == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.runs = append(m.runs, trackedRun{stats: stats, pool: pool})
+}
+
+// FinishRun keeps the final counters of a tracked run in the totals and stops reading its stats and pool
+func (m *Metrics) FinishRun(stats *RunStats) {
+	if m == nil || stats == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := slices.IndexFunc(m.runs, func(run trackedRun) bool { return run.stats == stats })
+	if i >= 0 {
+		m.finished.add(stats)
+		m.runs = slices.Delete(m.runs, i, i+1)
+	}
+}
+
+// observeStage records how long a preprocessing stage of one file took
+func (m *Metrics) observeStage(stage string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	if h := m.stages[stage]; h != nil {
+		h.observe(d)
+	}
+}
+
+// WritePrometheus writes every metric in the Prometheus text exposition format
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	m.mu.Lock()
+	// Concurrent runs add up, in the gauges as in the counters
+	totals := m.finished
+	var jobs, results, active int
+	for _, run := range m.runs {
+		totals.add(run.stats)
+		if run.pool != nil {
+			runJobs, runResults, runActive := run.pool()
+			jobs, results, active = jobs+runJobs, results+runResults, active+runActive
+		}
+	}
+	m.mu.Unlock()
+
+	p := &promWriter{w: w}
+
+	p.metric("wordfreq_files_processed_total", "counter", "Files counted successfully.")
+	p.sample("wordfreq_files_processed_total", "", float64(totals.processed))
+	p.metric("wordfreq_files_failed_total", "counter", "Files that could not be processed.")
+	p.sample("wordfreq_files_failed_total", "", float64(totals.failed))
+	p.metric("wordfreq_bytes_read_total", "counter", "Raw input bytes read.")
+	p.sample("wordfreq_bytes_read_total", "", float64(totals.bytesRead))
+	p.metric("wordfreq_token_rule_hits_total", "counter", "Words rewritten or removed by each normalisation rule.")
+	for rule := range tokenRuleCount {
+		p.sample("wordfreq_token_rule_hits_total", fmt.Sprintf(`rule=%q`, rule.String()), float64(totals.ruleHits[rule]))
+	}
+
+	p.metric("wordfreq_stage_duration_seconds", "histogram", "Time spent in each preprocessing stage of a file.")
+	for _, stage := range metricStages {
+		h := m.stages[stage]
+		cumulative := int64(0)
+		for i, bound := range stageBuckets {
+			cumulative += h.counts[i].Load()
+			p.sample("wordfreq_stage_duration_seconds_bucket", fmt.Sprintf(`stage=%q,le=%q`, stage, strconv.FormatFloat(bound, 'g', -1, 64)), float64(cumulative))
+		}
+		cumulative += h.counts[len(stageBuckets)].Load()
+		p.sample("wordfreq_stage_duration_seconds_bucket", fmt.Sprintf(`stage=%q,le="+Inf"`, stage), float64(cumulative))
+		p.sample("wordfreq_stage_duration_seconds_sum", fmt.Sprintf(`stage=%q`, stage), time.Duration(h.sum.Load()).Seconds())
+		p.sample("wordfreq_stage_duration_seconds_count", fmt.Sprintf(`stage=%q`, stage), float64(cumulative))
+	}
+
+	p.metric("wordfreq_queue_depth", "gauge", "Buffered items waiting in the worker pool channels.")
+	p.sample("wordfreq_queue_depth", `queue="jobs"`, float64(jobs))
+	p.sample("wordfreq_queue_depth", `queue="results"`, float64(results))
+	p.metric("wordfreq_active_workers", "gauge", "Workers still processing files.")
+	p.sample("wordfreq_active_workers", "", float64(active))
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	p.metric("go_goroutines", "gauge", "Number of goroutines that currently exist.")
+	p.sample("go_goroutines", "", float64(runtime.NumGoroutine()))
+	p.metric("go_memstats_heap_alloc_bytes", "gauge", "Bytes of allocated heap objects.")
+	p.sample("go_memstats_heap_alloc_bytes", "", float64(mem.HeapAlloc))
+	p.metric("go_memstats_heap_inuse_bytes", "gauge", "Bytes in in-use heap spans.")
+	p.sample("go_memstats_heap_inuse_bytes", "", float64(mem.HeapInuse))
+	p.metric("go_memstats_sys_bytes", "gauge", "Bytes of memory obtained from the OS.")
+	p.sample("go_memstats_sys_bytes", "", float64(mem.Sys))
+	p.metric("go_memstats_mallocs_total", "counter", "Heap objects allocated.")
+	p.sample("go_memstats_mallocs_total", "", float64(mem.Mallocs))
+	p.metric("go_gc_cycles_total", "counter", "Completed GC cycles.")
+	p.sample("go_gc_cycles_total", "", float64(mem.NumGC))
+	p.metric("go_gc_pause_seconds_total", "counter", "Total time the world was stopped for GC.")
+	p.sample("go_gc_pause_seconds_total", "", time.Duration(mem.PauseTotalNs).Seconds())
+
+	return p.err
+}
+
+// ServeHTTP serves the metrics, so Metrics can be mounted at /metrics
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := m.WritePrometheus(w); err != nil {
+		slog.Warn("failed to write metrics", slog.Any("error", err))
+	}
+}
+
+// promWriter writes Prometheus text lines, keeping the first error
+type promWriter struct {
+	w   io.Writer
+	err error
+}
+
+// metric writes the HELP and TYPE lines of a metric family
+func (p *promWriter) metric(name, kind, help string) {
+	p.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes one value; labels are already formatted as name="value" pairs
+func (p *promWriter) sample(name, labels string, value float64) {
+	if labels != "" {
+		name += "{" + labels + "}"
+	}
+
+	p.printf("%s %s\n", name, strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+func (p *promWriter) printf(format string, args ...any) {
+	if p.err == nil {
+		_, p.err = fmt.Fprintf(p.w, format, args...)
+	}
+}
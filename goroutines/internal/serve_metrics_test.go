@@ -0,0 +1,111 @@
+package internal
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// TestMetricsWritePrometheus checks counter totals over finished and running runs, cumulative histogram buckets
+// and the pool gauges of concurrent runs
+func TestMetricsWritePrometheus(t *testing.T) {
+	metrics := NewMetrics()
+
+	// The first run has finished and only its totals are kept; the pools of the others add up
+	for i := range 3 {
+		stats := &RunStats{}
+		stats.FilesProcessed.Add(3)
+		stats.BytesRead.Add(1000)
+		metrics.TrackRun(stats, func() (int, int, int) { return i + 1, 1, 1 })
+		if i == 0 {
+			metrics.FinishRun(stats)
+		}
+	}
+	if len(metrics.runs) != 2 {
+		t.Errorf("got %d runs in progress, want 2", len(metrics.runs))
+	}
+	metrics.observeStage("read", 200*time.Microsecond)
+	metrics.observeStage("read", 20*time.Second)
+
+	var out strings.Builder
+	if err := metrics.WritePrometheus(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"# TYPE wordfreq_files_processed_total counter\nwordfreq_files_processed_total 9\n",
+		"wordfreq_bytes_read_total 3000\n",
+		`wordfreq_stage_duration_seconds_bucket{stage="read",le="0.0001"} 0` + "\n",
+		`wordfreq_stage_duration_seconds_bucket{stage="read",le="0.00025"} 1` + "\n",
+		`wordfreq_stage_duration_seconds_bucket{stage="read",le="10"} 1` + "\n",
+		`wordfreq_stage_duration_seconds_bucket{stage="read",le="+Inf"} 2` + "\n",
+		`wordfreq_stage_duration_seconds_sum{stage="read"} 20.0002` + "\n",
+		`wordfreq_queue_depth{queue="jobs"} 5` + "\n",
+		`wordfreq_queue_depth{queue="results"} 2` + "\n",
+		"wordfreq_active_workers 2\n",
+		"# TYPE go_goroutines gauge\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("missing %q in:\n%s", want, out.String())
+		}
+	}
+}
+
+// TestStageTimingsTextStages checks that every pipeline times the text stages it runs
+func TestStageTimingsTextStages(t *testing.T) {
+	fsys := fstest.MapFS{"a.txt": {Data: []byte(strings.Repeat("The quick brown fox jumps over the lazy dog.\n", 20))}}
+
+	tests := []struct {
+		pipeline PipelineMode
+		want     []string
+	}{
+		{PipelineStream, []string{"lowercase", "punctuation", "split", "normalise", "filter"}},
+		{PipelineBatch, []string{"lowercase", "punctuation", "split", "normalise", "filter"}},
+		{PipelineFused, []string{"clean", "tokenise"}},
+		{PipelineBytes, []string{"tokenise"}},
+	}
+
+	for _, tt := range tests {
+		metrics := NewMetrics()
+		opts := CountOptions{Counters: 2, Pipeline: tt.pipeline, Metrics: metrics, Rules: &TokenRules{}}
+		if _, err := CountWordFrequency(fsys, "a.txt", opts); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, stage := range append([]string{"read", "count", "merge"}, textStages...) {
+			observed := false
+			for i := range metrics.stages[stage].counts {
+				observed = observed || metrics.stages[stage].counts[i].Load() > 0
+			}
+			if want := !slices.Contains(textStages, stage) || slices.Contains(tt.want, stage); observed != want {
+				t.Errorf("%s: stage %s observed %v, want %v", tt.pipeline, stage, observed, want)
+			}
+		}
+	}
+}
+
+// TestStageTimingsSplitFile checks that a split file times its read and record stages once and its count stages per part
+func TestStageTimingsSplitFile(t *testing.T) {
+	fsys := fstest.MapFS{"a.txt": {Data: []byte(strings.Repeat("The quick brown fox jumps over the lazy dog.\n", 20))}}
+	metrics := NewMetrics()
+
+	file, err := LoadSplitFile(fsys, "a.txt", CountOptions{Counters: 2, Pipeline: PipelineBytes, Metrics: metrics}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range file.Parts() {
+		file.CountPart(i)
+	}
+
+	for stage, want := range map[string]int64{"read": 1, "record": 1, "count": 2, "tokenise": 2, "merge": 2} {
+		observed := int64(0)
+		for i := range metrics.stages[stage].counts {
+			observed += metrics.stages[stage].counts[i].Load()
+		}
+		if observed != want {
+			t.Errorf("stage %s observed %d times, want %d", stage, observed, want)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package internal
+
+import (
+	"hash/maphash"
+	"math/bits"
+	"sync"
+	"unsafe"
+
+	"github.com/mdobak/go-xerrors"
+)
+
+// MergeMode selects how chunk frequencies are combined into a file frequency
+type MergeMode int
+
+const (
+	// MergeSingle drains chunk results into one map guarded by one mutex
+	MergeSingle MergeMode = iota
+	// MergeSharded lets several goroutines merge into a hash-partitioned ShardedFrequency
+	MergeSharded
+)
+
+// String returns the command line name of the mode
+func (m MergeMode) String() string {
+	if m == MergeSharded {
+		return "sharded"
+	}
+	return "single"
+}
+
+// ParseMergeMode converts a command line name into a MergeMode
+func ParseMergeMode(name string) (MergeMode, error) {
+	switch name {
+	case "single":
+		return MergeSingle, nil
+	case "sharded":
+		return MergeSharded, nil
+	}
+	return 0, xerrors.Newf("unknown merge mode %q (expected single or sharded)", name)
+}
+
+// cacheLineSize is the cache line size of common amd64 and arm64 CPUs
+const cacheLineSize = 64
+
+// frequencyShard is one partition of a ShardedFrequency
+type frequencyShard struct {
+	mu        sync.Mutex
+	frequency Frequency
+	// Padding fills the shard up to a whole cache line, so neighbouring shard mutexes
+	// are never on the same line
+	_ [cacheLineSize - unsafe.Sizeof(sync.Mutex{}) - unsafe.Sizeof(Frequency(nil))]byte
+}
+
+// ShardedFrequency is a concurrent word counter partitioned by word hash.
+// Each shard has its own mutex, so goroutines updating different words rarely
+// contend, and high-cardinality vocabularies are spread over many small maps.
+type ShardedFrequency struct {
+	shards []frequencyShard
+	mask   uint64
+	seed   maphash.Seed
+}
+
+// NewShardedFrequency creates a counter with shardCount shards (rounded up to a power of two).
+// sizeHint is the expected number of distinct words and pre-sizes every shard map.
+func NewShardedFrequency(shardCount, sizeHint int) *ShardedFrequency {
+	shardCount = max(shardCount, 1)
+	// Round up to a power of two so the shard index is a cheap mask
+	shardCount = 1 << bits.Len(uint(shardCount-1))
+
+	s := &ShardedFrequency{
+		shards: make([]frequencyShard, shardCount),
+		mask:   uint64(shardCount - 1),
+		seed:   maphash.MakeSeed(),
+	}
+
+	for i := range s.shards {
+		s.shards[i].frequency = make(Frequency, sizeHint/shardCount)
+	}
+
+	return s
+}
+
+// shardIndex returns the shard responsible for word
+func (s *ShardedFrequency) shardIndex(word string) int {
+	return int(maphash.String(s.seed, word) & s.mask)
+}
+
+// Add increments the count of a single word
+func (s *ShardedFrequency) Add(word string, count int) {
+	shard := &s.shards[s.shardIndex(word)]
+	shard.mu.Lock()
+	shard.frequency[word] += count
+	shard.mu.Unlock()
+}
+
+// AddFrequency merges a whole frequency map.
+// Words are partitioned by shard first so every shard lock is taken at most once.
+func (s *ShardedFrequency) AddFrequency(frequency Frequency) {
+	partitions := make([][]Word, len(s.shards))
+	perShard := len(frequency)/len(s.shards) + 1
+	for i := range partitions {
+		partitions[i] = make([]Word, 0, perShard+perShard/4)
+	}
+
+	for word, count := range frequency {
+		idx := s.shardIndex(word)
+		partitions[idx] = append(partitions[idx], Word{Word: word, Count: count})
+	}
+
+	for idx, words := range partitions {
+		if len(words) == 0 {
+			continue
+		}
+
+		shard := &s.shards[idx]
+		shard.mu.Lock()
+		for _, w := range words {
+			shard.frequency[w.Word] += w.Count
+		}
+		shard.mu.Unlock()
+	}
+}
+
+// Len returns the number of distinct words
+func (s *ShardedFrequency) Len() int {
+	total := 0
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.Lock()
+		total += len(shard.frequency)
+		shard.mu.Unlock()
+	}
+	return total
+}
+
+// Words returns all counts as a slice without building an intermediate map
+func (s *ShardedFrequency) Words() []Word {
+	result := make([]Word, 0, s.Len())
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.Lock()
+		for word, count := range shard.frequency {
+			result = append(result, Word{Word: word, Count: count})
+		}
+		shard.mu.Unlock()
+	}
+	return result
+}
+
+// Frequency returns all counts as a single map
+func (s *ShardedFrequency) Frequency() Frequency {
+	frequency := make(Frequency, s.Len())
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.Lock()
+		for word, count := range shard.frequency {
+			frequency[word] = count
+		}
+		shard.mu.Unlock()
+	}
+	return frequency
+}
+
+// shardsPerMerger gives every merging goroutine several shards to choose from,
+// which keeps the chance of two mergers wanting the same shard low
+const shardsPerMerger = 16
+
+// mergeChunkFrequenciesSharded drains results with several goroutines in parallel,
+// each merging whole chunk frequencies into a shared ShardedFrequency.
+// Results are merged as the counters send them, so merging overlaps counting.
+func mergeChunkFrequenciesSharded(results <-chan ChunkResult, mergers int) *ShardedFrequency {
+	mergers = max(mergers, 1)
+
+	// The vocabulary of the first chunk is a lower bound of the file's one, so it sizes
+	// the shards without guessing from the text length
+	first, ok := <-results
+	sharded := NewShardedFrequency(mergers*shardsPerMerger, len(first.frequency))
+	if !ok {
+		return sharded
+	}
+	sharded.AddFrequency(first.frequency)
+
+	var wg sync.WaitGroup
+	for range mergers {
+		wg.Go(func() {
+			for result := range results {
+				sharded.AddFrequency(result.frequency)
+			}
+		})
+	}
+	wg.Wait()
+
+	return sharded
+}
+
+// mergeChunkResults combines chunk results according to the merge mode
+func mergeChunkResults(results chan ChunkResult, mode MergeMode, mergers int) []Word {
+	if mode == MergeSharded {
+		return mergeChunkFrequenciesSharded(results, mergers).Words()
+	}
+
+	return convertFrequencyToWord(mergeChunkFrequenciesIntoSingleFrequency(results))
+}
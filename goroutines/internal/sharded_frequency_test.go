@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"fmt"
+	"maps"
+	"testing"
+	"unsafe"
+)
+
+// makeChunkFrequencies builds overlapping chunk frequencies over a high-cardinality vocabulary
+func makeChunkFrequencies(chunks, wordsPerChunk int) []Frequency {
+	frequencies := make([]Frequency, chunks)
+	for i := range frequencies {
+		frequency := make(Frequency, wordsPerChunk)
+		// Neighbouring chunks share half of their vocabulary
+		offset := i * wordsPerChunk / 2
+		for j := range wordsPerChunk {
+			frequency[fmt.Sprintf("word%d", offset+j)] = j%7 + 1
+		}
+		frequencies[i] = frequency
+	}
+	return frequencies
+}
+
+// sendChunkResults fills a closed results channel, like the counters in CountWordFrequency do
+func sendChunkResults(frequencies []Frequency) chan ChunkResult {
+	results := make(chan ChunkResult, len(frequencies))
+	for i, frequency := range frequencies {
+		results <- ChunkResult{frequency: frequency, id: i}
+	}
+	close(results)
+	return results
+}
+
+// TestMergeShardedMatchesSingle verifies both merge modes produce the same frequency
+func TestMergeShardedMatchesSingle(t *testing.T) {
+	frequencies := makeChunkFrequencies(8, 5000)
+
+	want := mergeChunkFrequenciesIntoSingleFrequency(sendChunkResults(frequencies))
+	got := mergeChunkFrequenciesSharded(sendChunkResults(frequencies), 4).Frequency()
+
+	if !maps.Equal(got, want) {
+		t.Errorf("sharded merge: got %d distinct words, want %d", len(got), len(want))
+	}
+
+	if size := unsafe.Sizeof(frequencyShard{}); size != cacheLineSize {
+		t.Errorf("shard size: got %d bytes, want %d", size, cacheLineSize)
+	}
+}
+
+// BenchmarkMergeChunkFrequencies compares the single locked map with the sharded merge
+func BenchmarkMergeChunkFrequencies(b *testing.B) {
+	frequencies := makeChunkFrequencies(8, 100_000)
+
+	b.Run("single", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			convertFrequencyToWord(mergeChunkFrequenciesIntoSingleFrequency(sendChunkResults(frequencies)))
+		}
+	})
+
+	b.Run("sharded", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			mergeChunkFrequenciesSharded(sendChunkResults(frequencies), 4).Words()
+		}
+	})
+}
@@ -0,0 +1,158 @@
+package internal
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// spaceSavingEntry is one monitored word of a spaceSaving summary
+type spaceSavingEntry struct {
+	word  string
+	count uint64
+	// overestimation is the most the count can exceed the true count
+	overestimation uint64
+	// index is the position in the min-heap
+	index int
+}
+
+// spaceSavingHeap orders entries by count so the smallest can be evicted
+type spaceSavingHeap []*spaceSavingEntry
+
+func (h spaceSavingHeap) Len() int           { return len(h) }
+func (h spaceSavingHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h spaceSavingHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *spaceSavingHeap) Push(x any) {
+	entry := x.(*spaceSavingEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *spaceSavingHeap) Pop() any {
+	old := *h
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return entry
+}
+
+// spaceSaving tracks the heavy hitters of a word stream with a fixed number of counters.
+// When all counters are taken, a new word replaces the least frequent one and inherits
+// its count as overestimation, so every word occurring more than N/capacity times is kept.
+type spaceSaving struct {
+	capacity int
+	entries  map[string]*spaceSavingEntry
+	heap     spaceSavingHeap
+}
+
+// newSpaceSaving creates a summary monitoring at most capacity words
+func newSpaceSaving(capacity int) *spaceSaving {
+	return &spaceSaving{
+		capacity: capacity,
+		entries:  make(map[string]*spaceSavingEntry, capacity),
+		heap:     make(spaceSavingHeap, 0, capacity),
+	}
+}
+
+// Add counts one occurrence of word; the key is interned only when the word becomes monitored
+func (s *spaceSaving) Add(word []byte) {
+	// Lookups keyed by string(word) do not allocate
+	if entry, ok := s.entries[string(word)]; ok {
+		entry.count++
+		heap.Fix(&s.heap, entry.index)
+		return
+	}
+
+	if len(s.heap) < s.capacity {
+		entry := &spaceSavingEntry{word: string(word), count: 1}
+		s.entries[entry.word] = entry
+		heap.Push(&s.heap, entry)
+		return
+	}
+
+	// Replace the least frequent word, inheriting its count as the error bound
+	entry := s.heap[0]
+	delete(s.entries, entry.word)
+	entry.word = string(word)
+	entry.overestimation = entry.count
+	entry.count++
+	s.entries[entry.word] = entry
+	heap.Fix(&s.heap, 0)
+}
+
+// minCount is the count every unmonitored word is bounded by
+func (s *spaceSaving) minCount() uint64 {
+	if len(s.heap) < s.capacity || len(s.heap) == 0 {
+		return 0
+	}
+	return s.heap[0].count
+}
+
+// Merge combines another summary into this one.
+// A word missing from one summary may still have occurred up to that summary's
+// minimum count, which is added to both its count and its overestimation.
+func (s *spaceSaving) Merge(other *spaceSaving) {
+	ownMin, otherMin := s.minCount(), other.minCount()
+	combined := make(map[string]*spaceSavingEntry, len(s.entries)+len(other.entries))
+
+	for word, entry := range s.entries {
+		merged := *entry
+		if otherEntry, ok := other.entries[word]; ok {
+			merged.count += otherEntry.count
+			merged.overestimation += otherEntry.overestimation
+		} else {
+			merged.count += otherMin
+			merged.overestimation += otherMin
+		}
+		combined[word] = &merged
+	}
+
+	for word, entry := range other.entries {
+		if _, ok := combined[word]; ok {
+			continue
+		}
+		merged := *entry
+		merged.count += ownMin
+		merged.overestimation += ownMin
+		combined[word] = &merged
+	}
+
+	// Keep the capacity most frequent words
+	entries := make([]*spaceSavingEntry, 0, len(combined))
+	for _, entry := range combined {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].count != entries[j].count {
+			return entries[i].count > entries[j].count
+		}
+		return entries[i].word < entries[j].word
+	})
+	entries = entries[:min(len(entries), s.capacity)]
+
+	s.entries = make(map[string]*spaceSavingEntry, s.capacity)
+	s.heap = s.heap[:0]
+	for _, entry := range entries {
+		s.entries[entry.word] = entry
+		heap.Push(&s.heap, entry)
+	}
+}
+
+// Entries returns the monitored words, most frequent first
+func (s *spaceSaving) Entries() []spaceSavingEntry {
+	entries := make([]spaceSavingEntry, 0, len(s.heap))
+	for _, entry := range s.heap {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].count != entries[j].count {
+			return entries[i].count > entries[j].count
+		}
+		return entries[i].word < entries[j].word
+	})
+	return entries
+}
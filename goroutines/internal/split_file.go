@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"io/fs"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// SplitFile is a loaded file whose regions are counted as separate jobs, so that several
+// workers share one huge file instead of leaving the others idle while it finishes.
+// Every part still fans out to CountOptions.Counters goroutines.
+type SplitFile struct {
+	Path string
+
+	input   fileInput
+	opts    CountOptions
+	regions [][]byte
+
+	mu        sync.Mutex
+	frequency Frequency
+	remaining atomic.Int32
+}
+
+// LoadSplitFile reads a file, feeds the whole-file collectors and splits its content into at most
+// parts regions on word boundaries. The input is released once the last part is counted.
+// The read and record stages are timed here, the count and merge stages by every part.
+func LoadSplitFile(fsys fs.FS, filePath string, opts CountOptions, parts int) (*SplitFile, error) {
+	timings := newStageTimings(opts)
+
+	input, err := readInput(fsys, filePath, opts)
+	if err != nil {
+		return nil, err
+	}
+	timings.mark("read")
+
+	recordContent(filePath, input.data, opts)
+	timings.mark("record")
+	timings.log()
+	opts.cooccurrences = opts.Collocations.newFile()
+	opts.shingles = opts.Duplicates.newFile()
+
+	file := &SplitFile{
+		Path:      filePath,
+		input:     input,
+		opts:      opts,
+		regions:   splitBytesAtWordBoundaries(input.data, max(parts, 1)),
+		frequency: make(Frequency),
+	}
+	// An empty file still has one (empty) part, so it finishes like any other
+	if len(file.regions) == 0 {
+		file.regions = [][]byte{nil}
+	}
+	file.remaining.Store(int32(len(file.regions)))
+
+	return file, nil
+}
+
+// Parts returns the number of regions to count
+func (f *SplitFile) Parts() int {
+	return len(f.regions)
+}
+
+// CountPart counts region i, which may run concurrently with the other parts.
+// The call finishing the last part gets the words of the whole file and done set.
+func (f *SplitFile) CountPart(i int) (words []Word, done bool) {
+	opts := f.opts
+	opts.timings = newStageTimings(opts)
+
+	_, span := StartSpan(opts.Context, "count part", slog.Int("part.id", i), slog.Int("part.bytes", len(f.regions[i])))
+	partWords := countWordFrequencyInContent(f.regions[i], f.input.writable, opts)
+	span.End(nil)
+	opts.timings.log()
+
+	f.mu.Lock()
+	for _, word := range partWords {
+		f.frequency[word.Word] += word.Count
+	}
+	f.mu.Unlock()
+
+	if f.remaining.Add(-1) > 0 {
+		return nil, false
+	}
+
+	if err := f.input.release(); err != nil {
+		slog.WarnContext(f.opts.logContext(), "failed to release file input", slog.String("file", f.Path), slog.Any("error", err))
+	}
+	f.opts.Collocations.addFile(f.Path, f.opts.cooccurrences)
+	f.opts.Duplicates.addFile(f.Path, f.opts.shingles)
+	words = f.opts.Redactor.addTokens(f.Path, convertFrequencyToWord(f.frequency))
+	return f.opts.Rules.dropRare(words, f.opts.Stats), true
+}
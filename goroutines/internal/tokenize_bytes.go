@@ -0,0 +1,253 @@
+package internal
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/DonAlexandro/go_advanced/pkg"
+)
+
+// byteTokenizer splits a []byte buffer into lowercased words without building
+// intermediate strings. Yielded words are only valid until the next word is yielded.
+type byteTokenizer struct {
+	// scratch is reused to normalise words that cannot be normalised in place
+	scratch []byte
+	// writable allows lowercasing ASCII words directly inside the buffer
+	writable bool
+}
+
+// newByteTokenizer creates a tokenizer; writable must be false for read-only buffers such as mappings
+func newByteTokenizer(writable bool) byteTokenizer {
+	return byteTokenizer{
+		scratch:  make([]byte, 0, 64),
+		writable: writable,
+	}
+}
+
+// byteCounter counts words directly over a []byte buffer without building
+// intermediate strings. Map keys are interned only when a word is seen for
+// the first time - every later occurrence is a lookup that does not allocate.
+type byteCounter struct {
+	byteTokenizer
+
+	// index maps an interned word to its position in counts
+	index map[string]int
+	// words holds interned keys in first-seen order
+	words []string
+	// counts holds the number of occurrences for words[i]
+	counts []int
+	// arena stores the bytes of every interned key back to back.
+	// Written bytes never change, so keys can safely share its memory.
+	arena strings.Builder
+	// stopwords are never counted
+	stopwords pkg.StopwordSet
+	// rules normalise words before they are counted, and hits counts what they did
+	rules *TokenRules
+	hits  tokenRuleHits
+	// cooccurrences and minHasher receive every counted word; they may be nil
+	cooccurrences *CooccurrenceCounter
+	minHasher     *MinHasher
+}
+
+// newByteCounter creates a counter; writable must be false for read-only buffers such as mappings
+func newByteCounter(writable bool, stopwords pkg.StopwordSet, rules *TokenRules) *byteCounter {
+	return &byteCounter{
+		byteTokenizer: newByteTokenizer(writable),
+		index:         make(map[string]int),
+		stopwords:     stopwords,
+		rules:         rules,
+	}
+}
+
+// isTokenRune reports whether a lowercased rune belongs to a word.
+// Mirrors RemovePunctuation followed by strings.Fields: letters and digits
+// form words, everything else (spaces and punctuation alike) separates them.
+func isTokenRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Count tokenises buf and adds every non-stopword to the counter
+func (c *byteCounter) Count(buf []byte) {
+	c.Each(buf, c.add)
+}
+
+// Each calls yield with every lowercased word of buf, stopwords included
+func (c *byteTokenizer) Each(buf []byte, yield func(word []byte)) {
+	for i := 0; i < len(buf); {
+		// Skip separators until the first byte of the next word
+		r, size := decodeLower(buf[i:])
+		if !isTokenRune(r) {
+			i += size
+			continue
+		}
+
+		start := i
+		// ascii tracks whether the word can be normalised in place
+		ascii := true
+		// changed tracks whether lowercasing modified any rune
+		changed := false
+
+		for i < len(buf) {
+			b := buf[i]
+			if b < utf8.RuneSelf {
+				if 'A' <= b && b <= 'Z' {
+					changed = true
+				} else if !('a' <= b && b <= 'z') && !('0' <= b && b <= '9') {
+					break
+				}
+				i++
+				continue
+			}
+
+			original, size := utf8.DecodeRune(buf[i:])
+			lowered := unicode.ToLower(original)
+			if !isTokenRune(lowered) {
+				break
+			}
+			ascii = false
+			changed = changed || lowered != original
+			i += size
+		}
+
+		yield(c.normalise(buf[start:i], ascii, changed))
+	}
+}
+
+// normalise returns the lowercased form of word, reusing the buffer where possible
+func (c *byteTokenizer) normalise(word []byte, ascii, changed bool) []byte {
+	if !changed {
+		// Already lowercase - the word is used straight from the buffer
+		return word
+	}
+
+	if ascii && c.writable {
+		// Lowercase in place: ASCII case mapping never changes the length
+		for i, b := range word {
+			if 'A' <= b && b <= 'Z' {
+				word[i] = b + ('a' - 'A')
+			}
+		}
+		return word
+	}
+
+	// Unicode case mapping can change the encoded length, so build the
+	// lowercased word in the reusable scratch buffer instead
+	c.scratch = c.scratch[:0]
+	for i := 0; i < len(word); {
+		r, size := decodeLower(word[i:])
+		c.scratch = utf8.AppendRune(c.scratch, r)
+		i += size
+	}
+	return c.scratch
+}
+
+// add increments the count of word, interning it on first insertion
+func (c *byteCounter) add(word []byte) {
+	// Lookups keyed by string(word) are optimised by the compiler and do not allocate
+	if idx, ok := c.index[string(word)]; ok {
+		c.counts[idx]++
+		c.cooccurrences.Add(c.words[idx])
+		c.minHasher.Add(c.words[idx])
+		return
+	}
+
+	// Rules and stopwords are only checked for words that are not counted yet. A counted word
+	// passed them as it is, so only aliases and removed words take this path every time.
+	if c.rules != nil {
+		canonical, keep := c.rules.applyBytes(word, &c.hits)
+		if !keep {
+			return
+		}
+		if idx, ok := c.index[string(canonical)]; ok {
+			c.counts[idx]++
+			c.cooccurrences.Add(c.words[idx])
+			c.minHasher.Add(c.words[idx])
+			return
+		}
+		word = canonical
+	}
+
+	if c.stopwords.ContainsBytes(word) {
+		return
+	}
+
+	// Intern the key into the arena: one growing buffer instead of one allocation per word
+	offset := c.arena.Len()
+	c.arena.Write(word)
+	key := c.arena.String()[offset:]
+
+	c.index[key] = len(c.words)
+	c.words = append(c.words, key)
+	c.counts = append(c.counts, 1)
+	c.cooccurrences.Add(key)
+	c.minHasher.Add(key)
+}
+
+// Frequency converts the collected counts into a Frequency map sharing the interned keys
+func (c *byteCounter) Frequency() Frequency {
+	frequency := make(Frequency, len(c.words))
+	for i, word := range c.words {
+		frequency[word] = c.counts[i]
+	}
+	return frequency
+}
+
+// decodeLower decodes the first rune of buf and lowercases it.
+// Invalid UTF-8 decodes to utf8.RuneError with size 1, exactly like ranging over a string.
+func decodeLower(buf []byte) (rune, int) {
+	if b := buf[0]; b < utf8.RuneSelf {
+		if 'A' <= b && b <= 'Z' {
+			b += 'a' - 'A'
+		}
+		return rune(b), 1
+	}
+	r, size := utf8.DecodeRune(buf)
+	return unicode.ToLower(r), size
+}
+
+// countWordFrequencyInBytes counts the words of buf without converting it to a string
+func countWordFrequencyInBytes(buf []byte, writable bool, tp TextPreprocessor) Frequency {
+	counter := newByteCounter(writable, tp.Stopwords, tp.Rules)
+	counter.cooccurrences = tp.Cooccurrences
+	counter.minHasher = tp.MinHasher
+
+	clock := tp.timings.clock("tokenise")
+	clock.run()
+	counter.Count(buf)
+	clock.pause()
+	clock.stop()
+	tp.Stats.addTokenRuleHits(&counter.hits)
+	return counter.Frequency()
+}
+
+// isWordBoundaryByte reports whether b is an ASCII whitespace byte.
+// Such bytes never occur inside a multi-byte rune or a word, so they are safe split points.
+func isWordBoundaryByte(b byte) bool {
+	return b == ' ' || b == '\n' || b == '\t' || b == '\r' || b == '\v' || b == '\f'
+}
+
+// splitBytesAtWordBoundaries splits buf into at most n disjoint regions.
+// Each region ends on a word boundary so no word is cut in two; the regions
+// are subslices of buf and share its memory.
+func splitBytesAtWordBoundaries(buf []byte, n int) [][]byte {
+	regions := make([][]byte, 0, n)
+	regionSize := max(len(buf)/n, 1)
+
+	for start := 0; start < len(buf); {
+		end := start + regionSize
+		if len(regions) == n-1 || end >= len(buf) {
+			end = len(buf)
+		}
+
+		// Move the end forward until it sits on a boundary byte
+		for end < len(buf) && !isWordBoundaryByte(buf[end]) {
+			end++
+		}
+
+		regions = append(regions, buf[start:end])
+		start = end
+	}
+
+	return regions
+}
@@ -0,0 +1,179 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mdobak/go-xerrors"
+)
+
+// SpanData is a finished span, modelled on the OpenTelemetry span: spans of one run share
+// the trace id, and every span but the root names its parent
+type SpanData struct {
+	TraceID      string         `json:"trace_id"`
+	SpanID       string         `json:"span_id"`
+	ParentSpanID string         `json:"parent_span_id,omitempty"`
+	Name         string         `json:"name"`
+	Start        time.Time      `json:"start_time"`
+	End          time.Time      `json:"end_time"`
+	Duration     time.Duration  `json:"duration_ns"`
+	Attributes   map[string]any `json:"attributes,omitempty"`
+	// Error is set when the span ended with an error
+	Error string `json:"error,omitempty"`
+}
+
+// SpanExporter receives every span when it ends.
+// It is called by many goroutines at once, so implementations must be safe for concurrent use.
+type SpanExporter interface {
+	ExportSpan(span SpanData) error
+}
+
+// JSONSpanExporter writes one JSON object per span and line, e.g. to stdout or a file
+type JSONSpanExporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONSpanExporter creates an exporter writing to w
+func NewJSONSpanExporter(w io.Writer) *JSONSpanExporter {
+	return &JSONSpanExporter{enc: json.NewEncoder(w)}
+}
+
+// ExportSpan writes span as a line of JSON
+func (e *JSONSpanExporter) ExportSpan(span SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.enc.Encode(span); err != nil {
+		return xerrors.Newf("failed to export span %q: %w", span.Name, err)
+	}
+	return nil
+}
+
+// Tracer creates spans and hands them to its exporter when they end.
+// It travels in the context, so instrumented code does not need to know whether tracing is on.
+type Tracer struct {
+	exporter SpanExporter
+}
+
+// NewTracer creates a tracer exporting to exporter
+func NewTracer(exporter SpanExporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+// traceContextKey keys the tracer and the current span of a context
+type traceContextKey int
+
+const (
+	tracerKey traceContextKey = iota
+	spanKey
+)
+
+// WithTracer returns a context whose spans are recorded by tracer
+func WithTracer(ctx context.Context, tracer *Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey, tracer)
+}
+
+// Span is a timed operation. A nil span, as started without a tracer, records nothing.
+// A span belongs to the goroutine that started it and must not be changed concurrently.
+type Span struct {
+	tracer *Tracer
+	data   SpanData
+}
+
+// StartSpan starts a span as a child of the span in ctx and returns a context holding it.
+// Without a tracer in ctx it returns ctx unchanged and a nil span.
+// Every span records the id of the goroutine that started it.
+func StartSpan(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, *Span) {
+	if ctx == nil {
+		return ctx, nil
+	}
+	tracer, _ := ctx.Value(tracerKey).(*Tracer)
+	if tracer == nil {
+		return ctx, nil
+	}
+
+	span := &Span{
+		tracer: tracer,
+		data: SpanData{
+			SpanID:     newSpanID(),
+			Name:       name,
+			Start:      time.Now(),
+			Attributes: map[string]any{"goroutine.id": goroutineID()},
+		},
+	}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.data.TraceID, span.data.ParentSpanID = parent.data.TraceID, parent.data.SpanID
+	} else {
+		span.data.TraceID = newSpanID() + newSpanID()
+	}
+	span.SetAttributes(attrs...)
+
+	return context.WithValue(ctx, spanKey, span), span
+}
+
+// SpanFromContext returns the current span of ctx, or nil if there is none
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey).(*Span)
+	return span
+}
+
+// SetAttributes adds attributes to the span; later values replace earlier ones
+func (s *Span) SetAttributes(attrs ...slog.Attr) {
+	if s == nil {
+		return
+	}
+	for _, attr := range attrs {
+		s.data.Attributes[attr.Key] = attr.Value.Any()
+	}
+}
+
+// End finishes the span, records err if not nil, and exports it.
+// Export errors are logged, as they must not fail the traced work.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+
+	s.data.End = time.Now()
+	s.data.Duration = s.data.End.Sub(s.data.Start)
+	if err != nil {
+		s.data.Error = err.Error()
+	}
+
+	if exportErr := s.tracer.exporter.ExportSpan(s.data); exportErr != nil {
+		slog.Warn("failed to export span", slog.Any("error", exportErr))
+	}
+}
+
+// newSpanID returns 8 random bytes in hex; trace ids are two of them
+func newSpanID() string {
+	return fmt.Sprintf("%016x", rand.Uint64())
+}
+
+// goroutineID parses the id of the calling goroutine from its stack header, "goroutine 42 [running]:".
+// Go deliberately hides goroutine ids, so they are only read for tracing, where they tell
+// which counter goroutine did the work.
+func goroutineID() int64 {
+	var buf [64]byte
+	header := buf[:runtime.Stack(buf[:], false)]
+	header = bytes.TrimPrefix(header, []byte("goroutine "))
+	if end := bytes.IndexByte(header, ' '); end >= 0 {
+		header = header[:end]
+	}
+
+	id, _ := strconv.ParseInt(string(header), 10, 64)
+	return id
+}
@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+)
+
+// collectSpans is an exporter keeping every span in memory
+type collectSpans struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (c *collectSpans) ExportSpan(span SpanData) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.spans = append(c.spans, span)
+	return nil
+}
+
+// TestStartSpan checks parent links, attributes and errors of exported spans
+func TestStartSpan(t *testing.T) {
+	exporter := &collectSpans{}
+	ctx := WithTracer(context.Background(), NewTracer(exporter))
+
+	ctx, root := StartSpan(ctx, "run")
+	_, child := StartSpan(ctx, "file", slog.String("file.path", "a.txt"))
+	child.SetAttributes(slog.Int("words.total", 3))
+	child.End(errors.New("boom"))
+	root.End(nil)
+
+	if len(exporter.spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(exporter.spans))
+	}
+	file, run := exporter.spans[0], exporter.spans[1]
+
+	if run.ParentSpanID != "" || file.ParentSpanID != run.SpanID || file.TraceID != run.TraceID {
+		t.Errorf("got run %+v and file %+v, want file to be a child of run", run, file)
+	}
+	if file.Attributes["file.path"] != "a.txt" || file.Attributes["words.total"] != int64(3) || file.Error != "boom" {
+		t.Errorf("got attributes %v and error %q", file.Attributes, file.Error)
+	}
+	if id, _ := file.Attributes["goroutine.id"].(int64); id <= 0 {
+		t.Errorf("got goroutine id %v", file.Attributes["goroutine.id"])
+	}
+}
+
+// TestStartSpanWithoutTracer checks that spans are no-ops when tracing is off
+func TestStartSpanWithoutTracer(t *testing.T) {
+	ctx := context.Background()
+
+	spanCtx, span := StartSpan(ctx, "run")
+	if span != nil || spanCtx != ctx {
+		t.Errorf("got span %v, want nil", span)
+	}
+
+	// A nil span accepts every call
+	span.SetAttributes(slog.Int("files", 1))
+	span.End(nil)
+}
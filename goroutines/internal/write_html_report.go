@@ -0,0 +1,308 @@
+package internal
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mdobak/go-xerrors"
+)
+
+// htmlReportTemplate is the whole report page; CSS and JavaScript are inline so the file works offline
+//
+//go:embed html_report.tmpl
+var htmlReportTemplate string
+
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"inc": func(i int) int { return i + 1 },
+}).Parse(htmlReportTemplate))
+
+// Sizes of the report sections
+const (
+	// htmlTopWords is the number of bars in the corpus chart
+	htmlTopWords = 25
+	// htmlFileTopWords is the number of bars in the chart of every file
+	htmlFileTopWords = 10
+	// htmlCloudWords is the number of words in the word cloud
+	htmlCloudWords = 100
+	// htmlWordsPerFile caps the rows of a file table, so large corpora still give a usable page
+	htmlWordsPerFile = 1000
+)
+
+// HTMLReport is what goes into a self-contained HTML report
+type HTMLReport struct {
+	Title     string
+	Generated time.Time
+	Result    ResultFile
+	// Stats adds the run statistics section; it may be nil, e.g. for merged results
+	Stats *RunStats
+}
+
+// htmlStat is a labelled value of the summary or run statistics
+type htmlStat struct {
+	Label string
+	Value string
+}
+
+// htmlBar is one bar of a top-words chart; Percent is relative to the largest bar
+type htmlBar struct {
+	Word    string
+	Count   int
+	Percent float64
+}
+
+// htmlCloudWord is a word of the word cloud with its font size in pixels
+type htmlCloudWord struct {
+	Word  string
+	Count int
+	Size  float64
+	Hue   int
+}
+
+// htmlTick is an axis label of the Zipf plot
+type htmlTick struct {
+	Position float64
+	Label    string
+}
+
+// htmlZipfPlot is a log-log rank/frequency plot drawn as an SVG polyline
+type htmlZipfPlot struct {
+	Width, Height            float64
+	Left, Right, Top, Bottom float64
+	LabelX, LabelY           float64
+	Points                   string
+	XTicks, YTicks           []htmlTick
+}
+
+// htmlFile is the section of one file
+type htmlFile struct {
+	Path        string
+	Total       int
+	Distinct    int
+	Approximate bool
+	Readability *ReadabilityStats
+	// Redactions lists the redacted matches per class, e.g. "email 2, ipv4 1"
+	Redactions string
+	Top        []htmlBar
+	Words      []Word
+	// Omitted is the number of words left out of the table
+	Omitted int
+}
+
+// htmlReportView is the data the template renders
+type htmlReportView struct {
+	Title        string
+	Generated    string
+	Approximate  bool
+	Summary      []htmlStat
+	TopWords     []htmlBar
+	Cloud        []htmlCloudWord
+	Zipf         *htmlZipfPlot
+	Collocations *CollocationStats
+	Duplicates   []DuplicateCluster
+	Files        []htmlFile
+	RunStats     []htmlStat
+}
+
+// WriteHTMLReport writes a single-file HTML report with a corpus summary, charts, a word cloud,
+// a Zipf plot, searchable and sortable file tables and the run statistics
+func WriteHTMLReport(w io.Writer, report HTMLReport) error {
+	corpus, approximate := corpusWords(report.Result)
+
+	view := htmlReportView{
+		Title:        report.Title,
+		Generated:    report.Generated.Format("2006-01-02 15:04:05 MST"),
+		Approximate:  approximate,
+		TopWords:     htmlBars(corpus, htmlTopWords),
+		Cloud:        htmlCloud(corpus),
+		Zipf:         htmlZipf(corpus),
+		Collocations: report.Result.Collocations,
+		Duplicates:   report.Result.Duplicates,
+		RunStats:     htmlRunStats(report.Stats),
+	}
+
+	total := 0
+	for _, file := range report.Result.Files {
+		section := htmlFile{
+			Path:        mergedFileKey(file),
+			Distinct:    len(file.Words),
+			Approximate: file.Approximate != nil,
+			Readability: file.Readability,
+			Redactions:  RedactionsToHumanReadable(file.Redactions),
+		}
+
+		words := sortedWords(file.Words)
+		for _, word := range words {
+			section.Total += word.Count
+		}
+		if file.Approximate != nil {
+			section.Total = int(file.Approximate.TotalWords)
+			section.Distinct = int(file.Approximate.DistinctWords)
+		}
+		total += section.Total
+
+		section.Top = htmlBars(words, htmlFileTopWords)
+		section.Words = truncate(words, htmlWordsPerFile)
+		section.Omitted = len(words) - len(section.Words)
+		view.Files = append(view.Files, section)
+	}
+
+	distinct := len(corpus)
+	if report.Result.Corpus != nil {
+		total = int(report.Result.Corpus.TotalWords)
+		distinct = int(report.Result.Corpus.DistinctWords)
+	}
+	view.Summary = []htmlStat{
+		{"Files", strconv.Itoa(len(report.Result.Files))},
+		{"Words", strconv.Itoa(total)},
+		{"Distinct words", strconv.Itoa(distinct)},
+	}
+	if len(corpus) > 0 {
+		view.Summary = append(view.Summary, htmlStat{"Most frequent", fmt.Sprintf("%s (%d)", corpus[0].Word, corpus[0].Count)})
+	}
+	if len(report.Result.Duplicates) > 0 {
+		view.Summary = append(view.Summary, htmlStat{"Near-duplicate clusters", strconv.Itoa(len(report.Result.Duplicates))})
+	}
+
+	if err := htmlReport.Execute(w, view); err != nil {
+		return xerrors.Newf("failed to render HTML report: %w", err)
+	}
+	return nil
+}
+
+// corpusWords returns the corpus-wide words by count: the approximate estimates,
+// the merged aggregate or the sum of the file results
+func corpusWords(result ResultFile) ([]Word, bool) {
+	if result.Corpus != nil {
+		return sortedWords(result.Corpus.Words()), true
+	}
+	if result.Aggregate != nil {
+		return sortedWords(result.Aggregate), false
+	}
+
+	frequency := make(Frequency)
+	approximate := false
+	for _, file := range result.Files {
+		approximate = approximate || file.Approximate != nil
+		for _, word := range file.Words {
+			frequency[word.Word] += word.Count
+		}
+	}
+	return sortedWords(convertFrequencyToWord(frequency)), approximate
+}
+
+// sortedWords returns a copy of words ordered by count then word
+func sortedWords(words []Word) []Word {
+	sorted := slices.Clone(words)
+	SortWords(sorted)
+	return sorted
+}
+
+// htmlBars returns the first limit words of sorted words as bars
+func htmlBars(words []Word, limit int) []htmlBar {
+	words = truncate(words, limit)
+
+	bars := make([]htmlBar, 0, len(words))
+	for _, word := range words {
+		bars = append(bars, htmlBar{Word: word.Word, Count: word.Count, Percent: 100 * float64(word.Count) / float64(max(words[0].Count, 1))})
+	}
+	return bars
+}
+
+// htmlCloud sizes the top words by the square root of their count, in alphabetical order
+func htmlCloud(words []Word) []htmlCloudWord {
+	words = truncate(words, htmlCloudWords)
+	if len(words) == 0 {
+		return nil
+	}
+
+	largest := math.Sqrt(float64(max(words[0].Count, 1)))
+	cloud := make([]htmlCloudWord, 0, len(words))
+	for i, word := range words {
+		size := 12 + 36*math.Sqrt(float64(word.Count))/largest
+		cloud = append(cloud, htmlCloudWord{Word: word.Word, Count: word.Count, Size: math.Round(size), Hue: (i * 47) % 360})
+	}
+
+	slices.SortFunc(cloud, func(a, b htmlCloudWord) int { return strings.Compare(a.Word, b.Word) })
+	return cloud
+}
+
+// htmlZipf plots count against rank on log-log axes. Ranks are sampled about 2% apart,
+// so the polyline stays small however large the vocabulary is.
+func htmlZipf(words []Word) *htmlZipfPlot {
+	if len(words) < 2 || words[0].Count < 2 {
+		return nil
+	}
+
+	plot := &htmlZipfPlot{Width: 640, Height: 360, Left: 56, Right: 620, Top: 16, Bottom: 320}
+	plot.LabelX, plot.LabelY = plot.Left-6, plot.Bottom+16
+
+	maxRank := math.Log10(float64(len(words)))
+	maxCount := math.Log10(float64(words[0].Count))
+	x := func(rank float64) float64 { return plot.Left + math.Log10(rank)/maxRank*(plot.Right-plot.Left) }
+	y := func(count float64) float64 { return plot.Bottom - math.Log10(count)/maxCount*(plot.Bottom-plot.Top) }
+
+	var points strings.Builder
+	last := 0.0
+	for i, word := range words {
+		rank := float64(i + 1)
+		if word.Count < 1 || (rank < last*1.02 && i != len(words)-1) {
+			continue
+		}
+		last = rank
+		fmt.Fprintf(&points, "%.1f,%.1f ", x(rank), y(float64(word.Count)))
+	}
+	plot.Points = strings.TrimSpace(points.String())
+
+	for power := 1.0; power <= float64(len(words)); power *= 10 {
+		plot.XTicks = append(plot.XTicks, htmlTick{Position: x(power), Label: strconv.FormatFloat(power, 'f', -1, 64)})
+	}
+	for power := 1.0; power <= float64(words[0].Count); power *= 10 {
+		plot.YTicks = append(plot.YTicks, htmlTick{Position: y(power), Label: strconv.FormatFloat(power, 'f', -1, 64)})
+	}
+
+	return plot
+}
+
+// htmlRunStats lists the run counters that were used
+func htmlRunStats(stats *RunStats) []htmlStat {
+	if stats == nil {
+		return nil
+	}
+
+	all := []htmlStat{
+		{"Files processed", strconv.FormatInt(stats.FilesProcessed.Load(), 10)},
+		{"Files failed", strconv.FormatInt(stats.FilesFailed.Load(), 10)},
+		{"Bytes read", strconv.FormatInt(stats.BytesRead.Load(), 10)},
+		{"Worker utilisation", fmt.Sprintf("%.1f%%", 100*stats.WorkerUtilisation())},
+		{"Files resumed from journal", strconv.FormatInt(stats.FilesResumed.Load(), 10)},
+		{"Files split across workers", strconv.FormatInt(stats.FilesSplit.Load(), 10)},
+		{"Malformed JSON lines skipped", strconv.FormatInt(stats.JSONLinesSkipped.Load(), 10)},
+		{"Files read with mmap", strconv.FormatInt(stats.MmapFiles.Load(), 10)},
+		{"Files read into memory", strconv.FormatInt(stats.ReadFileFiles.Load(), 10)},
+		{"Mmap fallbacks: small files", strconv.FormatInt(stats.MmapFallbackSmall.Load(), 10)},
+		{"Mmap fallbacks: special files", strconv.FormatInt(stats.MmapFallbackSpecial.Load(), 10)},
+		{"Mmap fallbacks: compressed files", strconv.FormatInt(stats.MmapFallbackCompressed.Load(), 10)},
+		{"Mmap fallbacks: errors", strconv.FormatInt(stats.MmapFallbackError.Load(), 10)},
+		{"Mmap fallbacks: virtual files", strconv.FormatInt(stats.MmapFallbackVirtual.Load(), 10)},
+	}
+
+	for rule := range tokenRuleCount {
+		all = append(all, htmlStat{"Token rule: " + rule.String(), strconv.FormatInt(stats.TokenRuleHits[rule].Load(), 10)})
+	}
+
+	// The first four are always shown; the other counters only when used
+	shown := all[:4]
+	for _, stat := range all[4:] {
+		if stat.Value != "0" {
+			shown = append(shown, stat)
+		}
+	}
+	return shown
+}
@@ -0,0 +1,38 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestWriteHTMLReport checks the report holds every section, escapes words and loads nothing from the network
+func TestWriteHTMLReport(t *testing.T) {
+	stats := &RunStats{}
+	stats.FilesProcessed.Add(2)
+
+	result := ResultFile{Files: []FileWordFrequency{
+		{FileName: "a.txt", Path: "logs/a.txt", Words: []Word{{"timeout", 9}, {"retry", 3}, {"<script>", 1}}},
+		{FileName: "b.txt", Path: "logs/b.txt", Words: []Word{{"timeout", 4}, {"queue", 2}}},
+	}}
+
+	var out strings.Builder
+	if err := WriteHTMLReport(&out, HTMLReport{Title: "Nightly run", Generated: time.Unix(0, 0).UTC(), Result: result, Stats: stats}); err != nil {
+		t.Fatal(err)
+	}
+	page := out.String()
+
+	for _, want := range []string{
+		"<title>Nightly run</title>",
+		"Corpus summary", "Top words", "Word cloud", "Zipf plot", "Run statistics",
+		`data-name="logs/a.txt"`, "<b>19</b>", "timeout (13)", "&lt;script&gt;", "<polyline points=",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("report does not contain %q", want)
+		}
+	}
+
+	if strings.Count(page, "<script") != 1 || strings.Contains(page, "src=") || strings.Contains(page, "http") {
+		t.Error("report must only hold its own inline script and no external resources")
+	}
+}
@@ -2,15 +2,64 @@ package pkg
 
 import (
 	"bufio"
+	"io"
 	"os"
 	"strings"
 	"sync"
 )
 
+// StopwordSet stores lowercase stopwords for O(1) lookup
+// Empty struct uses zero memory - optimal for set behavior
+// A nil set is valid and contains no words, so no filtering occurs
+type StopwordSet map[string]struct{}
+
+// LoadStopwords reads one stopword per line from r
+// Blank lines are skipped and words are lowercased for case-insensitive matching
+func LoadStopwords(r io.Reader) (StopwordSet, error) {
+	set := make(StopwordSet)
+
+	// Read line by line
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if word != "" {
+			// Store lowercase for case-insensitive matching
+			// Words are already lowercased by pipeline before filtering
+			set[strings.ToLower(word)] = struct{}{}
+		}
+	}
+
+	return set, scanner.Err()
+}
+
+// LoadStopwordsFile reads stopwords from the file at path
+func LoadStopwordsFile(path string) (StopwordSet, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return LoadStopwords(file)
+}
+
+// Contains checks if a word should be filtered out
+// Safe for concurrent use as long as the set is no longer modified
+func (s StopwordSet) Contains(word string) bool {
+	_, exists := s[word]
+	return exists
+}
+
+// ContainsBytes is Contains for a word held in a byte slice
+// The map lookup converts the slice without allocating a string
+func (s StopwordSet) ContainsBytes(word []byte) bool {
+	_, exists := s[string(word)]
+	return exists
+}
+
 var (
-	// stopwordsSet stores stopwords for O(1) lookup
-	// Empty struct uses zero memory - optimal for set behavior
-	stopwordsSet map[string]struct{}
+	// stopwordsSet stores stopwords loaded from the working directory for IsStopword
+	stopwordsSet StopwordSet
 
 	// stopwordsOnce ensures stopwords are loaded exactly once
 	// Thread-safe even with concurrent access from multiple goroutines
@@ -21,42 +70,20 @@ var (
 // Called via sync.Once - executes exactly once regardless of concurrent calls
 func loadStopwords() {
 	stopwordsOnce.Do(func() {
-		// Initialize empty set - if file doesn't exist, no filtering occurs
-		stopwordsSet = make(map[string]struct{})
-
 		// Hardcoded path to stopwords.txt in project root
-		file, err := os.Open("stopwords.txt")
-		if err != nil {
-			// Silent failure - file is optional
-			// stopwordsSet remains empty, no filtering will occur
-			return
-		}
-		defer file.Close()
-
-		// Read file line by line
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			word := strings.TrimSpace(scanner.Text())
-			if word != "" {
-				// Store lowercase for case-insensitive matching
-				// Words are already lowercased by pipeline before filtering
-				stopwordsSet[strings.ToLower(word)] = struct{}{}
-			}
-		}
-		// Ignore scanner errors - partial loading is acceptable
+		// Silent failure - file is optional, partial loading is acceptable
+		// stopwordsSet remains empty, no filtering will occur
+		stopwordsSet, _ = LoadStopwordsFile("stopwords.txt")
 	})
 }
 
-// IsStopword checks if a word should be filtered out
+// IsStopword checks if a word is listed in stopwords.txt of the working directory
+// Kept for simple programs - library code should pass a StopwordSet explicitly instead
 // Thread-safe: sync.Once ensures initialization completes before any reads
-// After initialization, map is read-only - safe for concurrent access
 func IsStopword(word string) bool {
 	// Ensure stopwords are loaded before checking
 	// sync.Once guarantees this executes exactly once across all goroutines
 	loadStopwords()
 
-	// Check if word exists in set
-	// Returns false if stopwordsSet is empty (file didn't exist/load failed)
-	_, exists := stopwordsSet[word]
-	return exists
+	return stopwordsSet.Contains(word)
 }
@@ -0,0 +1,163 @@
+package wordfreq
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+
+	"github.com/DonAlexandro/go_advanced/internal"
+	"github.com/mdobak/go-xerrors"
+)
+
+// Report is the result of analysing a set of files
+type Report struct {
+	// Files holds one result per successfully processed file
+	Files []FileWordFrequency
+	// Corpus holds corpus-wide estimates; only set in approximate mode
+	Corpus *ApproximateStats
+	// Collocations holds the corpus-wide word pairs; only set when Options.Collocations is set
+	Collocations *CollocationStats
+	// Errors holds the files that could not be processed
+	Errors []FileError
+	// Stats holds the counters collected during the analysis
+	Stats *RunStats
+	// Inputs holds the content hash of every file read; only set in deterministic mode
+	Inputs []InputDigest
+	// Index holds the positions of every word; only set when Options.Index is true
+	Index *Index
+	// Duplicates holds the clusters of near-identical files; only set when Options.Duplicates is set
+	Duplicates []DuplicateCluster
+	// Redactions holds the number of redacted matches per class over all files; only set when Options.Redaction is set
+	Redactions map[string]int
+	// RunID correlates the log lines of the analysis; it is taken from the context if set there
+	RunID string
+}
+
+// sort orders files and errors by path, and words by count then word
+func (r *Report) sort() {
+	internal.SortFileResults(r.Files)
+
+	slices.SortStableFunc(r.Errors, func(a, b FileError) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+}
+
+// FileError records why a single file could not be processed
+type FileError struct {
+	Path string
+	Err  error
+}
+
+// Error implements the error interface
+func (e FileError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e FileError) Unwrap() error {
+	return e.Err
+}
+
+// Analyze counts the words read from r
+// The returned result has no file name; callers can set one if needed
+func Analyze(ctx context.Context, r io.Reader, opts Options) (*FileWordFrequency, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	opts = opts.withDefaults()
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, xerrors.Newf("failed to read input: %w", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Without a file name there is no extension to go by, so only a fixed extractor applies
+	content, err = internal.ExtractText(opts.Extract, content, opts.JSONFields)
+	if err != nil {
+		return nil, xerrors.Newf("failed to extract %s text: %w", opts.Extract, err)
+	}
+
+	// The options are valid, so the redactor compiles; content without a file is redacted under the empty path
+	redactor, _ := opts.newRedactor()
+	content = redactor.Redact("", content, true)
+
+	// Co-occurrences are counted from the words the counting stages keep, under the empty path
+	var collocations *internal.CollocationCollector
+	if opts.Collocations != nil {
+		collocations = internal.NewCollocationCollector(*opts.Collocations, nil, false)
+	}
+
+	countOptions := opts.countOptions(collectors{collocations: collocations, redactor: redactor})
+	result := &FileWordFrequency{Redactions: redactor.File("")}
+
+	// Readability is measured first, as the bytes pipeline may lowercase content in place
+	if opts.Readability {
+		result.Readability = internal.MeasureReadability(string(content))
+	}
+
+	if opts.Approximate != nil {
+		counter := internal.CountWordFrequencyApproximateInBytes(content, countOptions, *opts.Approximate)
+		result.Approximate = counter.Stats()
+		result.Words = result.Approximate.Words()
+		result.Collocations = collocations.File("")
+		return result, nil
+	}
+
+	result.Words = internal.CountWordFrequencyInBytes(content, countOptions)
+	result.Collocations = collocations.File("")
+	if opts.Deterministic {
+		internal.SortWords(result.Words)
+	}
+
+	return result, nil
+}
+
+// AnalyzeFS counts the words of every text file (.txt) in fsys, and with
+// ExtractAuto of every HTML, Markdown and JSON file as well (with a forced
+// extractor, of the files of its format),
+// using a pool of opts.Workers workers. Files that fail are listed in Report.Errors;
+// an error is only returned when discovery fails or ctx is cancelled.
+func AnalyzeFS(ctx context.Context, fsys fs.FS, opts Options) (*Report, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	return runWorkerPool(ctx, fsys, opts.withDefaults())
+}
+
+// AnalyzeDir is AnalyzeFS for a directory, or a single file, on local disk
+func AnalyzeDir(ctx context.Context, dir string, opts Options) (*Report, error) {
+	fsys, err := OpenPath(dir)
+	if err != nil {
+		return nil, err
+	}
+	return AnalyzeFS(ctx, fsys, opts)
+}
+
+// OpenPath opens a directory on local disk as a file system for AnalyzeFS.
+// A regular file is opened as a file system holding just that file.
+func OpenPath(p string) (fs.FS, error) {
+	return internal.OpenPath(p)
+}
+
+// OpenArchive opens a .zip, .tar, .tar.gz or .tgz archive as a file system for AnalyzeFS
+// The closer must be called once the analysis is done
+func OpenArchive(archivePath string) (fs.FS, io.Closer, error) {
+	return internal.OpenArchive(archivePath)
+}
+
+// IsArchive reports whether name has an archive extension supported by OpenArchive
+func IsArchive(name string) bool {
+	return internal.IsArchive(name)
+}
+
+// Overlay stacks file systems for AnalyzeFS; earlier layers shadow files of later ones
+func Overlay(layers ...fs.FS) fs.FS {
+	return internal.OverlayFS(layers)
+}
@@ -0,0 +1,161 @@
+package wordfreq
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// TestAnalyzeUsesOptionsOnly checks that stopwords come from Options and not the working directory
+func TestAnalyzeUsesOptionsOnly(t *testing.T) {
+	text := "The cat and the dog. THE END"
+	stopwords := StopwordSet{"the": {}, "and": {}}
+
+	for _, mode := range []PipelineMode{PipelineStream, PipelineBatch, PipelineFused, PipelineBytes} {
+		opts := DefaultOptions()
+		opts.Pipeline = mode
+		opts.Stopwords = stopwords
+
+		result, err := Analyze(context.Background(), strings.NewReader(text), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := make(Frequency)
+		for _, w := range result.Words {
+			got[w.Word] = w.Count
+		}
+
+		want := Frequency{"cat": 1, "dog": 1, "end": 1}
+		if len(got) != len(want) || got["cat"] != 1 || got["dog"] != 1 || got["end"] != 1 {
+			t.Errorf("%s pipeline: got %v, want %v", mode, got, want)
+		}
+	}
+}
+
+// TestAnalyzeFSInMemory runs the worker pool over an in-memory file system and an overlay
+func TestAnalyzeFSInMemory(t *testing.T) {
+	base := fstest.MapFS{
+		"a.txt":       {Data: []byte("go go gophers")},
+		"logs/b.txt":  {Data: []byte("old log")},
+		"logs/c.json": {Data: []byte(`{"skipped": true}`)},
+	}
+	patch := fstest.MapFS{
+		"logs/b.txt": {Data: []byte("new log, new log")},
+	}
+
+	report, err := AnalyzeFS(context.Background(), Overlay(patch, base), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Files) != 2 || len(report.Errors) != 0 {
+		t.Fatalf("got %d results and %v errors, want 2 results", len(report.Files), report.Errors)
+	}
+
+	for _, file := range report.Files {
+		counts := make(Frequency)
+		for _, w := range file.Words {
+			counts[w.Word] = w.Count
+		}
+
+		switch file.FileName {
+		case "a.txt":
+			if counts["go"] != 2 || counts["gophers"] != 1 {
+				t.Errorf("a.txt: got %v", counts)
+			}
+		case "b.txt":
+			if counts["new"] != 2 || counts["old"] != 0 {
+				t.Errorf("b.txt should come from the patch layer, got %v", counts)
+			}
+		default:
+			t.Errorf("unexpected file %q", file.FileName)
+		}
+	}
+
+	if got := report.Stats.FilesProcessed.Load(); got != 2 {
+		t.Errorf("files processed: got %d, want 2", got)
+	}
+}
+
+// TestAnalyzeFSDeterministic checks that ordering does not depend on worker scheduling
+func TestAnalyzeFSDeterministic(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for i := range 20 {
+		fsys[fmt.Sprintf("dir%d/file%02d.txt", i%3, i)] = &fstest.MapFile{Data: []byte(strings.Repeat("b a c b ", i+1))}
+	}
+
+	var previous *Report
+	for _, workers := range []int{1, 4, 8} {
+		opts := DefaultOptions()
+		opts.Workers = workers
+		opts.Deterministic = true
+
+		report, err := AnalyzeFS(context.Background(), fsys, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !slices.IsSortedFunc(report.Files, func(a, b FileWordFrequency) int { return strings.Compare(a.Path, b.Path) }) {
+			t.Errorf("workers=%d: files are not ordered by path", workers)
+		}
+		if len(report.Inputs) != len(fsys) {
+			t.Errorf("workers=%d: got %d input digests, want %d", workers, len(report.Inputs), len(fsys))
+		}
+		if previous != nil && !reflect.DeepEqual(report.Files, previous.Files) {
+			t.Errorf("workers=%d: result differs from the previous run", workers)
+		}
+		previous = report
+	}
+}
+
+// TestAnalyzeFSSplitFiles checks that files counted in parts by several workers get the same counts
+func TestAnalyzeFSSplitFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"huge.txt":  &fstest.MapFile{Data: []byte(strings.Repeat("alpha beta gamma beta\n", 2000))},
+		"small.txt": &fstest.MapFile{Data: []byte("beta delta")},
+	}
+
+	var previous *Report
+	for _, splitSize := range []int64{-1, 1000} {
+		opts := DefaultOptions()
+		opts.Deterministic = true
+		opts.SplitSize = splitSize
+
+		report, err := AnalyzeFS(context.Background(), fsys, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wantSplit := int64(0)
+		if splitSize > 0 {
+			wantSplit = 1
+		}
+		if got := report.Stats.FilesSplit.Load(); got != wantSplit {
+			t.Errorf("split size %d: got %d split files, want %d", splitSize, got, wantSplit)
+		}
+		if utilisation := report.Stats.WorkerUtilisation(); utilisation <= 0 || utilisation > 1 {
+			t.Errorf("split size %d: got worker utilisation %f", splitSize, utilisation)
+		}
+		if previous != nil && !reflect.DeepEqual(report.Files, previous.Files) {
+			t.Errorf("split size %d: got %v, want %v", splitSize, report.Files, previous.Files)
+		}
+		previous = report
+	}
+}
+
+// TestJournalHeaderIgnoresWorkers checks that a run can be resumed with another number of workers
+func TestJournalHeaderIgnoresWorkers(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Workers = 1
+	header := journalHeader(opts)
+
+	opts.Workers = 8
+	if other := journalHeader(opts); !reflect.DeepEqual(other, header) {
+		t.Errorf("got header %+v with 8 workers, want %+v as with 1", other, header)
+	}
+}
@@ -0,0 +1,44 @@
+package wordfreq
+
+import (
+	"encoding/json"
+
+	"github.com/DonAlexandro/go_advanced/internal"
+)
+
+// Types for checkpointing a run
+type (
+	// Journal records completed files so an interrupted run can be resumed
+	Journal = internal.Journal
+	// JournalEntry is a completed file with the digest of its content
+	JournalEntry = internal.JournalEntry
+)
+
+// Resumable reports whether a journal can be used with opts: the corpus-wide modes
+// need every file's content, which a journal does not keep
+func (o Options) Resumable() bool {
+	return o.Approximate == nil && o.Collocations == nil && o.Duplicates == nil && !o.Index
+}
+
+// CreateJournal starts a new journal at path for a run with opts, replacing any previous one
+func CreateJournal(path string, opts Options) (*Journal, error) {
+	return internal.CreateJournal(path, journalHeader(opts))
+}
+
+// ResumeJournal continues the journal at path, or starts one if there is none.
+// It fails if the journal was written with options of a different ConfigHash.
+func ResumeJournal(path string, opts Options) (*Journal, error) {
+	return internal.ResumeJournal(path, journalHeader(opts))
+}
+
+// journalHeader records the parameters of a run in the form of its manifest
+func journalHeader(opts Options) internal.JournalHeader {
+	config := opts.withDefaults().manifestConfig()
+	encoded, _ := json.Marshal(config)
+
+	return internal.JournalHeader{
+		ToolVersion: Version,
+		ConfigHash:  config.hash(),
+		Config:      encoded,
+	}
+}
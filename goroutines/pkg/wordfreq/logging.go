@@ -0,0 +1,53 @@
+package wordfreq
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/DonAlexandro/go_advanced/internal"
+)
+
+// Types for configuring the logs and metrics of an analysis
+type (
+	// Config is a parsed TOML configuration file
+	Config = internal.Config
+	// ConfigSection is one [section] of a configuration file
+	ConfigSection = internal.ConfigSection
+	// RotatingFile is a log file rotated once it reaches a size limit
+	RotatingFile = internal.RotatingFile
+	// ContextHandler adds the run id and file path carried by the context to log records
+	ContextHandler = internal.ContextHandler
+	// Metrics collects run counters, stage latencies and pool gauges in the Prometheus format
+	Metrics = internal.Metrics
+)
+
+// LoadConfig reads a TOML configuration file; a missing file is an error matching fs.ErrNotExist
+func LoadConfig(path string) (Config, error) {
+	return internal.LoadConfig(path)
+}
+
+// OpenRotatingFile opens a log file kept below maxSize bytes (0 for no limit) with maxFiles rotated copies
+func OpenRotatingFile(path string, maxSize int64, maxFiles int) (*RotatingFile, error) {
+	return internal.OpenRotatingFile(path, maxSize, maxFiles)
+}
+
+// NewContextHandler wraps handler so that records logged with a context carry its run id and file.
+// Per-file debug timings are written when the default logger has debug enabled.
+func NewContextHandler(handler slog.Handler) *ContextHandler {
+	return internal.NewContextHandler(handler)
+}
+
+// NewRunID returns a random identifier for one run
+func NewRunID() string {
+	return internal.NewRunID()
+}
+
+// WithRunID sets the run id an analysis logs with; without it AnalyzeFS picks a new one
+func WithRunID(ctx context.Context, runID string) context.Context {
+	return internal.WithRunID(ctx, runID)
+}
+
+// NewMetrics creates empty metrics; pass them in Options.Metrics and serve them with net/http
+func NewMetrics() *Metrics {
+	return internal.NewMetrics()
+}
@@ -0,0 +1,107 @@
+package wordfreq
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// Version is the version of the analysis library and the command line tool.
+// It is the only place the version is kept; run manifests and journals report it.
+const Version = "1.0.0"
+
+// Manifest records everything needed to reproduce a run and check its output
+type Manifest struct {
+	ToolVersion string `json:"tool_version"`
+	GoVersion   string `json:"go_version"`
+	// Workers only changes how fast a run is, so it is recorded outside Config and its hash
+	Workers int `json:"workers"`
+	// ConfigHash is the SHA-256 of Config in its JSON form
+	ConfigHash string         `json:"config_hash"`
+	Config     ManifestConfig `json:"config"`
+	// Inputs lists every analysed file with its content hash, ordered by path
+	Inputs []InputDigest `json:"inputs"`
+	// ResultHash is the SHA-256 of the written result file; set by the writer
+	ResultHash string `json:"result_hash,omitempty"`
+}
+
+// ManifestConfig is the part of Options that influences a run, in a stable JSON form
+type ManifestConfig struct {
+	Counters      int                 `json:"counters"`
+	Pipeline      string              `json:"pipeline"`
+	Input         string              `json:"input"`
+	Merge         string              `json:"merge"`
+	Extract       string              `json:"extract"`
+	JSONFields    []string            `json:"json_fields"`
+	StopwordsHash string              `json:"stopwords_hash"`
+	Approximate   *ApproximateOptions `json:"approximate,omitempty"`
+	Collocations  *CollocationOptions `json:"collocations,omitempty"`
+	Duplicates    *DuplicateOptions   `json:"duplicates,omitempty"`
+	Readability   bool                `json:"readability,omitempty"`
+	Redaction     *RedactionOptions   `json:"redaction,omitempty"`
+	Rules         *TokenRules         `json:"rules,omitempty"`
+	Deterministic bool                `json:"deterministic"`
+}
+
+// NewManifest describes a run made with opts that produced report
+func NewManifest(opts Options, report *Report) Manifest {
+	opts = opts.withDefaults()
+	config := opts.manifestConfig()
+
+	return Manifest{
+		ToolVersion: Version,
+		GoVersion:   runtime.Version(),
+		Workers:     opts.Workers,
+		ConfigHash:  config.hash(),
+		Config:      config,
+		Inputs:      report.Inputs,
+	}
+}
+
+// ConfigHash identifies the effective configuration of opts
+// Two runs with the same hash and the same input hashes produce the same result
+func (o Options) ConfigHash() string {
+	return o.withDefaults().manifestConfig().hash()
+}
+
+// manifestConfig extracts the reproducibility-relevant settings
+func (o Options) manifestConfig() ManifestConfig {
+	return ManifestConfig{
+		Counters:      o.Counters,
+		Pipeline:      o.Pipeline.String(),
+		Input:         o.Input.String(),
+		Merge:         o.Merge.String(),
+		Extract:       o.Extract.String(),
+		JSONFields:    o.JSONFields,
+		StopwordsHash: hashStopwords(o.Stopwords),
+		Approximate:   o.Approximate,
+		Collocations:  o.Collocations,
+		Duplicates:    o.Duplicates,
+		Readability:   o.Readability,
+		Redaction:     o.Redaction,
+		Rules:         o.Rules,
+		Deterministic: o.Deterministic,
+	}
+}
+
+// hash returns the SHA-256 of the config; struct fields marshal in declaration order
+func (c ManifestConfig) hash() string {
+	encoded, _ := json.Marshal(c)
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// hashStopwords hashes the sorted stopwords, so set iteration order does not matter
+func hashStopwords(stopwords StopwordSet) string {
+	words := make([]string, 0, len(stopwords))
+	for word := range stopwords {
+		words = append(words, word)
+	}
+	slices.Sort(words)
+
+	sum := sha256.Sum256([]byte(strings.Join(words, "\n")))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,64 @@
+package wordfreq
+
+import "github.com/DonAlexandro/go_advanced/internal"
+
+// Types for redacting sensitive text before it is counted
+type (
+	// RedactionOptions selects the classes to redact and what becomes of the matches
+	RedactionOptions = internal.RedactionOptions
+	// RedactionClass is a named pattern of sensitive text
+	RedactionClass = internal.RedactionClass
+	// RedactMode selects whether matches are counted as class tokens or dropped
+	RedactMode = internal.RedactMode
+)
+
+// Redaction modes
+const (
+	RedactReplace = internal.RedactReplace
+	RedactDrop    = internal.RedactDrop
+)
+
+// BuiltinRedactionClasses are the predefined classes: email, uuid, ipv6, ipv4, card and phone
+var BuiltinRedactionClasses = internal.BuiltinRedactionClasses
+
+// ParseRedactMode converts a name (replace or drop) into a RedactMode
+func ParseRedactMode(name string) (RedactMode, error) {
+	return internal.ParseRedactMode(name)
+}
+
+// ParseRedactionClasses looks up comma-separated built-in class names; "all" selects every one
+func ParseRedactionClasses(names string) ([]RedactionClass, error) {
+	return internal.ParseRedactionClasses(names)
+}
+
+// ParseRedactionClass parses a custom class written as name=regexp
+func ParseRedactionClass(definition string) (RedactionClass, error) {
+	return internal.ParseRedactionClass(definition)
+}
+
+// RedactionsToHumanReadable formats counts per class as "email 2, ipv4 1", ordered by class
+func RedactionsToHumanReadable(counts map[string]int) string {
+	return internal.RedactionsToHumanReadable(counts)
+}
+
+// newRedactor compiles the redaction of opts; it is nil when redaction is off
+func (o Options) newRedactor() (*internal.Redactor, error) {
+	if o.Redaction == nil {
+		return nil, nil
+	}
+	return internal.NewRedactor(*o.Redaction)
+}
+
+// sumRedactions adds up the redactions of every file, resumed files included
+func sumRedactions(files []FileWordFrequency) map[string]int {
+	var totals map[string]int
+	for _, file := range files {
+		if len(file.Redactions) > 0 && totals == nil {
+			totals = make(map[string]int)
+		}
+		for class, count := range file.Redactions {
+			totals[class] += count
+		}
+	}
+	return totals
+}
@@ -0,0 +1,187 @@
+package wordfreq
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/DonAlexandro/go_advanced/internal"
+	"github.com/mdobak/go-xerrors"
+)
+
+// Types for reading written results back and comparing them
+type (
+	// ResultFile is the JSON form of a written result
+	ResultFile = internal.ResultFile
+	// ResultDiff is the difference between two result sets
+	ResultDiff = internal.ResultDiff
+	// FrequencyDiff describes how the words of one file or the corpus changed
+	FrequencyDiff = internal.FrequencyDiff
+	// WordChange is the count of a word present in both result sets
+	WordChange = internal.WordChange
+	// ConflictMode selects what happens when a file appears in more than one merged shard
+	ConflictMode = internal.ConflictMode
+	// MergeConflict is a file found in more than one shard
+	MergeConflict = internal.MergeConflict
+	// MergedResults is the unified result of several shards
+	MergedResults = internal.MergedResults
+	// Query selects words from stored results
+	Query = internal.Query
+	// QuerySort selects the order of query rows
+	QuerySort = internal.QuerySort
+	// QueryRow is one word of a query result
+	QueryRow = internal.QueryRow
+	// HTMLReport is what goes into a self-contained HTML report
+	HTMLReport = internal.HTMLReport
+	// ClusterMethod selects the document clustering algorithm
+	ClusterMethod = internal.ClusterMethod
+	// ClusterOptions configures document clustering
+	ClusterOptions = internal.ClusterOptions
+	// DocumentClusters is the result of clustering a result set
+	DocumentClusters = internal.DocumentClusters
+	// DocumentCluster is a group of similar files with the terms characterising it
+	DocumentCluster = internal.DocumentCluster
+)
+
+// Conflict modes for merging shards, query orders and cluster methods
+const (
+	ConflictError = internal.ConflictError
+	ConflictFirst = internal.ConflictFirst
+	ConflictSum   = internal.ConflictSum
+
+	QuerySortDefault = internal.QuerySortDefault
+	QuerySortCount   = internal.QuerySortCount
+	QuerySortWord    = internal.QuerySortWord
+	QuerySortFile    = internal.QuerySortFile
+
+	ClusterAgglomerative = internal.ClusterAgglomerative
+	ClusterKMeans        = internal.ClusterKMeans
+)
+
+// CorpusSectionName is the name of the corpus-wide section of markdown results
+const CorpusSectionName = internal.CorpusSectionName
+
+// DuplicatesSectionName is the name of the near-duplicate section of markdown results
+const DuplicatesSectionName = internal.DuplicatesSectionName
+
+// DuplicatesToHumanReadable writes near-duplicate clusters as a section of markdown results
+func DuplicatesToHumanReadable(clusters []DuplicateCluster) string {
+	return internal.DuplicatesToHumanReadable(clusters)
+}
+
+// ResultFile returns the report in the form written to JSON result files
+func (r *Report) ResultFile() ResultFile {
+	return ResultFile{Files: r.Files, Corpus: r.Corpus, Collocations: r.Collocations, Duplicates: r.Duplicates}
+}
+
+// LoadResults reads a result file written by the command line tool
+// Files ending in .json are decoded as JSON, anything else is parsed as markdown.
+func LoadResults(filename string) ([]FileWordFrequency, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, xerrors.Newf("failed to open result file: %w", err)
+	}
+	defer file.Close()
+
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		return internal.ParseJSONResults(file)
+	}
+
+	return internal.ParseHumanReadable(file)
+}
+
+// Diff compares two result sets; every word list is cut to limit entries (0 keeps all)
+func Diff(before, after []FileWordFrequency, limit int) ResultDiff {
+	return internal.DiffResults(before, after, limit)
+}
+
+// ParseConflictMode converts a command line name into a ConflictMode
+func ParseConflictMode(name string) (ConflictMode, error) {
+	return internal.ParseConflictMode(name)
+}
+
+// MergeResultFiles combines result files written by separate runs over shards of a corpus.
+// Shards are read one file result at a time, so only the merged counts are held in memory.
+// With ConflictError the merged result is returned together with the conflict error.
+// When a shard cannot be read, the files merged so far are returned with the error.
+func MergeResultFiles(filenames []string, mode ConflictMode) (MergedResults, error) {
+	merger := internal.NewResultMerger(mode)
+
+	for _, filename := range filenames {
+		if err := mergeShard(merger, filename); err != nil {
+			merged, _ := merger.Finish()
+			return merged, xerrors.Newf("failed to load shard %s: %w", filename, err)
+		}
+	}
+
+	return merger.Finish()
+}
+
+// mergeShard streams the file results of one result file into merger
+func mergeShard(merger *internal.ResultMerger, filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return xerrors.Newf("failed to open result file: %w", err)
+	}
+	defer file.Close()
+
+	scan := internal.ScanHumanReadable(file)
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		scan = internal.ScanJSONResults(file)
+	}
+
+	for result, err := range scan {
+		if err != nil {
+			return err
+		}
+		merger.AddFile(filename, result)
+	}
+	return nil
+}
+
+// MergedResultFile returns merged results in the form written to JSON result files
+func MergedResultFile(merged MergedResults) ResultFile {
+	return ResultFile{Files: merged.Files, Aggregate: merged.Aggregate}
+}
+
+// ParseQuerySort converts a command line name into a QuerySort
+func ParseQuerySort(name string) (QuerySort, error) {
+	return internal.ParseQuerySort(name)
+}
+
+// RunQuery answers q over stored results
+func RunQuery(results []FileWordFrequency, q Query) ([]QueryRow, error) {
+	return internal.RunQuery(results, q)
+}
+
+// FilterResults keeps the results whose path (or file name) matches glob, as the query -files filter does
+func FilterResults(results []FileWordFrequency, glob string) ([]FileWordFrequency, error) {
+	return internal.FilterResults(results, glob)
+}
+
+// WriteQueryTable writes query rows as an aligned plain-text table
+func WriteQueryTable(w io.Writer, rows []QueryRow) error {
+	return internal.WriteQueryTable(w, rows)
+}
+
+// ParseClusterMethod converts a name (agglomerative or kmeans) into a ClusterMethod
+func ParseClusterMethod(name string) (ClusterMethod, error) {
+	return internal.ParseClusterMethod(name)
+}
+
+// ClusterDocuments groups stored results by the cosine similarity of their TF-IDF vectors
+func ClusterDocuments(results []FileWordFrequency, options ClusterOptions) (DocumentClusters, error) {
+	return internal.ClusterDocuments(results, options)
+}
+
+// WriteClusterTable writes clusters with their top terms and files as plain text
+func WriteClusterTable(w io.Writer, clusters DocumentClusters) error {
+	return internal.WriteClusterTable(w, clusters)
+}
+
+// WriteHTMLReport writes a single-file HTML report with charts, a word cloud, a Zipf plot,
+// searchable file tables and the run statistics; it needs no network access to view
+func WriteHTMLReport(w io.Writer, report HTMLReport) error {
+	return internal.WriteHTMLReport(w, report)
+}
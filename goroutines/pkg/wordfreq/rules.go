@@ -0,0 +1,36 @@
+package wordfreq
+
+import (
+	"io"
+
+	"github.com/DonAlexandro/go_advanced/internal"
+)
+
+// Types for normalising words before they are counted
+type (
+	// TokenRules rewrite aliases and drop words by length, shape, allowlist and per-file count
+	TokenRules = internal.TokenRules
+	// TokenRule identifies a rule, e.g. to read its counter in RunStats.TokenRuleHits
+	TokenRule = internal.TokenRule
+)
+
+// Normalisation rules, in the order they are applied
+const (
+	RuleSynonym    = internal.RuleSynonym
+	RuleNotAllowed = internal.RuleNotAllowed
+	RuleMinLength  = internal.RuleMinLength
+	RuleMaxLength  = internal.RuleMaxLength
+	RuleNumeric    = internal.RuleNumeric
+	RuleHex        = internal.RuleHex
+	RuleMinCount   = internal.RuleMinCount
+)
+
+// LoadTokenRules reads a rules file such as assets/rules.toml
+func LoadTokenRules(path string) (*TokenRules, error) {
+	return internal.LoadTokenRules(path)
+}
+
+// ParseTokenRules reads rules written in the TOML form of a rules file
+func ParseTokenRules(r io.Reader) (*TokenRules, error) {
+	return internal.ParseTokenRules(r)
+}
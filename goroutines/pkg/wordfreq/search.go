@@ -0,0 +1,28 @@
+package wordfreq
+
+import (
+	"io"
+
+	"github.com/DonAlexandro/go_advanced/internal"
+)
+
+// LoadIndex reads an index saved with Index.Save
+func LoadIndex(filename string) (*Index, error) {
+	return internal.LoadInvertedIndex(filename)
+}
+
+// Search runs a query such as `timeout`, `timeout AND retry` or `"worker pool" OR goroutine`
+// and returns up to limit hits (0 for all) with context runes of text on each side
+func Search(index *Index, query string, context, limit int) ([]KWICHit, error) {
+	parsed, err := index.ParseSearchQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return index.Search(parsed, context, limit), nil
+}
+
+// WriteKWIC writes hits with their keywords aligned in one column
+func WriteKWIC(w io.Writer, hits []KWICHit) error {
+	return internal.WriteKWIC(w, hits)
+}
@@ -0,0 +1,44 @@
+package wordfreq
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"github.com/DonAlexandro/go_advanced/internal"
+)
+
+// Types for tracing where the time of an analysis goes
+type (
+	// Tracer records spans and hands them to its exporter
+	Tracer = internal.Tracer
+	// Span is a timed operation of the analysis
+	Span = internal.Span
+	// SpanData is a finished span as exported
+	SpanData = internal.SpanData
+	// SpanExporter receives every finished span
+	SpanExporter = internal.SpanExporter
+	// JSONSpanExporter writes spans as JSON lines
+	JSONSpanExporter = internal.JSONSpanExporter
+)
+
+// NewTracer creates a tracer exporting to exporter
+func NewTracer(exporter SpanExporter) *Tracer {
+	return internal.NewTracer(exporter)
+}
+
+// NewJSONSpanExporter creates an exporter writing one JSON span per line to w
+func NewJSONSpanExporter(w io.Writer) *JSONSpanExporter {
+	return internal.NewJSONSpanExporter(w)
+}
+
+// WithTracer traces an analysis run with ctx: AnalyzeFS records spans for the run, file discovery,
+// every file job, every chunk counter and the merges
+func WithTracer(ctx context.Context, tracer *Tracer) context.Context {
+	return internal.WithTracer(ctx, tracer)
+}
+
+// StartSpan starts a child of the span in ctx; it returns a nil span, which records nothing, without a tracer
+func StartSpan(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, *Span) {
+	return internal.StartSpan(ctx, name, attrs...)
+}
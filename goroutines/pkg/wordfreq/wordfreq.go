@@ -0,0 +1,287 @@
+// Package wordfreq is the importable word frequency analysis library.
+//
+// It wraps the concurrent counting pipeline of the text processor behind an
+// options-based API. Nothing is read from global state: stopwords, modes and
+// worker counts all come from Options, and every call gets its own stats.
+package wordfreq
+
+import (
+	"github.com/DonAlexandro/go_advanced/internal"
+	"github.com/DonAlexandro/go_advanced/pkg"
+	"github.com/mdobak/go-xerrors"
+)
+
+// Result and option types shared with the processing pipeline
+type (
+	// Word is a word with the number of times it occurs
+	Word = internal.Word
+	// Frequency maps words to their counts
+	Frequency = internal.Frequency
+	// FileWordFrequency is the result for a single file
+	FileWordFrequency = internal.FileWordFrequency
+	// RunStats holds the counters collected during one analysis
+	RunStats = internal.RunStats
+	// ApproximateOptions configures approximate counting
+	ApproximateOptions = internal.ApproximateOptions
+	// ApproximateStats holds approximate results and their error bounds
+	ApproximateStats = internal.ApproximateStats
+	// ApproximateWord is an approximate top-K word with bounds of its count
+	ApproximateWord = internal.ApproximateWord
+	// InputDigest identifies the exact content of an input file
+	InputDigest = internal.InputDigest
+	// Index is an inverted index of word positions, searchable with KWIC snippets
+	Index = internal.InvertedIndex
+	// SearchQuery is a parsed search query
+	SearchQuery = internal.SearchQuery
+	// KWICHit is a search hit shown as a keyword-in-context snippet
+	KWICHit = internal.KWICHit
+	// StopwordSet is a set of words excluded from the counts
+	StopwordSet = pkg.StopwordSet
+	// PipelineMode selects how text goes through the preprocessing stages
+	PipelineMode = internal.PipelineMode
+	// InputMode selects how files are loaded into memory
+	InputMode = internal.InputMode
+	// MergeMode selects how chunk frequencies are combined
+	MergeMode = internal.MergeMode
+	// ExtractMode selects how the text to count is extracted from markup files
+	ExtractMode = internal.ExtractMode
+	// CollocationOptions configures co-occurrence counting
+	CollocationOptions = internal.CollocationOptions
+	// CollocationStats holds the top collocations of a file or the corpus
+	CollocationStats = internal.CollocationStats
+	// Collocation is a pair of words with how strongly they are associated
+	Collocation = internal.Collocation
+	// CollocationRank selects the score collocations are ranked by
+	CollocationRank = internal.CollocationRank
+	// DuplicateOptions configures near-duplicate detection
+	DuplicateOptions = internal.DuplicateOptions
+	// DuplicateCluster is a group of near-identical files
+	DuplicateCluster = internal.DuplicateCluster
+	// DuplicateFile is a member of a near-duplicate cluster
+	DuplicateFile = internal.DuplicateFile
+	// ReadabilityStats holds sentence, syllable and vocabulary metrics of a document
+	ReadabilityStats = internal.ReadabilityStats
+)
+
+// Pipeline, input, merge and extract modes, and collocation ranks
+const (
+	PipelineStream = internal.PipelineStream
+	PipelineBatch  = internal.PipelineBatch
+	PipelineFused  = internal.PipelineFused
+	PipelineBytes  = internal.PipelineBytes
+
+	InputReadFile = internal.InputReadFile
+	InputMmap     = internal.InputMmap
+
+	MergeSingle  = internal.MergeSingle
+	MergeSharded = internal.MergeSharded
+
+	ExtractPlain    = internal.ExtractPlain
+	ExtractAuto     = internal.ExtractAuto
+	ExtractHTML     = internal.ExtractHTML
+	ExtractMarkdown = internal.ExtractMarkdown
+	ExtractJSON     = internal.ExtractJSON
+
+	RankLogLikelihood = internal.RankLogLikelihood
+	RankPMI           = internal.RankPMI
+)
+
+// Default worker settings, matching the command line tool
+const (
+	DefaultWorkers  = 4
+	DefaultCounters = 2
+	// DefaultSplitSize is the file size from which several workers share a file
+	DefaultSplitSize = 32 << 20
+)
+
+// DefaultJSONFields are the fields kept by the JSON extractor when none are configured
+var DefaultJSONFields = internal.DefaultJSONFields
+
+// Options configures an analysis
+type Options struct {
+	// Workers is the number of files processed concurrently (AnalyzeFS only)
+	Workers int
+	// Counters is the number of goroutines counting chunks of one file
+	Counters int
+	// Pipeline decides how each chunk goes through the preprocessing stages; the zero value is PipelineBatch
+	Pipeline PipelineMode
+	// Input decides how files are loaded; mmap only applies to files backed by *os.File (os.DirFS)
+	Input InputMode
+	// Merge decides how chunk frequencies are combined
+	Merge MergeMode
+	// Extract decides how text is extracted from HTML, Markdown and JSON files.
+	// ExtractAuto picks by extension and also analyses markup files, a forced extractor also analyses
+	// the files of its own format, and the zero value counts .txt files as they are.
+	Extract ExtractMode
+	// JSONFields are the string fields the JSON extractor keeps; nil means DefaultJSONFields
+	JSONFields []string
+	// Stopwords are excluded from the counts; nil disables filtering
+	Stopwords StopwordSet
+	// Approximate switches to fixed-memory top-K counting when set
+	Approximate *ApproximateOptions
+	// Deterministic orders results by path and words by count then word, merges
+	// approximate sketches in path order and hashes every input for the manifest.
+	// In approximate mode every file sketch is kept until the end of the run.
+	Deterministic bool
+	// Collocations also counts which words occur together, per file and corpus-wide
+	Collocations *CollocationOptions
+	// Readability measures sentences, syllables, Flesch scores and lexical variety of every file
+	Readability bool
+	// Duplicates groups near-identical files into Report.Duplicates (AnalyzeFS only).
+	// With Representatives set, every file signature, approximate sketch and
+	// co-occurrence table is kept until the end of the run.
+	Duplicates *DuplicateOptions
+	// Index records where every word occurs in Report.Index (AnalyzeFS only).
+	// The index keeps the text of every file for search snippets; its words are normalised
+	// by Rules like the counts, and queries against it too.
+	Index bool
+	// Metrics collects counters, stage latencies and pool gauges of every run it is passed to;
+	// nil disables them. Serve it at /metrics to scrape long-running processes.
+	Metrics *Metrics
+	// SplitSize is the file size from which a file is split into parts that several workers
+	// count at once (exact counting only); 0 means DefaultSplitSize and a negative value disables splitting
+	SplitSize int64
+	// Journal records every completed file as it finishes, and files it already holds with
+	// unchanged content are not counted again (AnalyzeFS only). Open it with CreateJournal or
+	// ResumeJournal. Corpus-wide modes (approximate, collocations, near-duplicates, index)
+	// need the content of every file, so they cannot be combined with a journal.
+	Journal *Journal
+	// Redaction blanks out emails, addresses, card numbers and other sensitive text before
+	// any other stage sees it, and counts the matches per class; nil disables it
+	Redaction *RedactionOptions
+	// Rules rewrite aliases and drop words by length, shape or allowlist ahead of stopword
+	// filtering, and drop words rarer than a per-file minimum count; nil keeps every word
+	Rules *TokenRules
+}
+
+// DefaultOptions returns the options used by the command line tool
+func DefaultOptions() Options {
+	return Options{
+		Workers:  DefaultWorkers,
+		Counters: DefaultCounters,
+		Pipeline: PipelineBatch,
+	}
+}
+
+// validate checks option values that cannot be defaulted
+func (o Options) validate() error {
+	if o.Workers < 0 {
+		return xerrors.Newf("number of workers must not be negative, got: %d", o.Workers)
+	}
+	if o.Counters < 0 {
+		return xerrors.Newf("number of counters must not be negative, got: %d", o.Counters)
+	}
+	if o.Approximate != nil {
+		if err := o.Approximate.Validate(); err != nil {
+			return err
+		}
+	}
+	if c := o.Collocations; c != nil && (c.Window < 1 || c.MinCount < 1 || c.TopN < 1 || c.MemoryBudget <= 0) {
+		return xerrors.Newf("collocation mode needs a positive window, minimum count, top-N and memory budget, got: window %d, min %d, top %d, %d bytes", c.Window, c.MinCount, c.TopN, c.MemoryBudget)
+	}
+	if o.Journal != nil && !o.Resumable() {
+		return xerrors.New("a journal cannot be used with approximate, collocation, near-duplicate or index mode")
+	}
+	if _, err := o.newRedactor(); err != nil {
+		return err
+	}
+	if err := o.Rules.Validate(); err != nil {
+		return err
+	}
+	if d := o.Duplicates; d != nil && (d.Threshold <= 0 || d.Threshold > 1 || d.Shingle < 1 || d.Bands < 1 || d.Rows < 1) {
+		return xerrors.Newf("duplicate detection needs a threshold in (0, 1] and a positive shingle size, bands and rows, got: threshold %g, shingle %d, %d bands of %d rows", d.Threshold, d.Shingle, d.Bands, d.Rows)
+	}
+	return nil
+}
+
+// withDefaults fills zero worker counts with the defaults
+func (o Options) withDefaults() Options {
+	if o.Workers == 0 {
+		o.Workers = DefaultWorkers
+	}
+	if o.Counters == 0 {
+		o.Counters = DefaultCounters
+	}
+	if o.JSONFields == nil {
+		o.JSONFields = DefaultJSONFields
+	}
+	if o.SplitSize == 0 {
+		o.SplitSize = DefaultSplitSize
+	} else if o.SplitSize < 0 {
+		o.SplitSize = 0
+	}
+	return o
+}
+
+// collectors are what the counting pipeline records about every file besides its words.
+// They are created per run from the options that enable them; a nil collector records nothing.
+type collectors struct {
+	stats        *RunStats
+	digests      *internal.InputDigests
+	index        *Index
+	collocations *internal.CollocationCollector
+	duplicates   *internal.DuplicateDetector
+	readability  *internal.ReadabilityCollector
+	redactor     *internal.Redactor
+}
+
+// countOptions converts the public options for the counting pipeline
+func (o Options) countOptions(c collectors) internal.CountOptions {
+	return internal.CountOptions{
+		Redactor:     c.redactor,
+		Rules:        o.Rules,
+		Readability:  c.readability,
+		Collocations: c.collocations,
+		Duplicates:   c.duplicates,
+		Digests:      c.digests,
+		Index:        c.index,
+		Extract:      internal.ExtractOptions{Mode: o.Extract, JSONFields: o.JSONFields},
+		Counters:     o.Counters,
+		Pipeline:     o.Pipeline,
+		Input:        o.Input,
+		Merge:        o.Merge,
+		Stopwords:    o.Stopwords,
+		Stats:        c.stats,
+		Metrics:      o.Metrics,
+	}
+}
+
+// ParsePipelineMode converts a name (stream, batch, fused or bytes) into a PipelineMode
+func ParsePipelineMode(name string) (PipelineMode, error) {
+	return internal.ParsePipelineMode(name)
+}
+
+// ParseInputMode converts a name (read or mmap) into an InputMode
+func ParseInputMode(name string) (InputMode, error) {
+	return internal.ParseInputMode(name)
+}
+
+// ParseMergeMode converts a name (single or sharded) into a MergeMode
+func ParseMergeMode(name string) (MergeMode, error) {
+	return internal.ParseMergeMode(name)
+}
+
+// ParseExtractMode converts a name (auto, plain, html, markdown or json) into an ExtractMode
+func ParseExtractMode(name string) (ExtractMode, error) {
+	return internal.ParseExtractMode(name)
+}
+
+// ParseJSONFields splits a comma-separated list of JSON fields
+func ParseJSONFields(list string) []string {
+	return internal.ParseJSONFields(list)
+}
+
+// ParseCollocationRank converts a name (llr or pmi) into a CollocationRank
+func ParseCollocationRank(name string) (CollocationRank, error) {
+	return internal.ParseCollocationRank(name)
+}
+
+// DefaultDuplicateOptions returns the near-duplicate settings of the command line tool
+func DefaultDuplicateOptions() DuplicateOptions {
+	return internal.DefaultDuplicateOptions()
+}
+
+// ParseByteSize parses sizes such as "512KB", "100MB" or "1GB"
+func ParseByteSize(size string) (int64, error) {
+	return internal.ParseByteSize(size)
+}
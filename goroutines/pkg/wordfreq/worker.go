@@ -0,0 +1,530 @@
+package wordfreq
+
+import (
+	"cmp"
+	"context"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DonAlexandro/go_advanced/internal"
+)
+
+// fileJob is a file to count, or one part of a huge file being counted by several workers
+type fileJob struct {
+	path string
+	size int64
+	// split and part are set for the parts of a split file
+	split *splitJob
+	part  int
+}
+
+// splitJob is a huge file whose parts are spread over the workers; the worker finishing
+// the last part completes the file
+type splitJob struct {
+	file *internal.SplitFile
+	ctx  context.Context
+	span *internal.Span
+}
+
+// worker processes file jobs from the shared jobs channel
+type worker struct {
+	ctx          context.Context
+	fsys         fs.FS
+	jobs         chan fileJob
+	results      chan<- FileWordFrequency
+	errChan      chan<- FileError
+	options      internal.CountOptions
+	approximate  *ApproximateOptions
+	corpus       *internal.ApproximateCounter
+	sketches     *fileSketches
+	collocations *internal.CollocationCollector
+	journal      *internal.Journal
+	// splitSize is the size from which files are split into parts; 0 disables splitting
+	splitSize int64
+	workers   int
+	// pending counts queued and running jobs; the jobs channel is closed when it drops to zero
+	pending       *sync.WaitGroup
+	mu            *sync.Mutex
+	doneCond      *sync.Cond
+	activeWorkers *int
+}
+
+func (w worker) work() {
+	for job := range w.jobs {
+		started := time.Now()
+
+		// Parts are counted even after cancellation, so the file they belong to is released
+		if job.split != nil {
+			w.countPart(job)
+		} else if w.ctx.Err() == nil {
+			// Drain remaining jobs without processing them once the analysis is cancelled
+			w.process(job)
+		}
+
+		w.options.Stats.WorkerBusy.Add(int64(time.Since(started)))
+		w.pending.Done()
+	}
+
+	// Signal completion only after all channel operations are done
+	w.mu.Lock()
+	(*w.activeWorkers)--
+	w.doneCond.Broadcast()
+	w.mu.Unlock()
+}
+
+// process counts one file, unless a journal already holds its result, or splits it into parts
+func (w worker) process(job fileJob) {
+	ctx, span := internal.StartSpan(w.ctx, "file", slog.String("file.path", job.path), slog.Int64("file.size", job.size))
+	result, resumed := w.resume(job.path)
+	span.SetAttributes(slog.Bool("file.resumed", resumed))
+	if resumed {
+		w.finish(ctx, span, result, true, nil)
+		return
+	}
+
+	if w.splittable(job.size) {
+		w.split(ctx, span, job)
+		return
+	}
+
+	result, err := w.count(ctx, job.path)
+	w.finish(ctx, span, result, false, err)
+}
+
+// splittable reports whether a file is large enough to be counted by several workers.
+// Approximate sketches are merged per file, so only exact counts are split.
+func (w worker) splittable(size int64) bool {
+	return w.splitSize > 0 && size >= w.splitSize && w.approximate == nil && w.workers > 1
+}
+
+// split loads a huge file and queues its parts; this worker counts the first one itself
+func (w worker) split(ctx context.Context, span *internal.Span, job fileJob) {
+	opts := w.options
+	opts.Context = internal.WithLogFile(ctx, job.path)
+
+	parts := min(w.workers, int((job.size+w.splitSize-1)/w.splitSize))
+	file, err := internal.LoadSplitFile(w.fsys, job.path, opts, parts)
+	if err != nil {
+		w.finish(ctx, span, FileWordFrequency{FileName: path.Base(job.path), Path: job.path}, false, err)
+		return
+	}
+
+	w.options.Stats.FilesSplit.Add(1)
+	span.SetAttributes(slog.Int("file.parts", file.Parts()))
+	splitJob := &splitJob{file: file, ctx: ctx, span: span}
+
+	// The parts are queued from another goroutine: every worker may be splitting at once,
+	// and a full queue must not block the workers that would drain it
+	w.pending.Add(file.Parts() - 1)
+	go func() {
+		for part := 1; part < file.Parts(); part++ {
+			w.jobs <- fileJob{path: job.path, size: job.size, split: splitJob, part: part}
+		}
+	}()
+
+	w.countPart(fileJob{path: job.path, split: splitJob, part: 0})
+}
+
+// countPart counts one part of a split file, completing the file after its last part
+func (w worker) countPart(job fileJob) {
+	words, done := job.split.file.CountPart(job.part)
+	if !done {
+		return
+	}
+
+	result := FileWordFrequency{
+		FileName:     path.Base(job.path),
+		Path:         job.path,
+		Words:        words,
+		Collocations: w.fileCollocations(job.path),
+		Readability:  w.options.Readability.File(job.path),
+		Redactions:   w.options.Redactor.File(job.path),
+	}
+	w.finish(job.split.ctx, job.split.span, result, false, nil)
+}
+
+// finish journals and hands on the result of a file, or its error, and ends its span
+func (w worker) finish(ctx context.Context, span *internal.Span, result FileWordFrequency, resumed bool, err error) {
+	if err == nil && !resumed {
+		w.record(ctx, result)
+	}
+	if span != nil {
+		span.SetAttributes(fileWordCounts(result)...)
+	}
+	span.End(err)
+
+	if err != nil {
+		// Files after this one need not wait for its collocations
+		w.collocations.Skip(result.Path)
+		w.options.Stats.FilesFailed.Add(1)
+		w.errChan <- FileError{Path: result.Path, Err: err}
+		return
+	}
+
+	w.options.Stats.FilesProcessed.Add(1)
+	w.results <- result
+}
+
+// count produces the result for one file, exact or approximate depending on the worker setup
+// ctx carries the span of the file job
+func (w worker) count(ctx context.Context, filePath string) (FileWordFrequency, error) {
+	// Create result using the struct
+	result := FileWordFrequency{
+		FileName: path.Base(filePath),
+		Path:     filePath,
+	}
+
+	// Log lines about the file carry its path next to the run id
+	opts := w.options
+	opts.Context = internal.WithLogFile(ctx, filePath)
+
+	if w.approximate == nil {
+		words, err := internal.CountWordFrequency(w.fsys, filePath, opts)
+		result.Words = words
+		result.Collocations = w.fileCollocations(filePath)
+		result.Readability = w.options.Readability.File(filePath)
+		result.Redactions = w.options.Redactor.File(filePath)
+		return result, err
+	}
+
+	counter, err := internal.CountWordFrequencyApproximate(w.fsys, filePath, opts, *w.approximate)
+	if err != nil {
+		return result, err
+	}
+
+	// Fold the file sketch into the corpus-wide sketch, or keep it for an ordered merge
+	if w.sketches != nil {
+		w.sketches.add(filePath, counter)
+	} else {
+		w.corpus.Merge(counter)
+	}
+
+	result.Approximate = counter.Stats()
+	result.Words = result.Approximate.Words()
+	result.Collocations = w.fileCollocations(filePath)
+	result.Readability = w.options.Readability.File(filePath)
+	result.Redactions = w.options.Redactor.File(filePath)
+
+	return result, nil
+}
+
+// resume returns the journaled result of a file if its content has not changed since
+func (w worker) resume(filePath string) (FileWordFrequency, bool) {
+	entry, ok := w.journal.Completed(filePath)
+	if !ok {
+		return FileWordFrequency{}, false
+	}
+
+	// Hashing is much cheaper than counting, and catches files edited since the journal was written
+	digest, err := internal.DigestFile(w.fsys, filePath)
+	if err != nil || digest != entry.Input {
+		return FileWordFrequency{}, false
+	}
+
+	w.options.Digests.Add(digest)
+	w.options.Stats.FilesResumed.Add(1)
+	return entry.Result, true
+}
+
+// record appends a counted file to the journal; a failed write only costs the file on resume
+func (w worker) record(ctx context.Context, result FileWordFrequency) {
+	if w.journal == nil {
+		return
+	}
+
+	digest, _ := w.options.Digests.Get(result.Path)
+	if err := w.journal.Append(internal.JournalEntry{Input: digest, Result: result}); err != nil {
+		slog.WarnContext(ctx, "failed to journal file result", slog.String("file", result.Path), slog.Any("error", err))
+	}
+}
+
+// fileWordCounts returns the word count attributes of a file span
+func fileWordCounts(result FileWordFrequency) []slog.Attr {
+	if result.Approximate != nil {
+		return []slog.Attr{slog.Uint64("words.total", result.Approximate.TotalWords), slog.Uint64("words.distinct", result.Approximate.DistinctWords)}
+	}
+
+	total := 0
+	for _, word := range result.Words {
+		total += word.Count
+	}
+	return []slog.Attr{slog.Int("words.total", total), slog.Int("words.distinct", len(result.Words))}
+}
+
+// fileCollocations returns the collocations counted while reading a file, if enabled
+func (w worker) fileCollocations(filePath string) *CollocationStats {
+	if w.collocations == nil {
+		return nil
+	}
+	return w.collocations.File(filePath)
+}
+
+// runWorkerPool analyses every text file of fsys with opts.Workers concurrent workers
+// The pool only sees fs.FS, so it runs unchanged on disk, archives, overlays or in-memory trees
+func runWorkerPool(ctx context.Context, fsys fs.FS, opts Options) (*Report, error) {
+	// Every log line of the run is correlated by one id; callers may pick it to log with it too
+	if internal.RunID(ctx) == "" {
+		ctx = internal.WithRunID(ctx, internal.NewRunID())
+	}
+	report := &Report{Stats: &RunStats{}, RunID: internal.RunID(ctx)}
+	stats := report.Stats
+
+	// The run span is the parent of every span of the analysis; it is a no-op without a tracer
+	ctx, runSpan := internal.StartSpan(ctx, "run", slog.String("run.id", report.RunID), slog.Int("workers", opts.Workers), slog.Int("counters", opts.Counters))
+
+	// Leaving duplicates out of corpus-wide results means keeping every file's contribution until clusters are known
+	representatives := opts.Duplicates != nil && opts.Duplicates.Representatives
+
+	var corpus *internal.ApproximateCounter
+	var sketches *fileSketches
+	if opts.Approximate != nil {
+		corpus = internal.NewApproximateCounter(*opts.Approximate)
+		if opts.Deterministic || representatives {
+			sketches = &fileSketches{counters: make(map[string]*internal.ApproximateCounter)}
+		}
+	}
+
+	// Inputs are only hashed when the run has to be reproducible, or journaled to be resumed
+	var digests *internal.InputDigests
+	if opts.Deterministic || opts.Journal != nil {
+		digests = &internal.InputDigests{}
+	}
+
+	// Readability is measured file by file while the punctuation is still there
+	var readability *internal.ReadabilityCollector
+	if opts.Readability {
+		readability = internal.NewReadabilityCollector()
+	}
+
+	// Sensitive text is blanked out as files are read; options are validated, so it compiles
+	redactor, _ := opts.newRedactor()
+
+	// Signatures are computed while files are read and clustered once all are done
+	var duplicates *internal.DuplicateDetector
+	if opts.Duplicates != nil {
+		duplicates = internal.NewDuplicateDetector(*opts.Duplicates)
+	}
+
+	// The index is shared by all workers and sorted once they are done
+	var index *Index
+	if opts.Index {
+		index = internal.NewInvertedIndex(opts.Stopwords, opts.Rules)
+	}
+
+	// Get all text files from the file system
+	_, discoverSpan := internal.StartSpan(ctx, "discover")
+	txtFiles, err := internal.GetInputFiles(fsys, internal.ExtractOptions{Mode: opts.Extract})
+	discoverSpan.SetAttributes(slog.Int("files", len(txtFiles)))
+	discoverSpan.End(err)
+	if err != nil {
+		runSpan.End(err)
+		return nil, err
+	}
+
+	// Collocations are counted per file and merged corpus-wide, in path order when deterministic.
+	// Discovery lists paths in lexical order, so files can be folded in as soon as their turn comes.
+	var collocations *internal.CollocationCollector
+	if opts.Collocations != nil {
+		var order []string
+		if opts.Deterministic {
+			order = txtFiles
+		}
+		collocations = internal.NewCollocationCollector(*opts.Collocations, order, representatives)
+	}
+
+	// The largest files start first, so no worker picks up a huge file when the others are nearly done
+	fileJobs := scheduleLargestFirst(fsys, txtFiles)
+	jobsNum := len(fileJobs)
+
+	jobs := make(chan fileJob, jobsNum)
+	results := make(chan FileWordFrequency, jobsNum)
+	errChan := make(chan FileError, jobsNum)
+
+	// Setup graceful shutdown coordination with sync.Cond
+	var mu sync.Mutex
+	doneCond := sync.NewCond(&mu)
+	var activeWorkers int
+
+	// Metrics follow the pool while it runs; the counters stay in the totals afterwards
+	opts.Metrics.TrackRun(stats, func() (int, int, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(jobs), len(results), activeWorkers
+	})
+	defer opts.Metrics.FinishRun(stats)
+
+	countOptions := opts.countOptions(collectors{
+		stats:        stats,
+		digests:      digests,
+		index:        index,
+		collocations: collocations,
+		duplicates:   duplicates,
+		readability:  readability,
+		redactor:     redactor,
+	})
+
+	var wg sync.WaitGroup
+	var pending sync.WaitGroup
+	poolStarted := time.Now()
+
+	// Create and start the worker pool
+	for w := 1; w <= opts.Workers; w++ {
+		// Increment active worker count before spawning
+		mu.Lock()
+		activeWorkers++
+		mu.Unlock()
+
+		wg.Go(func() {
+			worker := worker{
+				ctx:           ctx,
+				fsys:          fsys,
+				jobs:          jobs,
+				results:       results,
+				errChan:       errChan,
+				options:       countOptions,
+				approximate:   opts.Approximate,
+				corpus:        corpus,
+				sketches:      sketches,
+				collocations:  collocations,
+				journal:       opts.Journal,
+				splitSize:     opts.SplitSize,
+				workers:       opts.Workers,
+				pending:       &pending,
+				mu:            &mu,
+				doneCond:      doneCond,
+				activeWorkers: &activeWorkers,
+			}
+
+			worker.work()
+		})
+	}
+
+	// Send all file jobs to jobs channel
+	pending.Add(jobsNum)
+	for _, job := range fileJobs {
+		jobs <- job
+	}
+
+	// Split files queue their parts on the same channel, so it is only closed
+	// once every job, parts included, is done
+	go func() {
+		pending.Wait()
+		close(jobs)
+	}()
+
+	// Wait for all workers to be spawned and registered
+	wg.Wait()
+
+	// Wait for all workers to complete their tasks using sync.Cond
+	mu.Lock()
+	for activeWorkers > 0 {
+		doneCond.Wait() // Releases mu, waits for Broadcast, reacquires mu
+	}
+	mu.Unlock()
+
+	// Close results and error channels after all workers finished
+	close(results)
+	close(errChan)
+	stats.WorkerCapacity.Add(int64(opts.Workers) * int64(time.Since(poolStarted)))
+
+	for result := range results {
+		report.Files = append(report.Files, result)
+	}
+
+	for fileErr := range errChan {
+		report.Errors = append(report.Errors, fileErr)
+	}
+
+	// Only representatives of near-duplicate clusters are counted when requested
+	var skip map[string]bool
+	if duplicates != nil {
+		report.Duplicates = duplicates.Clusters()
+		if representatives {
+			skip = internal.DuplicatePaths(report.Duplicates)
+			report.Files = slices.DeleteFunc(report.Files, func(file FileWordFrequency) bool {
+				return skip[file.Path]
+			})
+		}
+	}
+
+	// Corpus-wide results are merged once all files are counted
+	_, mergeSpan := internal.StartSpan(ctx, "merge corpus")
+	if sketches != nil {
+		sketches.mergeInto(corpus, skip)
+	}
+
+	if corpus != nil {
+		report.Corpus = corpus.Stats()
+	}
+
+	if collocations != nil {
+		report.Collocations = collocations.Corpus(skip)
+	}
+
+	if index != nil {
+		index.Sort()
+		report.Index = index
+	}
+	mergeSpan.End(nil)
+
+	if redactor != nil {
+		report.Redactions = sumRedactions(report.Files)
+	}
+
+	if opts.Deterministic {
+		report.sort()
+		report.Inputs = digests.All()
+	}
+
+	runSpan.SetAttributes(slog.Int("files.processed", len(report.Files)), slog.Int("files.failed", len(report.Errors)))
+	runSpan.End(ctx.Err())
+
+	return report, ctx.Err()
+}
+
+// scheduleLargestFirst turns files into jobs ordered by size, largest first and then by path.
+// A file that cannot be stat'ed is queued last; counting it reports the error.
+func scheduleLargestFirst(fsys fs.FS, files []string) []fileJob {
+	jobs := make([]fileJob, 0, len(files))
+	for _, filePath := range files {
+		job := fileJob{path: filePath}
+		if info, err := fs.Stat(fsys, filePath); err == nil {
+			job.size = info.Size()
+		}
+		jobs = append(jobs, job)
+	}
+
+	slices.SortStableFunc(jobs, func(a, b fileJob) int {
+		return cmp.Or(cmp.Compare(b.size, a.size), strings.Compare(a.path, b.path))
+	})
+	return jobs
+}
+
+// fileSketches keeps per-file sketches so they can be merged in path order,
+// which makes the approximate corpus result independent of worker scheduling
+type fileSketches struct {
+	mu       sync.Mutex
+	counters map[string]*internal.ApproximateCounter
+}
+
+// add stores the sketch of one file
+func (s *fileSketches) add(filePath string, counter *internal.ApproximateCounter) {
+	s.mu.Lock()
+	s.counters[filePath] = counter
+	s.mu.Unlock()
+}
+
+// mergeInto merges the stored sketches of all files but those in skip into corpus, ordered by path
+func (s *fileSketches) mergeInto(corpus *internal.ApproximateCounter, skip map[string]bool) {
+	for _, filePath := range slices.Sorted(maps.Keys(s.counters)) {
+		if !skip[filePath] {
+			corpus.Merge(s.counters[filePath])
+		}
+	}
+}